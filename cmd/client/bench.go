@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"local/pkg/client"
+
+	"github.com/spf13/pflag"
+)
+
+// Операции нагрузочного теста.
+const (
+	opShorten  = "shorten"
+	opRedirect = "redirect"
+)
+
+func benchFlags(fs *pflag.FlagSet) {
+	fs.DurationP("duration", "d", 10*time.Second, "How long to generate load")
+	fs.IntP("concurrency", "c", 8, "Number of concurrent workers")
+	fs.Float64("write-ratio", 0.1, "Share of shorten requests, the rest are redirects (0..1)")
+	fs.StringP("file", "f", "", "URL corpus, one per line (- for stdin); a synthetic corpus is used if empty")
+	fs.Int("corpus-size", 1000, "Size of the synthetic URL corpus")
+	fs.String("results", "", "Also write the report as JSON to this file")
+}
+
+// opReport — результаты одной операции. Задержки в миллисекундах.
+type opReport struct {
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	Throughput float64 `json:"throughput_rps"`
+	Mean       float64 `json:"mean_ms"`
+	P50        float64 `json:"p50_ms"`
+	P90        float64 `json:"p90_ms"`
+	P99        float64 `json:"p99_ms"`
+	Max        float64 `json:"max_ms"`
+}
+
+// benchReport — итог нагрузочного теста.
+type benchReport struct {
+	Server      string              `json:"server"`
+	Duration    float64             `json:"duration_seconds"`
+	Concurrency int                 `json:"concurrency"`
+	WriteRatio  float64             `json:"write_ratio"`
+	Operations  map[string]opReport `json:"operations"`
+	Total       opReport            `json:"total"`
+	// Errors — ошибки по HTTP-статусу, а также timeout и network.
+	Errors map[string]int `json:"errors"`
+}
+
+// sample — одна выполненная операция.
+type sample struct {
+	op      string
+	latency time.Duration
+	err     string // пусто, если запрос успешен
+}
+
+func runBench(a *app, fs *pflag.FlagSet) int {
+	if fs.NArg() != 0 {
+		fmt.Fprintln(a.stderr, "bench: no arguments expected")
+		return exitUsage
+	}
+	duration, _ := fs.GetDuration("duration")
+	concurrency, _ := fs.GetInt("concurrency")
+	writeRatio, _ := fs.GetFloat64("write-ratio")
+	file, _ := fs.GetString("file")
+	corpusSize, _ := fs.GetInt("corpus-size")
+	results, _ := fs.GetString("results")
+	if duration <= 0 || concurrency <= 0 || writeRatio < 0 || writeRatio > 1 || corpusSize <= 0 {
+		fmt.Fprintln(a.stderr, "bench: duration, concurrency and corpus size must be positive and write ratio within 0..1")
+		return exitUsage
+	}
+
+	corpus, err := benchCorpus(file, corpusSize, a)
+	if err != nil {
+		fmt.Fprintf(a.stderr, "bench: %v\n", err)
+		return exitFailure
+	}
+
+	// Для редиректов нужны существующие коды: сокращаем корпус заранее, вне замера
+	var codes []string
+	if writeRatio < 1 {
+		for batch := range slices.Chunk(corpus, shortenBatchSize) {
+			result, err := a.client.ShortenBatch(context.Background(), batch)
+			if err != nil {
+				fmt.Fprintf(a.stderr, "bench: preparing corpus: %v\n", err)
+				return exitFailure
+			}
+			for _, r := range result {
+				codes = append(codes, r.Code)
+			}
+		}
+	}
+
+	samples, elapsed := generateLoad(a.client, corpus, codes, concurrency, writeRatio, duration)
+	report := buildReport(samples, elapsed)
+	report.Server = a.client.BaseURL()
+	report.Concurrency = concurrency
+	report.WriteRatio = writeRatio
+
+	if results != "" {
+		if err := writeReport(results, report); err != nil {
+			fmt.Fprintf(a.stderr, "bench: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	// Нагрузка, в которой не прошёл ни один запрос, считается неудачной
+	status := exitOK
+	if report.Total.Requests == report.Total.Errors {
+		status = exitFailure
+	}
+
+	if a.format == formatJSON {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(a.stderr, err)
+			return exitFailure
+		}
+		return status
+	}
+
+	t := &table{header: []string{"operation", "requests", "errors", "rps", "mean_ms", "p50_ms", "p90_ms", "p99_ms", "max_ms"}}
+	for _, op := range []string{opShorten, opRedirect} {
+		if r, ok := report.Operations[op]; ok {
+			t.add(reportRow(op, r)...)
+		}
+	}
+	t.add(reportRow("total", report.Total)...)
+	code := a.print(t, status)
+	for _, status := range sortedKeys(report.Errors) {
+		fmt.Fprintf(a.stderr, "errors %s: %d\n", status, report.Errors[status])
+	}
+	return code
+}
+
+// benchCorpus читает корпус из файла или генерирует синтетический.
+func benchCorpus(file string, size int, a *app) ([]string, error) {
+	if file != "" {
+		corpus, err := readURLs(file, a.stdin)
+		if err != nil {
+			return nil, err
+		}
+		if len(corpus) == 0 {
+			return nil, errors.New("URL corpus is empty")
+		}
+		return corpus, nil
+	}
+	corpus := make([]string, size)
+	for i := range corpus {
+		corpus[i] = "https://example.com/bench/" + strconv.Itoa(i)
+	}
+	return corpus, nil
+}
+
+// generateLoad запускает concurrency воркеров на duration. Запись создаёт
+// новую ссылку (уникальный URL на основе корпуса), чтение — редирект по коду.
+func generateLoad(c *client.Client, corpus, codes []string, concurrency int, writeRatio float64, duration time.Duration) ([]sample, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+		seq     atomic.Int64
+	)
+	start := time.Now()
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []sample
+			for ctx.Err() == nil {
+				op := opRedirect
+				if len(codes) == 0 || rand.Float64() < writeRatio {
+					op = opShorten
+				}
+
+				began := time.Now()
+				var err error
+				if op == opShorten {
+					u := corpus[rand.IntN(len(corpus))]
+					_, err = c.Shorten(ctx, u+"#bench-"+strconv.FormatInt(seq.Add(1), 10))
+				} else {
+					_, err = c.Expand(ctx, codes[rand.IntN(len(codes))])
+				}
+				// Запросы, прерванные окончанием теста, не учитываем
+				if ctx.Err() != nil {
+					break
+				}
+				local = append(local, sample{op: op, latency: time.Since(began), err: errorClass(err)})
+			}
+			mu.Lock()
+			samples = append(samples, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return samples, time.Since(start)
+}
+
+// errorClass группирует ошибки: HTTP-статус, timeout или network.
+func errorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.Code)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "network"
+}
+
+func buildReport(samples []sample, elapsed time.Duration) benchReport {
+	report := benchReport{
+		Duration:   elapsed.Seconds(),
+		Operations: make(map[string]opReport),
+		Errors:     make(map[string]int),
+	}
+
+	byOp := make(map[string][]sample)
+	for _, s := range samples {
+		byOp[s.op] = append(byOp[s.op], s)
+		if s.err != "" {
+			report.Errors[s.err]++
+		}
+	}
+	for op, ss := range byOp {
+		report.Operations[op] = summarize(ss, elapsed)
+	}
+	report.Total = summarize(samples, elapsed)
+	return report
+}
+
+func summarize(samples []sample, elapsed time.Duration) opReport {
+	r := opReport{Requests: len(samples)}
+	if len(samples) == 0 {
+		return r
+	}
+
+	latencies := make([]time.Duration, 0, len(samples))
+	var sum time.Duration
+	for _, s := range samples {
+		if s.err != "" {
+			r.Errors++
+		}
+		latencies = append(latencies, s.latency)
+		sum += s.latency
+	}
+	slices.Sort(latencies)
+
+	r.Throughput = float64(len(samples)) / elapsed.Seconds()
+	r.Mean = ms(sum / time.Duration(len(latencies)))
+	r.P50 = ms(percentile(latencies, 50))
+	r.P90 = ms(percentile(latencies, 90))
+	r.P99 = ms(percentile(latencies, 99))
+	r.Max = ms(latencies[len(latencies)-1])
+	return r
+}
+
+// percentile возвращает p-й перцентиль отсортированных значений (метод ближайшего ранга).
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p / 100 * float64(len(sorted)))
+	if float64(rank) < p/100*float64(len(sorted)) {
+		rank++
+	}
+	return sorted[max(rank, 1)-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func reportRow(name string, r opReport) []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	return []string{name, strconv.Itoa(r.Requests), strconv.Itoa(r.Errors),
+		f(r.Throughput), f(r.Mean), f(r.P50), f(r.P90), f(r.P99), f(r.Max)}
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func writeReport(name string, report benchReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"local/handlers/urlhandler"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+	assert.Equal(t, time.Millisecond, percentile(sorted, 0))
+	assert.Equal(t, 7*time.Millisecond, percentile([]time.Duration{7 * time.Millisecond}, 90))
+	assert.Zero(t, percentile(nil, 50))
+}
+
+func TestBench(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		var rs []urlhandler.URLRequest
+		json.NewDecoder(r.Body).Decode(&rs)
+		for i := range rs {
+			rs[i].ShortURL = "code"
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rs)
+	})
+	mux.HandleFunc("GET /{code}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com", http.StatusTemporaryRedirect)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	results := filepath.Join(t.TempDir(), "bench.json")
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-s", srv.URL, "bench", "-d", "100ms", "-c", "2", "--write-ratio", "0.5", "--corpus-size", "10", "--results", results},
+		func(string) (string, bool) { return "", false }, nil, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "shorten"))
+	assert.True(t, strings.HasPrefix(lines[1], "redirect"))
+	assert.True(t, strings.HasPrefix(lines[2], "total"))
+
+	data, err := os.ReadFile(results)
+	require.NoError(t, err)
+	var report benchReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, srv.URL, report.Server)
+	assert.Equal(t, 2, report.Concurrency)
+	assert.Positive(t, report.Total.Requests)
+	assert.Zero(t, report.Total.Errors)
+	assert.Equal(t, report.Total.Requests, report.Operations[opShorten].Requests+report.Operations[opRedirect].Requests)
+	assert.Empty(t, report.Errors)
+}
+
+func TestBenchErrors(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// --retries не действует на bench: каждый 503 — отдельная ошибка в отчёте
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-s", srv.URL, "--retries", "3", "-o", "json", "bench", "-d", "50ms", "-c", "1", "--write-ratio", "1"},
+		func(string) (string, bool) { return "", false }, nil, &stdout, &stderr)
+	assert.Equal(t, exitFailure, code)
+
+	var report benchReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Positive(t, report.Errors["503"])
+	assert.Equal(t, report.Total.Requests, report.Total.Errors)
+	// Последний запрос мог прерваться окончанием теста и не попасть в отчёт
+	assert.InDelta(t, report.Total.Requests, hits.Load(), 1)
+}
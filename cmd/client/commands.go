@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"local/logger"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// shortenBatchSize — сколько URL из файла отправляется одним запросом.
+const shortenBatchSize = 100
+
+var commands = map[string]command{
+	"shorten": {
+		usage: "shorten <url>... | shorten --file urls.txt",
+		flags: func(fs *pflag.FlagSet) {
+			fs.StringP("file", "f", "", "Read URLs from a file, one per line (- for stdin)")
+		},
+		run: runShorten,
+	},
+	"expand": {usage: "expand <code>...", run: runExpand},
+	"stats":  {usage: "stats <code>", run: runStats},
+	"delete": {usage: "delete <code>...", run: runDelete},
+	"ping":   {usage: "ping", run: runPing},
+	"bench": {
+		usage: "bench [--duration 10s] [--concurrency 8] [--write-ratio 0.1] [--file urls.txt] [--results out.json]",
+		flags: benchFlags,
+		run:   runBench,
+		// Повтор после 429 или 503 попал бы в замер как медленный успех
+		noRetries: true,
+	},
+}
+
+func runShorten(a *app, fs *pflag.FlagSet) int {
+	urls := fs.Args()
+	if file, _ := fs.GetString("file"); file != "" {
+		fromFile, err := readURLs(file, a.stdin)
+		if err != nil {
+			fmt.Fprintln(a.stderr, err)
+			return exitFailure
+		}
+		urls = append(urls, fromFile...)
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(a.stderr, "shorten: no URLs given")
+		return exitUsage
+	}
+
+	t := &table{header: []string{"short_url", "orig_url"}}
+	code := exitOK
+	for batch := range slices.Chunk(urls, shortenBatchSize) {
+		result, err := a.client.ShortenBatch(context.Background(), batch)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "shorten: %v\n", err)
+			code = exitFailure
+			continue
+		}
+		for _, r := range result {
+			t.add(r.ShortURL, r.OrigURL)
+		}
+	}
+	return a.print(t, code)
+}
+
+// readURLs читает URL построчно, пропуская пустые строки и комментарии.
+func readURLs(name string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	return urls, nil
+}
+
+// codeOf принимает как код, так и полный короткий URL.
+func codeOf(arg string) string {
+	if u, err := url.Parse(arg); err == nil && u.Host != "" {
+		return path.Base(u.Path)
+	}
+	return strings.TrimPrefix(arg, "/")
+}
+
+func runExpand(a *app, fs *pflag.FlagSet) int {
+	args := fs.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(a.stderr, "expand: no codes given")
+		return exitUsage
+	}
+
+	t := &table{header: []string{"code", "orig_url"}}
+	code := exitOK
+	for _, arg := range args {
+		c := codeOf(arg)
+		long, err := a.client.Expand(context.Background(), c)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "expand %s: %v\n", c, err)
+			code = exitFailure
+			continue
+		}
+		t.add(c, long)
+	}
+	return a.print(t, code)
+}
+
+func runStats(a *app, fs *pflag.FlagSet) int {
+	args := fs.Args()
+	if len(args) != 1 {
+		fmt.Fprintln(a.stderr, "stats: exactly one code expected")
+		return exitUsage
+	}
+
+	link, err := a.client.Stats(context.Background(), codeOf(args[0]))
+	if err != nil {
+		fmt.Fprintf(a.stderr, "stats %s: %v\n", args[0], err)
+		return exitFailure
+	}
+
+	t := &table{header: []string{"short_url", "orig_url", "owner", "created_at", "expires_at", "disabled", "preview", "protected"}}
+	t.add(link.ShortURL, link.OrigURL, link.Owner, formatTime(link.CreatedAt), formatTime(link.ExpiresAt),
+		strconv.FormatBool(link.Disabled), strconv.FormatBool(link.Preview), strconv.FormatBool(link.Protected))
+	return a.print(t, exitOK)
+}
+
+func runDelete(a *app, fs *pflag.FlagSet) int {
+	args := fs.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(a.stderr, "delete: no codes given")
+		return exitUsage
+	}
+
+	t := &table{header: []string{"code", "result"}}
+	code := exitOK
+	for _, arg := range args {
+		c := codeOf(arg)
+		if err := a.client.Delete(context.Background(), c); err != nil {
+			t.add(c, err.Error())
+			code = exitFailure
+			continue
+		}
+		t.add(c, "deleted")
+	}
+	return a.print(t, code)
+}
+
+func runPing(a *app, fs *pflag.FlagSet) int {
+	args := fs.Args()
+	if len(args) != 0 {
+		fmt.Fprintln(a.stderr, "ping: no arguments expected")
+		return exitUsage
+	}
+
+	t := &table{header: []string{"server", "status"}}
+	code := exitOK
+	if err := a.client.Ping(context.Background()); err != nil {
+		t.add(a.client.BaseURL(), err.Error())
+		code = exitFailure
+	} else {
+		t.add(a.client.BaseURL(), "ok")
+	}
+	return a.print(t, code)
+}
+
+// formatTime печатает время в RFC 3339, а нулевое — пустой строкой.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// print выводит таблицу и возвращает code, либо exitFailure, если вывод не удался.
+func (a *app) print(t *table, code int) int {
+	if err := t.write(a.stdout, a.format); err != nil {
+		logger.Log.Errorw("failed to write output", "error", err)
+		fmt.Fprintln(a.stderr, err)
+		return exitFailure
+	}
+	return code
+}
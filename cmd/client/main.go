@@ -1,172 +1,181 @@
+// Команда client — консольный клиент сервиса сокращения ссылок для скриптов и CI.
+//
+//	client [flags] shorten <url>... | shorten --file urls.txt
+//	client [flags] expand <code>...
+//	client [flags] stats <code>
+//	client [flags] delete <code>...
+//	client [flags] ping
+//	client [flags] bench [--duration 10s] [--concurrency 8] [--write-ratio 0.1]
+//
+// Код выхода: 0 — успех, 1 — запрос не удался, 2 — ошибка в аргументах.
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"local/config"
-	"local/handlers/urlhandler"
+	"io"
 	"local/logger"
+	"local/pkg/client"
 	"os"
-	"strings"
+	"slices"
 	"time"
 
-	"github.com/go-resty/resty/v2"
+	"github.com/spf13/pflag"
 )
 
-// Клиент для HTTP-запросов
-type ClientReq struct {
-	request *resty.Client
-}
-
-// POST JSON (API)
-func (c *ClientReq) PostJSON(url string, json []byte) (string, int, error) {
-	response, err := c.request.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(json).
-		Post(url)
-
-	if err != nil {
-		logger.Log.Errorf("error: %s", err.Error())
-		return "", 0, err
-	}
+// Коды выхода.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
 
-	if response.StatusCode() != 200 && response.StatusCode() != 201 {
-		logger.Log.Errorf("Server returned error: %s, %v", response.Status(), response.String())
-		return "", response.StatusCode(), fmt.Errorf("server error: %s", response.String())
-	}
+// Переменные окружения со значениями флагов по умолчанию.
+const (
+	serverEnv = "SHORTENER_SERVER"
+	tokenEnv  = "ADMIN_TOKEN"
+)
 
-	return response.String(), response.StatusCode(), nil
+const defaultServer = "http://localhost:8080"
+
+// command — подкоманда клиента.
+type command struct {
+	usage string
+	// flags добавляет флаги подкоманды.
+	flags func(fs *pflag.FlagSet)
+	// run выполняет подкоманду; аргументы и флаги берутся из fs.
+	run func(a *app, fs *pflag.FlagSet) int
+	// noRetries отключает повторы независимо от --retries.
+	noRetries bool
 }
 
-// POST FormData (обычный POST-запрос)
-func (c *ClientReq) PostFormData(url, longURL string) (string, int, error) {
-	response, err := c.request.R().
-		SetHeader("Content-Type", "application/x-www-form-urlencoded").
-		SetFormData(map[string]string{"url": longURL}).
-		Post(url)
-
-	if err != nil {
-		logger.Log.Errorf("error: %s", err.Error())
-		return "", 0, err
-	}
-
-	if response.StatusCode() != 200 && response.StatusCode() != 201 {
-		logger.Log.Errorf("Server returned error: %s, %v", response.Status(), response.String())
-		return "", response.StatusCode(), fmt.Errorf("server error: %s", response.String())
-	}
-
-	return response.String(), response.StatusCode(), nil
+// app — общие для всех подкоманд настройки и потоки ввода-вывода.
+type app struct {
+	client *client.Client
+	format string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
 }
 
-// GET /ping – проверка сервера
-func (c *ClientReq) GetPing(url string) (string, int, error) {
-	response, err := c.request.R().Get(url)
-
-	if err != nil {
-		logger.Log.Errorf("Ping error: %s", err.Error())
-		return "", 0, err
-	}
-
-	return response.String(), response.StatusCode(), nil
+// globalFlags — флаги, общие для всех подкоманд.
+type globalFlags struct {
+	server  string
+	format  string
+	token   string
+	timeout time.Duration
+	retries int
+	verbose bool
 }
 
-// GET /{shortURL} – проверка редиректа
-func (c *ClientReq) GetShortURL(url string) (string, int, error) {
-	response, err := c.request.R().Get(url)
-
-	if err != nil {
-		logger.Log.Errorf("GET error: %s", err.Error())
-		return "", 0, err
+func (g *globalFlags) register(fs *pflag.FlagSet, lookupEnv func(string) (string, bool)) {
+	server := defaultServer
+	if v, ok := lookupEnv(serverEnv); ok && v != "" {
+		server = v
 	}
-
-	return response.String(), response.StatusCode(), nil
+	token, _ := lookupEnv(tokenEnv)
+
+	fs.StringVarP(&g.server, "server", "s", server, "Server URL (env "+serverEnv+")")
+	fs.StringVarP(&g.format, "output", "o", formatText, "Output format: text, json or csv")
+	fs.StringVar(&g.token, "token", token, "Bearer token for the admin API (env "+tokenEnv+")")
+	fs.DurationVar(&g.timeout, "timeout", 5*time.Second, "Request timeout")
+	fs.IntVar(&g.retries, "retries", 3, "Retries on network errors and 429/502/503/504 responses (bench never retries)")
+	fs.BoolVarP(&g.verbose, "verbose", "v", false, "Log requests to stderr")
 }
 
-// Чтение длинного URL с консоли
-func readLongURL() (string, error) {
-	fmt.Println("Введите длинный URL:")
-	reader := bufio.NewReader(os.Stdin)
-	long, err := reader.ReadString('\n')
-	long = strings.TrimSpace(long)
-	if err != nil {
-		return "", err
-	}
-	return long, nil
+func main() {
+	os.Exit(run(os.Args[1:], os.LookupEnv, os.Stdin, os.Stdout, os.Stderr))
 }
 
-func main() {
-	// Инициализация конфигурации и логгера
-	cfg := config.InitConfig()
-	logger.InitLogger(cfg.LogLevel)
-	defer logger.CloseLogger()
-
-	logger.Log.Info("Starting client")
-
-	// Чтение количества объектов
-	fmt.Print("Введите количество объектов для отправки: ")
-	var n int
-	fmt.Scan(&n)
-
-	// Слайс для хранения всех запросов
-	rs := make([]urlhandler.URLRequest, 0, n)
-	reader := bufio.NewReader(os.Stdin)
-    reader.ReadString('\n') // Читаем \n после ввода числа
-
-	// Чтение длинных URL-ов
-	for i := 0; i < n; i++ {
-		longURL, err := reader.ReadString('\n')
-		if err != nil {
-			logger.Log.Fatalf("error: %s", err.Error())
+// run выполняет клиент с аргументами args и возвращает код выхода.
+func run(args []string, lookupEnv func(string) (string, bool), stdin io.Reader, stdout, stderr io.Writer) int {
+	var g globalFlags
+	fs := pflag.NewFlagSet("client", pflag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.SetInterspersed(false)
+	g.register(fs, lookupEnv)
+	fs.Usage = func() { printUsage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return exitOK
 		}
-		r := urlhandler.NewURLRequest(longURL)
-		rs = append(rs, *r) // Добавляем новый URLRequest в слайс
+		return exitUsage
 	}
-
-	// Создание HTTP клиента
-	client := resty.New()
-	client.SetTimeout(500 * time.Millisecond)
-	postClient := &ClientReq{request: client}
-
-	var response string
-	var statusCode int
-
-	// Тестируем все возможные пути
-	fmt.Println("\n=== ТЕСТИРУЕМ СЕРВЕР ===")
-
-	// 1. Проверяем, работает ли сервер (GET /ping)
-	fmt.Println("\n🔹 Тест: GET /ping")
-	response, statusCode, err := postClient.GetPing(cfg.BaseURL + "/Ph-VaNhL")
-	if err == nil {
-		fmt.Printf("✅ Сервер доступен! Ответ: %s (Код: %d)\n", response, statusCode)
-	} else {
-		fmt.Printf("❌ Ошибка ping: %v\n", err)
+	if fs.NArg() == 0 {
+		printUsage(stderr, fs)
+		return exitUsage
 	}
 
-	// 2. Тестируем создание короткого URL через JSON (POST /api/shorten)
-	fmt.Println("\n🔹 Тест: POST /api/shorten (JSON)")
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		printUsage(stderr, fs)
+		return exitUsage
+	}
 
-	data, err := json.Marshal(rs)
-	if err != nil {
-		logger.Log.Fatalf("error: %s", err.Error())
+	// Общие флаги можно указывать и после подкоманды
+	cmdFlags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	cmdFlags.SetOutput(stderr)
+	cmdFlags.AddFlagSet(fs)
+	if cmd.flags != nil {
+		cmd.flags(cmdFlags)
 	}
-	response, statusCode, err = postClient.PostJSON(cfg.BaseURL+"/api/shorten", data)
-	if err == nil {
-		fmt.Printf("✅ Короткие URL созданы: %s (Код: %d)\n", response, statusCode)
-	} else {
-		fmt.Printf("❌ Ошибка создания JSON URL: %v\n", err)
+	cmdFlags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: client %s\n\nFlags:\n%s", cmd.usage, cmdFlags.FlagUsages())
+	}
+	if err := cmdFlags.Parse(fs.Args()[1:]); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if !slices.Contains([]string{formatText, formatJSON, formatCSV}, g.format) {
+		fmt.Fprintf(stderr, "unknown output format %q\n", g.format)
+		return exitUsage
 	}
 
-	// 3. Тестируем создание короткого URL через FormData (POST /)
-	fmt.Println("\n🔹 Тест: POST / (FormData)")
-	for _, r := range rs {
-		response, statusCode, err = postClient.PostFormData(cfg.BaseURL+"/", r.OrigURL)
-		if err == nil {
-			fmt.Printf("✅ Короткий URL создан: %s (Код: %d)\n", response, statusCode)
-		} else {
-			fmt.Printf("❌ Ошибка создания FormData URL: %v\n", err)
+	if g.verbose {
+		if err := logger.InitLogger(logger.Options{Level: "debug", Format: "console", Outputs: []string{"stderr"}}); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
 		}
+		defer logger.CloseLogger()
+	}
+
+	retries := g.retries
+	if retries == 0 || cmd.noRetries {
+		retries = -1 // в client.Options 0 означает значение по умолчанию
 	}
+	c := client.New(g.server, client.Options{
+		Token:   g.token,
+		Timeout: g.timeout,
+		Retries: retries,
+	})
+	c.OnResponse(func(method, url string, status int, duration time.Duration) {
+		logger.Log.Debugw("response", "method", method, "url", url, "status", status, "duration", duration)
+	})
+
+	a := &app{
+		client: c,
+		format: g.format,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	return cmd.run(a, cmdFlags)
+}
 
-	fmt.Println("\n✅ Все тесты завершены!")
+func printUsage(w io.Writer, fs *pflag.FlagSet) {
+	fmt.Fprintln(w, "Usage: client [flags] <command> [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(w, "\nFlags:\n%s", fs.FlagUsages())
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"local/handlers/urlhandler"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeServer имитирует API сервиса: знает одну ссылку abc и токен secret.
+func newFakeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		var rs []urlhandler.URLRequest
+		if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+			http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+			return
+		}
+		for i := range rs {
+			if rs[i].OrigURL == "bad" {
+				http.Error(w, "Invalid URL", http.StatusBadRequest)
+				return
+			}
+			rs[i].ShortURL = "c-" + strings.TrimPrefix(rs[i].OrigURL, "https://")
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rs)
+	})
+	mux.HandleFunc("GET /ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("GET /{code}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("code") != "abc" {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Location", "https://example.com")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if r.PathValue("code") != "abc" {
+				http.Error(w, "URL not found", http.StatusNotFound)
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("GET /admin/links/{code}", admin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"short_url":"abc","orig_url":"https://example.com","created_at":"2025-01-02T03:04:05Z","disabled":false,"protected":true}`))
+	}))
+	mux.HandleFunc("DELETE /admin/links/{code}", admin(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRun(t *testing.T) {
+	srv := newFakeServer(t)
+	urlsFile := filepath.Join(t.TempDir(), "urls.txt")
+	require.NoError(t, os.WriteFile(urlsFile, []byte("# links\nhttps://a.example\n\nhttps://b.example\n"), 0o666))
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{
+			name:   "shorten",
+			args:   []string{"shorten", "https://a.example"},
+			stdout: srv.URL + "/c-a.example  https://a.example\n",
+		},
+		{
+			name:   "shorten from file as csv",
+			args:   []string{"-o", "csv", "shorten", "--file", urlsFile},
+			stdout: "short_url,orig_url\n" + srv.URL + "/c-a.example,https://a.example\n" + srv.URL + "/c-b.example,https://b.example\n",
+		},
+		{
+			name:   "shorten from stdin with flags after the command",
+			args:   []string{"shorten", "-f", "-", "-o", "json"},
+			stdin:  "https://a.example\n",
+			stdout: "[\n  {\n    \"orig_url\": \"https://a.example\",\n    \"short_url\": \"" + srv.URL + "/c-a.example\"\n  }\n]\n",
+		},
+		{name: "shorten rejected", args: []string{"shorten", "bad"}, code: exitFailure},
+		{name: "shorten without urls", args: []string{"shorten"}, code: exitUsage},
+		{name: "expand", args: []string{"expand", "abc"}, stdout: "abc  https://example.com\n"},
+		{name: "expand full url", args: []string{"expand", srv.URL + "/abc"}, stdout: "abc  https://example.com\n"},
+		{name: "expand unknown", args: []string{"expand", "abc", "zzz"}, code: exitFailure, stdout: "abc  https://example.com\n"},
+		{name: "stats", args: []string{"--token", "secret", "stats", "abc"}, stdout: "abc  https://example.com    2025-01-02T03:04:05Z    false  false  true\n"},
+		{name: "stats without token", args: []string{"stats", "abc"}, code: exitFailure},
+		{name: "delete", args: []string{"--token", "secret", "delete", "abc", "zzz"}, code: exitFailure, stdout: "abc  deleted\nzzz  server returned 404: URL not found\n"},
+		{name: "ping", args: []string{"ping"}, stdout: srv.URL + "  ok\n"},
+		{name: "unknown command", args: []string{"frobnicate"}, code: exitUsage},
+		{name: "unknown format", args: []string{"-o", "xml", "ping"}, code: exitUsage},
+		{name: "no command", code: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := func(key string) (string, bool) {
+				if key == serverEnv {
+					return srv.URL, true
+				}
+				return "", false
+			}
+			var stdout, stderr bytes.Buffer
+			code := run(tt.args, env, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+			assert.Equal(t, tt.code, code, stderr.String())
+			if tt.stdout != "" {
+				assert.Equal(t, tt.stdout, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunServerUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--server", srv.URL, "--retries", "0", "ping"}, func(string) (string, bool) { return "", false }, nil, &stdout, &stderr)
+	assert.Equal(t, exitFailure, code)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Форматы вывода.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// table — результат команды: заголовок и строки с тем же числом колонок.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func (t *table) add(row ...string) {
+	t.rows = append(t.rows, row)
+}
+
+// write печатает таблицу в выбранном формате. Текстовый формат выводит
+// только данные, без заголовка, чтобы результат было удобно разбирать в shell.
+func (t *table) write(w io.Writer, format string) error {
+	switch format {
+	case formatText:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case formatJSON:
+		objects := make([]map[string]string, 0, len(t.rows))
+		for _, row := range t.rows {
+			obj := make(map[string]string, len(t.header))
+			for i, name := range t.header {
+				obj[name] = row[i]
+			}
+			objects = append(objects, obj)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objects)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(t.header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(t.rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"local/internal/storage"
+	"local/internal/storage/dump"
+	"local/internal/storage/file"
+	"local/internal/storage/memory"
+	"local/internal/storage/postgres"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// openBackend открывает хранилище по описанию:
+//
+//	file:PATH         файловое хранилище
+//	postgres://...    PostgreSQL (или postgresql://...)
+//	dump:PATH         выгрузка `server export`, загруженная в память
+//	memory            пустое хранилище в памяти, для пробного прогона
+func openBackend(ctx context.Context, spec string, pgOpts postgres.Options) (storage.Storage, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("%q: file path is empty", spec)
+		}
+		return file.NewFileStorage(arg)
+	case "postgres", "postgresql":
+		return postgres.NewPostgresStorage(spec, pgOpts)
+	case "dump":
+		return openDump(ctx, arg)
+	case "memory":
+		return memory.NewMemoryStorage()
+	case "sqlite", "sqlite3":
+		return nil, fmt.Errorf("%q: there is no sqlite backend; export the data to a dump and use dump:PATH", spec)
+	}
+	return nil, fmt.Errorf("unknown backend %q (want file:PATH, postgres://..., dump:PATH or memory)", spec)
+}
+
+// openDump загружает выгрузку в память. Формат определяется по расширению.
+func openDump(ctx context.Context, path string) (storage.Storage, error) {
+	format := dump.JSONL
+	if filepath.Ext(path) == ".csv" {
+		format = dump.CSV
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := memory.NewMemoryStorage()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dump.Import(ctx, s, f, format, dump.Overwrite); err != nil {
+		return nil, fmt.Errorf("load %s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"local/internal/storage"
+	"local/internal/storage/file"
+	"local/internal/storage/memory"
+	"local/internal/storage/postgres"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFileStorage создаёт файловое хранилище с n ссылками.
+func newFileStorage(t *testing.T, n int) string {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	s, err := file.NewFileStorage(path)
+	require.NoError(t, err)
+	for i := range n {
+		short := fmt.Sprintf("code%03d", i)
+		require.NoError(t, s.SaveRecord(context.Background(), storage.Record{
+			ShortURL:  short,
+			OrigURL:   "https://example.com/" + short,
+			Owner:     "user-1",
+			CreatedAt: time.Date(2024, 5, 1, 12, 0, i, 123456789, time.UTC),
+		}))
+	}
+	require.NoError(t, s.Close())
+	return path
+}
+
+func TestRun(t *testing.T) {
+	src := newFileStorage(t, 25)
+	dst := filepath.Join(t.TempDir(), "dst.json")
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{
+		"--from", "file:" + src, "--to", "file:" + dst,
+		"--batch-size", "10", "--checkpoint", checkpoint, "--progress-interval", "0",
+	}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stdout.String(), "copied 25 links")
+	assert.Contains(t, stdout.String(), "verified 25 links")
+	assert.Contains(t, stderr.String(), "copied 20 links in 2 batches")
+	assert.NoFileExists(t, checkpoint, "a finished run removes the checkpoint")
+
+	s, err := file.NewFileStorage(dst)
+	require.NoError(t, err)
+	defer s.Close()
+	rec, err := s.GetRecord(context.Background(), "code007")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", rec.Owner)
+}
+
+func TestRunDuplicateLongURLs(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "urls.json")
+	s, err := file.NewFileStorage(src)
+	require.NoError(t, err)
+	// Старые данные: несколько ссылок без владельца на один URL
+	for _, short := range []string{"abc", "def", "ghi"} {
+		require.NoError(t, s.PutRecord(ctx, storage.Record{ShortURL: short, OrigURL: "https://example.com"}))
+	}
+	require.NoError(t, s.Close())
+
+	targets := []string{"file:" + filepath.Join(t.TempDir(), "dst.json")}
+	// В новой базе postgres уникальный индекс по URL уже создан
+	if dsn := os.Getenv("TEST_DATABASE_DSN"); dsn != "" {
+		pg, err := postgres.NewPostgresStorage(dsn, postgres.Options{})
+		require.NoError(t, err)
+		require.NoError(t, pg.Close())
+		conn, err := pgx.Connect(ctx, dsn)
+		require.NoError(t, err)
+		_, err = conn.Exec(ctx, `TRUNCATE short_urls, short_url_history`)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close(ctx))
+		targets = append(targets, dsn)
+	}
+
+	for _, to := range targets {
+		var stdout, stderr bytes.Buffer
+		code := run(ctx, []string{"--from", "file:" + src, "--to", to, "--checkpoint", filepath.Join(t.TempDir(), "checkpoint")}, &stdout, &stderr)
+		require.Equal(t, exitOK, code, stderr.String())
+		assert.Contains(t, stdout.String(), "verified 3 links")
+	}
+}
+
+func TestRunVerificationFails(t *testing.T) {
+	src := newFileStorage(t, 3)
+	dst := newFileStorage(t, 5)
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--from", "file:" + src, "--to", "file:" + dst}, &stdout, &stderr)
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr.String(), "source has 3 links")
+	assert.Contains(t, stderr.String(), "destination 5")
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+		err  string
+	}{
+		{name: "no backends", args: nil, code: exitUsage},
+		{name: "bad batch size", args: []string{"--from", "memory", "--to", "memory", "--batch-size", "0"}, code: exitUsage},
+		{name: "unknown backend", args: []string{"--from", "redis://x", "--to", "memory"}, code: exitFailure, err: "unknown backend"},
+		{name: "sqlite", args: []string{"--from", "sqlite:urls.db", "--to", "memory"}, code: exitFailure, err: "there is no sqlite backend"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			assert.Equal(t, tt.code, run(context.Background(), tt.args, &bytes.Buffer{}, &stderr))
+			assert.Contains(t, stderr.String(), tt.err)
+		})
+	}
+}
+
+func TestRunFromDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.csv")
+	require.NoError(t, os.WriteFile(path, []byte("short_url,orig_url\nabc,https://example.com\n"), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"--from", "dump:" + path, "--to", "memory"}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stdout.String(), "verified 1 links")
+}
+
+// failingStorage отказывает после limit записанных ссылок.
+type failingStorage struct {
+	*memory.Storage
+	limit int
+}
+
+func (s *failingStorage) PutRecord(ctx context.Context, rec storage.Record) error {
+	if s.limit == 0 {
+		return errors.New("connection reset")
+	}
+	s.limit--
+	return s.Storage.PutRecord(ctx, rec)
+}
+
+func TestMigratorResume(t *testing.T) {
+	ctx := context.Background()
+	src, err := file.NewFileStorage(newFileStorage(t, 25))
+	require.NoError(t, err)
+	defer src.Close()
+	mem, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+	dst := &failingStorage{Storage: mem, limit: 15}
+	m := &migrator{src: src, dst: dst, batchSize: 10, checkpoint: checkpoint}
+	p, err := m.run(ctx, "")
+	assert.ErrorContains(t, err, "connection reset")
+	assert.Equal(t, 10, p.Copied)
+
+	// Продолжаем с последней целиком записанной пачки
+	after, err := m.loadCheckpoint()
+	require.NoError(t, err)
+	assert.Equal(t, "code009", after)
+
+	dst.limit = -1
+	p, err = m.run(ctx, after)
+	require.NoError(t, err)
+	assert.Equal(t, 15, p.Copied)
+
+	want, err := checksum(ctx, src)
+	require.NoError(t, err)
+	got, err := checksum(ctx, mem)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, 25, got.Count)
+}
+
+func TestMigratorCopiesHistory(t *testing.T) {
+	ctx := context.Background()
+	src, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	require.NoError(t, src.PutRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: "https://example.com"}))
+	_, err = src.Update(ctx, "abc", "admin", func(rec *storage.Record) error {
+		rec.OrigURL = "https://example.org"
+		return nil
+	})
+	require.NoError(t, err)
+	dst, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+
+	m := &migrator{src: src, dst: dst, batchSize: 10}
+	_, err = m.run(ctx, "")
+	require.NoError(t, err)
+
+	long, err := dst.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", long)
+	want, err := src.History(ctx, "abc")
+	require.NoError(t, err)
+	history, err := dst.History(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, want, history)
+
+	// Сверка замечает расхождение в истории
+	wantSum, err := checksum(ctx, src)
+	require.NoError(t, err)
+	gotSum, err := checksum(ctx, dst)
+	require.NoError(t, err)
+	assert.Equal(t, wantSum, gotSum)
+	require.NoError(t, dst.PutHistory(ctx, "abc", nil))
+	gotSum, err = checksum(ctx, dst)
+	require.NoError(t, err)
+	assert.NotEqual(t, wantSum, gotSum)
+}
+
+func TestChecksum(t *testing.T) {
+	ctx := context.Background()
+	rec := storage.Record{ShortURL: "abc", OrigURL: "https://example.com", CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)}
+
+	a, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	require.NoError(t, a.PutRecord(ctx, rec))
+
+	// Наносекунды и часовой пояс не влияют на сумму
+	b, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	rec.CreatedAt = rec.CreatedAt.Truncate(time.Microsecond).In(time.FixedZone("MSK", 3*3600))
+	require.NoError(t, b.PutRecord(ctx, rec))
+
+	sa, err := checksum(ctx, a)
+	require.NoError(t, err)
+	sb, err := checksum(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, sa, sb)
+
+	rec.Owner = "user-1"
+	require.NoError(t, b.PutRecord(ctx, rec))
+	sb, err = checksum(ctx, b)
+	require.NoError(t, err)
+	assert.NotEqual(t, sa.Checksum, sb.Checksum)
+}
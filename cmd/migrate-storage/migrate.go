@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"local/internal/storage"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// progress — состояние переноса после очередной пачки.
+type progress struct {
+	Copied  int
+	Batches int
+	Last    string
+	Elapsed time.Duration
+}
+
+// migrator переносит ссылки из src в dst пачками по batchSize. После каждой
+// записанной пачки последний короткий URL сохраняется в checkpoint, чтобы
+// прерванный перенос можно было продолжить с этого места.
+type migrator struct {
+	src, dst   storage.Storage
+	batchSize  int
+	checkpoint string
+	report     func(progress)
+}
+
+// run переносит ссылки, идущие после after, и возвращает итог.
+func (m *migrator) run(ctx context.Context, after string) (progress, error) {
+	start := time.Now()
+	p := progress{Last: after}
+	batch := make([]storage.Record, 0, m.batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := m.put(ctx, batch); err != nil {
+			return fmt.Errorf("write batch after %q: %w", p.Last, err)
+		}
+		p.Copied += len(batch)
+		p.Batches++
+		p.Last = batch[len(batch)-1].ShortURL
+		p.Elapsed = time.Since(start)
+		batch = batch[:0]
+		if err := m.saveCheckpoint(p.Last); err != nil {
+			return err
+		}
+		if m.report != nil {
+			m.report(p)
+		}
+		return nil
+	}
+
+	err := m.src.Iterate(ctx, after, func(rec storage.Record) error {
+		batch = append(batch, rec)
+		if len(batch) < m.batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	return p, err
+}
+
+// put записывает пачку одним вызовом, если хранилище это умеет, а затем
+// историю её ссылок.
+func (m *migrator) put(ctx context.Context, batch []storage.Record) error {
+	if bp, ok := m.dst.(storage.BatchPutter); ok {
+		if err := bp.PutRecords(ctx, batch); err != nil {
+			return err
+		}
+	} else {
+		for _, rec := range batch {
+			if err := m.dst.PutRecord(ctx, rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, rec := range batch {
+		history, err := m.src.History(ctx, rec.ShortURL)
+		if err != nil {
+			return fmt.Errorf("read history of %q: %w", rec.ShortURL, err)
+		}
+		if len(history) == 0 {
+			continue
+		}
+		if err := m.dst.PutHistory(ctx, rec.ShortURL, history); err != nil {
+			return fmt.Errorf("write history of %q: %w", rec.ShortURL, err)
+		}
+	}
+	return nil
+}
+
+// loadCheckpoint возвращает сохранённый короткий URL или пустую строку,
+// если переноса ещё не было.
+func (m *migrator) loadCheckpoint() (string, error) {
+	if m.checkpoint == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(m.checkpoint)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// saveCheckpoint атомарно перезаписывает файл с позицией.
+func (m *migrator) saveCheckpoint(last string) error {
+	if m.checkpoint == "" {
+		return nil
+	}
+	tmp := m.checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, []byte(last+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.checkpoint)
+}
+
+// clearCheckpoint удаляет позицию после успешного переноса.
+func (m *migrator) clearCheckpoint() error {
+	if m.checkpoint == "" {
+		return nil
+	}
+	if err := os.Remove(m.checkpoint); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// summary — количество ссылок и контрольная сумма содержимого хранилища.
+type summary struct {
+	Count    int
+	Checksum string
+}
+
+// checksum считает sha256 по всем ссылкам и их истории в порядке короткого
+// URL. Время округляется до микросекунд — с такой точностью его хранит
+// PostgreSQL.
+func checksum(ctx context.Context, s storage.Storage) (summary, error) {
+	h := sha256.New()
+	var n int
+	var line bytes.Buffer
+	err := s.Iterate(ctx, "", func(rec storage.Record) error {
+		history, err := s.History(ctx, rec.ShortURL)
+		if err != nil {
+			return fmt.Errorf("history of %q: %w", rec.ShortURL, err)
+		}
+		n++
+		line.Reset()
+		fields := []string{rec.ShortURL, rec.OrigURL, rec.Owner, canonicalTime(rec.CreatedAt), canonicalTime(rec.ExpiresAt), strconv.FormatBool(rec.Disabled), strconv.FormatBool(rec.Preview), rec.PasswordHash}
+		for _, entry := range history {
+			fields = append(fields, entry.OrigURL, entry.Actor, canonicalTime(entry.ChangedAt))
+		}
+		for _, field := range fields {
+			// Длина перед значением исключает неоднозначность склейки полей
+			fmt.Fprintf(&line, "%d:%s", len(field), field)
+		}
+		line.WriteByte('\n')
+		_, err = h.Write(line.Bytes())
+		return err
+	})
+	if err != nil {
+		return summary{}, err
+	}
+	return summary{Count: n, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func canonicalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"local/config"
+	"local/internal/storage"
+	"local/internal/storage/dump"
+	"local/internal/storage/factory"
+	"local/logger"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/pflag"
+)
+
+// isDumpCommand сообщает, что сервер запущен как `export` или `import`.
+func isDumpCommand(args []string) bool {
+	return len(args) > 0 && (args[0] == "export" || args[0] == "import")
+}
+
+// runDumpCommand выполняет `server export` или `server import` с
+// конфигурацией сервера: хранилище выбирается теми же флагами и переменными
+// окружения. args начинаются с имени команды.
+//
+//	server export [--format jsonl|csv] [-o file]
+//	server import [--format jsonl|csv] [--on-conflict skip|overwrite|fail] [file]
+//
+// Без файла используются stdout и stdin. Формат по умолчанию определяется по
+// расширению файла, иначе jsonl.
+func runDumpCommand(args []string, lookupEnv func(string) (string, bool), stdin io.Reader, stdout, stderr io.Writer) error {
+	command := args[0]
+	var format, output, onConflict string
+	cfg, rest, err := config.LoadArgs(command, args[1:], lookupEnv, func(fs *pflag.FlagSet) {
+		fs.StringVar(&format, "format", "", "Dump format: jsonl or csv (default: by file extension, else jsonl)")
+		if command == "export" {
+			fs.StringVarP(&output, "output", "o", "", "File to write the dump to (default: stdout)")
+		} else {
+			fs.StringVar(&onConflict, "on-conflict", string(dump.Fail), "What to do with taken short URLs: skip, overwrite or fail")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	path := output
+	switch {
+	case command == "import" && len(rest) == 1:
+		path = rest[0]
+	case len(rest) > 0:
+		return fmt.Errorf("unexpected arguments: %v", rest)
+	}
+	if path == "-" {
+		path = ""
+	}
+	if format == "" {
+		format = string(dump.JSONL)
+		if filepath.Ext(path) == ".csv" {
+			format = string(dump.CSV)
+		}
+	}
+	f, err := dump.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	// stdout может быть занят выгрузкой, поэтому логи уходят в stderr
+	opts := cfg.LoggerOptions()
+	opts.Outputs = slices.Clone(opts.Outputs)
+	for i, out := range opts.Outputs {
+		if out == "stdout" {
+			opts.Outputs[i] = "stderr"
+		}
+	}
+	if err := logger.InitLogger(opts); err != nil {
+		return err
+	}
+	defer logger.CloseLogger()
+
+	// Кэш здесь не нужен: каждая ссылка читается или пишется один раз
+	store, err := factory.NewStorage(*cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if command == "export" {
+		if path == "" {
+			return export(ctx, store, stdout, f, stderr)
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := export(ctx, store, file, f, stderr); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+
+	policy, err := dump.ParsePolicy(onConflict)
+	if err != nil {
+		return err
+	}
+	r := stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	stats, err := dump.Import(ctx, store, r, f, policy)
+	fmt.Fprintf(stderr, "imported %d links, skipped %d\n", stats.Imported, stats.Skipped)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	return nil
+}
+
+func export(ctx context.Context, store storage.Storage, w io.Writer, f dump.Format, stderr io.Writer) error {
+	n, err := dump.Export(ctx, store, w, f)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	fmt.Fprintf(stderr, "exported %d links\n", n)
+	return nil
+}
+
+// exitDumpCommand завершает процесс по результату runDumpCommand.
+func exitDumpCommand(err error) {
+	if err == nil || errors.Is(err, pflag.ErrHelp) {
+		os.Exit(0)
+	}
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
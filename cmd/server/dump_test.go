@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"local/internal/storage/file"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsDumpCommand(t *testing.T) {
+	assert.True(t, isDumpCommand([]string{"export", "-o", "dump.csv"}))
+	assert.True(t, isDumpCommand([]string{"import"}))
+	assert.False(t, isDumpCommand([]string{"-p", "9000"}))
+	assert.False(t, isDumpCommand(nil))
+}
+
+// Перенос ссылок между двумя файловыми хранилищами через CSV-файл.
+func TestDumpCommands(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.json")
+	dst := filepath.Join(dir, "dst.json")
+	dumpPath := filepath.Join(dir, "links.csv")
+	noEnv := func(string) (string, bool) { return "", false }
+
+	s, err := file.NewFileStorage(src)
+	require.NoError(t, err)
+	require.NoError(t, s.Save(context.Background(), "abc", "https://example.com"))
+	require.NoError(t, s.Save(context.Background(), "def", "https://example.org"))
+	require.NoError(t, s.Close())
+
+	var stdout, stderr bytes.Buffer
+	err = runDumpCommand([]string{"export", "--database-dsn=", "-f", src, "-o", dumpPath}, noEnv, nil, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Empty(t, stdout.String())
+	assert.Contains(t, stderr.String(), "exported 2 links")
+	data, err := os.ReadFile(dumpPath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "short_url,orig_url,"), "format is taken from the extension")
+
+	stderr.Reset()
+	err = runDumpCommand([]string{"import", "--database-dsn=", "-f", dst, dumpPath}, noEnv, nil, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Contains(t, stderr.String(), "imported 2 links, skipped 0")
+
+	// С политикой fail по умолчанию занятый короткий URL прерывает загрузку
+	stdin := strings.NewReader(`{"short_url":"abc","orig_url":"https://other.example"}` + "\n")
+	err = runDumpCommand([]string{"import", "--database-dsn=", "-f", dst}, noEnv, stdin, &stdout, &stderr)
+	assert.ErrorContains(t, err, "record 1 (abc)")
+
+	d, err := file.NewFileStorage(dst)
+	require.NoError(t, err)
+	defer d.Close()
+	long, err := d.Get(context.Background(), "def")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", long)
+}
+
+func TestDumpCommandsInvalid(t *testing.T) {
+	noEnv := func(string) (string, bool) { return "", false }
+	storagePath := filepath.Join(t.TempDir(), "urls.json")
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unknown format", args: []string{"export", "--format", "xml"}},
+		{name: "unknown policy", args: []string{"import", "--on-conflict", "merge"}},
+		{name: "import flag on export", args: []string{"export", "--on-conflict", "skip"}},
+		{name: "extra arguments", args: []string{"import", "a.jsonl", "b.jsonl"}},
+		{name: "missing file", args: []string{"import", filepath.Join(t.TempDir(), "missing.jsonl")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tt.args, "--database-dsn=", "-f", storagePath)
+			err := runDumpCommand(args, noEnv, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -1,75 +1,235 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"local/compression/zstd"
 	"local/config"
+	"local/handlers/adminhandler"
+	"local/handlers/authhandler"
 	"local/handlers/loghandler"
+	"local/handlers/pinghandler"
+	"local/handlers/qrhandler"
 	"local/handlers/urlhandler"
 	"local/internal/storage"
+	"local/internal/storage/cache"
+	"local/internal/storage/factory"
 	"local/logger"
+	"local/metrics"
+	"local/tracing"
 	"local/utils"
 	"net/http"
+	"os"
 	"time"
+
+	"github.com/spf13/pflag"
 )
 
+// configWatchInterval — как часто проверять изменения файла конфигурации.
+const configWatchInterval = 5 * time.Second
+
 // initApp выполняет все необходимые иниты и возвращает готовые зависимости.
-func initApp() (*config.Config, *urlhandler.URLHandler, error) {
+func initApp() (*config.Config, storage.Storage, error) {
 	// Загружаем конфиг
-	cfg := config.InitConfig()
+	cfg, err := config.InitConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
 
 	// Инициализируем логгер
-	logger.InitLogger(cfg.LogLevel)
+	if err := logger.InitLogger(cfg.LoggerOptions()); err != nil {
+		return nil, nil, err
+	}
 
 	// Инициализируем хранилище
-	store, err := storage.NewStorage(*cfg)
+	store, err := openStorage(cfg)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Создаем генератор коротких URL
-	genUrl := utils.NewGeneratorShortURL(cfg.URLLength)
+	return cfg, store, nil
+}
 
-	// Создаем обработчик URL
-	urlHandler := urlhandler.NewURLHandler(store, genUrl)
+// openStorage открывает хранилище из конфигурации и кэширует чтения перед ним.
+func openStorage(cfg *config.Config) (storage.Storage, error) {
+	store, err := factory.NewStorage(*cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	return cfg, urlHandler, nil
+	if cfg.CacheSize > 0 {
+		store = cache.New(store, cache.Options{
+			Size:        cfg.CacheSize,
+			TTL:         cfg.CacheTTL,
+			NegativeTTL: cfg.CacheNegativeTTL,
+		})
+	}
+	return store, nil
 }
 
 func main() {
-	cfg, urlHandler, err := initApp()
+	if isDumpCommand(os.Args[1:]) {
+		exitDumpCommand(runDumpCommand(os.Args[1:], os.LookupEnv, os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	cfg, store, err := initApp()
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		logger.Log.Fatalf("failed to initialize application: %v", err)
+		// Логгер может быть ещё не инициализирован, поэтому пишем в stderr
+		fmt.Fprintf(os.Stderr, "failed to initialize application: %v\n", err)
+		os.Exit(1)
 	}
 	defer logger.CloseLogger()
+	defer store.Close()
+
+	// Перечитываем часть конфига по SIGHUP и при изменении файла
+	reloader := config.NewReloader(cfg, config.InitConfig)
+	reloader.Subscribe(func(old, new *config.Config) {
+		if old.LogLevel != new.LogLevel {
+			if _, err := logger.SetLevel(new.LogLevel); err != nil {
+				logger.Log.Errorw("failed to apply reloaded log level", "error", err)
+			}
+		}
+	})
+	go reloader.Watch(context.Background(), configWatchInterval)
+
+	// Экспорт трассировки
+	if cfg.TraceFile != "" {
+		exporter, err := tracing.NewFileExporter(cfg.TraceFile)
+		if err != nil {
+			logger.Log.Fatalf("failed to open trace file: %v", err)
+		}
+		tracing.SetExporter(exporter)
+		defer func() {
+			tracing.SetExporter(nil)
+			exporter.Close()
+		}()
+	}
+
+	// Запускаем сервер
+	if err := runServer(cfg, newRouter(reloader, store)); err != nil {
+		logger.Log.Fatalf("failed to start server: %v", err)
+	}
+}
+
+// newRouter создаёт HTTP multiplexer и регистрирует хендлеры со всей цепочкой
+// middleware. Обработчики, которым нужны перечитываемые опции, берут их из
+// live при каждом запросе, остальные — из конфигурации на момент запуска.
+func newRouter(live *config.Reloader, store storage.Storage) http.Handler {
+	cfg := live.Current()
+
+	// Создаем генератор коротких URL и обработчик URL
+	genUrl := utils.NewGeneratorShortURL(cfg.URLLength)
+	urlHandler := urlhandler.NewURLHandler(store, genUrl)
+
+	// Владельцев ссылок опознаём по подписанной cookie. Редиректы cookie не
+	// ставят: они нужны только тем, кто создаёт и меняет ссылки.
+	secret := []byte(cfg.CookieSecret)
+	if len(secret) == 0 {
+		logger.Log.Warn("cookie secret is not set: owners lose access to their links after a restart")
+		secret = authhandler.NewSecret()
+	}
+	user := func(h http.Handler) http.Handler {
+		return authhandler.WithUser(secret, h)
+	}
+
+	withMiddleware := newMiddleware(cfg)
 
-	// Создаем HTTP multiplexer и регистрируем хендлеры
 	mux := http.NewServeMux()
-	compressedHandler := loghandler.WithLog(
+	mux.Handle("/", withMiddleware(
 		zstd.Decompression(
 			zstd.Compression(
 				http.HandlerFunc(urlHandler.HandURL),
 			),
 		),
-	)
-	mux.Handle("/", compressedHandler)
+	))
+
+	mux.Handle("POST /{$}", withMiddleware(user(
+		zstd.Decompression(
+			zstd.Compression(
+				http.HandlerFunc(urlHandler.HandlePost),
+			),
+		),
+	)))
 
-	mux.Handle("/api/shorten", loghandler.WithLog(
+	mux.Handle("/api/shorten", withMiddleware(user(
 		zstd.Decompression(
 			zstd.Compression(
 				http.HandlerFunc(urlHandler.HandlePost),
 			),
 		),
+	)))
+
+	mux.Handle("PATCH /api/urls/{id}", withMiddleware(user(
+		zstd.Decompression(
+			zstd.Compression(
+				http.HandlerFunc(urlHandler.HandleUpdate),
+			),
+		),
+	)))
+	mux.Handle("GET /api/urls/{id}/history", withMiddleware(user(
+		zstd.Compression(
+			http.HandlerFunc(urlHandler.HandleHistory),
+		),
+	)))
+
+	// Ввод пароля защищённой ссылки
+	mux.Handle("POST /{id}/unlock", withMiddleware(
+		zstd.Compression(
+			http.HandlerFunc(urlHandler.HandleUnlock),
+		),
 	))
 
-	// Запускаем сервер
-	if err := runServer(cfg, mux); err != nil {
-		logger.Log.Fatalf("failed to start server: %v", err)
+	// QR-коды для печати коротких ссылок
+	mux.Handle("GET /{id}/qr", withMiddleware(qrhandler.NewQRHandler(store, func() string {
+		return live.Current().BaseURL
+	})))
+
+	mux.Handle("/ping", withMiddleware(pinghandler.NewPingHandler(store)))
+
+	// Admin API
+	admin := func(h http.Handler) http.Handler {
+		return withMiddleware(adminhandler.WithAuth(cfg.AdminToken, h))
+	}
+	mux.Handle("/admin/loglevel", admin(adminhandler.NewLogLevelHandler()))
+
+	dumpHandler := adminhandler.NewDumpHandler(store)
+	mux.Handle("/admin/export", admin(http.HandlerFunc(dumpHandler.Export)))
+	mux.Handle("/admin/import", admin(http.HandlerFunc(dumpHandler.Import)))
+
+	linksHandler := adminhandler.NewLinksHandler(store)
+	mux.Handle("GET /admin/links", admin(http.HandlerFunc(linksHandler.List)))
+	mux.Handle("GET /admin/links/{code}", admin(http.HandlerFunc(linksHandler.Get)))
+	mux.Handle("GET /admin/links/{code}/history", admin(http.HandlerFunc(linksHandler.History)))
+	mux.Handle("PATCH /admin/links/{code}", admin(http.HandlerFunc(linksHandler.Update)))
+	mux.Handle("DELETE /admin/links/{code}", admin(http.HandlerFunc(linksHandler.Delete)))
+
+	// Метрики для Prometheus
+	mux.Handle("/metrics", metrics.Handler())
+
+	return mux
+}
+
+// newMiddleware возвращает обёртку, которая добавляет к обработчику
+// трассировку и access log.
+func newMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	// Список прокси уже проверен в config.Validate
+	trusted, err := cfg.TrustedProxyPrefixes()
+	if err != nil {
+		logger.Log.Errorw("ignoring invalid trusted proxies", "error", err)
+	}
+	withLog := loghandler.NewWithLog(trusted)
+	return func(h http.Handler) http.Handler {
+		return tracing.Middleware(withLog(h))
 	}
 }
 
 // runServer запускает HTTP-сервер
-func runServer(cfg *config.Config, mux *http.ServeMux) error {
+func runServer(cfg *config.Config, handler http.Handler) error {
 	addr := cfg.ServerAdress + ":" + cfg.ServerPort
 	logger.Log.Infof(time.Now().Format("2006-01-02 15:04:05")+"Server started on %s", addr)
-	return http.ListenAndServe(addr, mux)
+	return http.ListenAndServe(addr, handler)
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"local/config"
+	"local/handlers/loghandler"
+	"local/handlers/urlhandler"
+	"local/internal/storage"
+	"local/pkg/client"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer поднимает сервер со всей цепочкой middleware поверх файлового хранилища.
+// args добавляются к флагам командной строки.
+func newTestServer(t *testing.T, args ...string) *httptest.Server {
+	t.Helper()
+	srv, _ := newReloadableTestServer(t, args...)
+	return srv
+}
+
+// newReloadableTestServer — newTestServer, конфигурацию которого можно
+// перечитать через возвращаемый Reloader.
+func newReloadableTestServer(t *testing.T, args ...string) (*httptest.Server, *config.Reloader) {
+	t.Helper()
+
+	noEnv := func(string) (string, bool) { return "", false }
+	args = append([]string{
+		"--database-dsn=",
+		"--file-storage", filepath.Join(t.TempDir(), "urls.json"),
+	}, args...)
+	load := func() (*config.Config, error) { return config.Load("test", args, noEnv) }
+	cfg, err := load()
+	require.NoError(t, err)
+
+	store, err := openStorage(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	reloader := config.NewReloader(cfg, load)
+	srv := httptest.NewServer(newRouter(reloader, store))
+	t.Cleanup(srv.Close)
+	return srv, reloader
+}
+
+// noRedirect — клиент, который возвращает редирект как есть.
+var noRedirect = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func TestEndToEnd(t *testing.T) {
+	srv := newTestServer(t)
+
+	// Создание ссылки через форму
+	resp, err := http.PostForm(srv.URL+"/api/shorten", url.Values{"url": {"https://example.com/page"}})
+	require.NoError(t, err)
+	var created []urlhandler.URLRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Len(t, created, 1)
+	assert.NotEmpty(t, resp.Header.Get(loghandler.RequestIDHeader))
+	short := created[0].ShortURL
+
+	// Редирект
+	resp, err = noRedirect.Get(srv.URL + "/" + short)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://example.com/page", resp.Header.Get("Location"))
+
+	// QR-код ссылки
+	resp, err = http.Get(srv.URL + "/" + short + "/qr")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+
+	// Страница предпросмотра вместо редиректа
+	resp, err = noRedirect.Get(srv.URL + "/" + short + "+")
+	require.NoError(t, err)
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(page), `href="https://example.com/page"`)
+
+	// Неизвестная ссылка
+	resp, err = noRedirect.Get(srv.URL + "/missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Повторное создание возвращает ту же ссылку, хотя без cookie каждый
+	// запрос приходит от нового пользователя
+	for range 3 {
+		resp, err = http.PostForm(srv.URL+"/", url.Values{"url": {"https://example.com/page"}})
+		require.NoError(t, err)
+		var again []urlhandler.URLRequest
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&again))
+		resp.Body.Close()
+		assert.Equal(t, created, again)
+	}
+
+	// Хранилище доступно
+	resp, err = http.Get(srv.URL + "/ping")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Метрики видят запросы
+	resp, err = http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `shortener_http_requests_total{route="/api/shorten",method="POST",status="201"} 1`)
+
+	// Без токена admin API выключено
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/admin/loglevel", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestEndToEndZstd(t *testing.T) {
+	srv := newTestServer(t)
+
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	payload := enc.EncodeAll([]byte(`[{"orig_url":"https://example.com/zstd"}]`), nil)
+	require.NoError(t, enc.Close())
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/shorten", bytes.NewReader(payload))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "zstd")
+	req.Header.Set("Accept-Encoding", "zstd")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "zstd", resp.Header.Get("Content-Encoding"))
+	dec, err := zstd.NewReader(resp.Body)
+	require.NoError(t, err)
+	defer dec.Close()
+
+	var created []urlhandler.URLRequest
+	require.NoError(t, json.NewDecoder(dec).Decode(&created))
+	require.Len(t, created, 1)
+	assert.Equal(t, "https://example.com/zstd", created[0].OrigURL)
+	assert.NotEmpty(t, created[0].ShortURL)
+}
+
+func TestEndToEndAdminLinks(t *testing.T) {
+	srv := newTestServer(t, "--admin-token", "secret")
+	ctx := context.Background()
+	c := client.New(srv.URL, client.Options{Token: "secret"})
+
+	shortURL, err := c.Shorten(ctx, "https://example.com/admin")
+	require.NoError(t, err)
+	code := shortURL[strings.LastIndex(shortURL, "/")+1:]
+
+	link, err := c.Stats(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/admin", link.OrigURL)
+	assert.False(t, link.Disabled)
+	assert.False(t, link.CreatedAt.IsZero())
+
+	// Ссылка с предпросмотром открывает страницу, а не редирект
+	req, err := http.NewRequest(http.MethodPatch, srv.URL+"/admin/links/"+code, strings.NewReader(`{"preview":true}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = c.Expand(ctx, code)
+	assert.ErrorIs(t, err, client.ErrPreview)
+
+	// Отключённая ссылка отвечает 410
+	req, err = http.NewRequest(http.MethodPatch, srv.URL+"/admin/links/"+code, strings.NewReader(`{"disabled":true}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = noRedirect.Get(shortURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	// Удалённая ссылка больше не находится
+	require.NoError(t, c.Delete(ctx, code))
+	_, err = c.Stats(ctx, code)
+	require.Error(t, err)
+
+	resp, err = noRedirect.Get(shortURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestEndToEndEditDestination(t *testing.T) {
+	srv := newTestServer(t, "--cookie-secret", "0123456789abcdef")
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	owner := &http.Client{Jar: jar}
+
+	resp, err := owner.PostForm(srv.URL+"/api/shorten", url.Values{"url": {"https://example.com/landing"}})
+	require.NoError(t, err)
+	var created []urlhandler.URLRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	code := created[0].ShortURL
+
+	patch := func(c *http.Client, dest string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPatch, srv.URL+"/api/urls/"+code, strings.NewReader(`{"orig_url":"`+dest+`"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Другой пользователь с cookie и тем же URL получает свою ссылку, иначе
+	// владелец мог бы перенаправить и его аудиторию
+	otherJar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	other := &http.Client{Jar: otherJar}
+	resp, err = other.PostForm(srv.URL+"/api/shorten", url.Values{"url": {"https://example.com/other"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, err = other.PostForm(srv.URL+"/api/shorten", url.Values{"url": {"https://example.com/landing"}})
+	require.NoError(t, err)
+	var otherCreated []urlhandler.URLRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&otherCreated))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Len(t, otherCreated, 1)
+	assert.NotEqual(t, code, otherCreated[0].ShortURL)
+
+	// Чужой клиент ссылку не поменяет
+	assert.Equal(t, http.StatusForbidden, patch(http.DefaultClient, "https://evil.example"))
+	assert.Equal(t, http.StatusForbidden, patch(other, "https://evil.example"))
+	require.Equal(t, http.StatusOK, patch(owner, "https://example.com/new-landing"))
+
+	resp, err = noRedirect.Get(srv.URL + "/" + otherCreated[0].ShortURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "https://example.com/landing", resp.Header.Get("Location"), "the other user's link keeps its destination")
+
+	// Повторное создание тем же пользователем возвращает его ссылку
+	resp, err = other.PostForm(srv.URL+"/api/shorten", url.Values{"url": {"https://example.com/landing"}})
+	require.NoError(t, err)
+	var again []urlhandler.URLRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&again))
+	resp.Body.Close()
+	assert.Equal(t, otherCreated, again)
+
+	resp, err = noRedirect.Get(srv.URL + "/" + code)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "https://example.com/new-landing", resp.Header.Get("Location"))
+	assert.Empty(t, resp.Cookies(), "redirects do not set cookies")
+
+	resp, err = owner.Get(srv.URL + "/api/urls/" + code + "/history")
+	require.NoError(t, err)
+	var history []storage.HistoryEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, history, 1)
+	assert.Equal(t, "https://example.com/landing", history[0].OrigURL)
+}
+
+func TestEndToEndPassword(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, err := http.PostForm(srv.URL+"/api/shorten", url.Values{"url": {"https://example.com/secret"}, "password": {"hunter2"}})
+	require.NoError(t, err)
+	var created []urlhandler.URLRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Len(t, created, 1)
+	short := created[0].ShortURL
+
+	// Вместо редиректа — форма пароля, адрес не раскрывается
+	resp, err = noRedirect.Get(srv.URL + "/" + short)
+	require.NoError(t, err)
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(page), `action="/`+short+`/unlock"`)
+	assert.NotContains(t, string(page), "example.com")
+
+	resp, err = noRedirect.PostForm(srv.URL+"/"+short+"/unlock", url.Values{"password": {"wrong"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = noRedirect.PostForm(srv.URL+"/"+short+"/unlock", url.Values{"password": {"hunter2"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "https://example.com/secret", resp.Header.Get("Location"))
+}
+
+func TestEndToEndReloadBaseURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("base-url: https://sho.rt\n"), 0o600))
+	srv, reloader := newReloadableTestServer(t, "--config", path)
+
+	resp, err := http.PostForm(srv.URL+"/api/shorten", url.Values{"url": {"https://example.com/page"}})
+	require.NoError(t, err)
+	var created []urlhandler.URLRequest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Len(t, created, 1)
+
+	qrETag := func() string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/" + created[0].ShortURL + "/qr")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Get("ETag")
+	}
+
+	// QR-код кодирует полный короткий URL, поэтому новый base URL меняет
+	// картинку без перезапуска
+	before := qrETag()
+	require.NoError(t, os.WriteFile(path, []byte("base-url: https://new.example\n"), 0o600))
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, "https://new.example", reloader.Current().BaseURL)
+	assert.NotEqual(t, before, qrETag())
+}
@@ -1,45 +1,168 @@
 package zstd
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"local/logger"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/klauspost/compress/zstd"
 )
 
+// DefaultMaxDecodedSize — максимальный размер распакованного тела запроса по умолчанию.
+const DefaultMaxDecodedSize = 1 << 20
 
+// encoderPool и decoderPools переиспользуют кодеры между запросами:
+// создание zstd.Encoder/zstd.Decoder — дорогая операция с большими аллокациями.
+// Лимит памяти задаётся декодеру при создании, поэтому у каждого лимита
+// размера тела свой пул: ключ — лимит, значение — *decoderPool.
+var (
+	encoderPool  sync.Pool
+	decoderPools sync.Map
+)
+
+// decoderPool — декодеры с одним лимитом памяти.
+type decoderPool struct {
+	pool      sync.Pool
+	maxMemory uint64
+}
+
+// decoderPoolFor возвращает пул декодеров для лимита maxDecodedSize. Лимит
+// памяти декодера защищает от кадров с огромным заявленным окном и берётся
+// с запасом: окно может быть больше самих данных.
+func decoderPoolFor(maxDecodedSize int64) *decoderPool {
+	if p, ok := decoderPools.Load(maxDecodedSize); ok {
+		return p.(*decoderPool)
+	}
+	p, _ := decoderPools.LoadOrStore(maxDecodedSize, &decoderPool{
+		maxMemory: max(uint64(maxDecodedSize)*4, zstd.MinWindowSize),
+	})
+	return p.(*decoderPool)
+}
+
+func getEncoder(w io.Writer) (*zstd.Encoder, error) {
+	if enc, ok := encoderPool.Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return enc, nil
+	}
+	return zstd.NewWriter(w,
+		zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+		zstd.WithEncoderConcurrency(1),
+	)
+}
+
+func putEncoder(enc *zstd.Encoder) {
+	enc.Reset(nil)
+	encoderPool.Put(enc)
+}
+
+func (p *decoderPool) get(r io.Reader) (*zstd.Decoder, error) {
+	if dec, ok := p.pool.Get().(*zstd.Decoder); ok {
+		if err := dec.Reset(r); err != nil {
+			p.put(dec)
+			return nil, err
+		}
+		return dec, nil
+	}
+	return zstd.NewReader(r,
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxMemory(p.maxMemory),
+	)
+}
+
+func (p *decoderPool) put(dec *zstd.Decoder) {
+	// Reset(nil) отвязывает декодер от тела запроса, чтобы пул не держал ссылку на него.
+	if err := dec.Reset(nil); err != nil {
+		dec.Close()
+		return
+	}
+	p.pool.Put(dec)
+}
 
 type ZstdRspWrt struct {
 	http.ResponseWriter
 	Writer *zstd.Encoder
 }
 
-func (zsw *ZstdRspWrt) Write(b []byte)(int, error){
+func (zsw *ZstdRspWrt) Write(b []byte) (int, error) {
 	return zsw.Writer.Write(b)
 }
 
+// Decompression распаковывает тела запросов с Content-Encoding: zstd,
+// ограничивая размер распакованных данных DefaultMaxDecodedSize.
 func Decompression(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Content-Encoding"), "zstd") {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		decoder, _ := zstd.NewReader(r.Body)
+	return NewDecompression(DefaultMaxDecodedSize)(next)
+}
 
-		defer decoder.Close()
+// NewDecompression возвращает middleware распаковки с заданным лимитом размера
+// распакованного тела. Повреждённое тело отклоняется с 400, превышение лимита — с 413.
+func NewDecompression(maxDecodedSize int64) func(http.Handler) http.Handler {
+	decoders := decoderPoolFor(maxDecodedSize)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Content-Encoding"), "zstd") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log := logger.FromContext(r.Context())
+
+			body, err := decodeBody(decoders, r.Body, maxDecodedSize)
+			if err != nil {
+				if errors.Is(err, errBodyTooLarge) {
+					log.Warnw("decompressed body exceeds limit", "limit", maxDecodedSize)
+					http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				log.Warnw("failed to decompress request body", "error", err)
+				http.Error(w, "Malformed zstd body", http.StatusBadRequest)
+				return
+			}
+
+			// Тело распаковано целиком, поэтому дальше оно передаётся как обычные данные.
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			log.Debug("The request decompression procedure has been completed")
 
-		r.Body = io.NopCloser(decoder)
-		w.Header().Del("Content-Length")
-		logger.Log.Debug("The response decompression procedure has been initialized")
-
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
- 
+var errBodyTooLarge = errors.New("decoded body too large")
+
+// decodeBody читает и распаковывает тело запроса целиком, не более maxSize байт.
+// Кадр, которому для распаковки нужно больше памяти, чем позволяет лимит,
+// тоже считается слишком большим.
+func decodeBody(decoders *decoderPool, body io.ReadCloser, maxSize int64) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, nil
+	}
+	defer body.Close()
+
+	dec, err := decoders.get(body)
+	if err != nil {
+		return nil, err
+	}
+	defer decoders.put(dec)
+
+	data, err := io.ReadAll(io.LimitReader(dec, maxSize+1))
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errBodyTooLarge
+	}
+	return data, nil
+}
 
 func Compression(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -48,16 +171,27 @@ func Compression(next http.Handler) http.Handler {
 			return
 		}
 
-		encoder, _ := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
-		
-		defer encoder.Close()
+		log := logger.FromContext(r.Context())
+
+		encoder, err := getEncoder(w)
+		if err != nil {
+			// Без кодера отдаём ответ как есть — клиент всё равно его поймёт.
+			log.Errorw("failed to create zstd encoder", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer func() {
+			if err := encoder.Close(); err != nil {
+				log.Errorw("failed to flush zstd response", "error", err)
+			}
+			putEncoder(encoder)
+		}()
+
 		w.Header().Set("Content-Encoding", "zstd")
-		w.Header().Del("Content-Lenght")
+		w.Header().Del("Content-Length")
 
-		logger.Log.Debug("The response compression procedure has been initialized")
+		log.Debug("The response compression procedure has been initialized")
 
 		next.ServeHTTP(&ZstdRspWrt{ResponseWriter: w, Writer: encoder}, r)
-
 	})
 }
-
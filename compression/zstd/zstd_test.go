@@ -1,13 +1,39 @@
 package zstd
 
 import (
+	"bytes"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// compress сжимает данные так же, как это делает клиент.
+func compress(t testing.TB, data []byte) []byte {
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+// decompress распаковывает тело ответа, если оно сжато zstd.
+func decompress(t testing.TB, w *httptest.ResponseRecorder) string {
+	if w.Header().Get("Content-Encoding") != "zstd" {
+		return w.Body.String()
+	}
+	dec, err := zstd.NewReader(w.Body)
+	require.NoError(t, err)
+	defer dec.Close()
+	data, err := io.ReadAll(dec)
+	require.NoError(t, err)
+	return string(data)
+}
+
 func TestZstdCompress(t *testing.T) {
 	// Создаем тестовый обработчик
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -51,7 +77,7 @@ func TestZstdCompress(t *testing.T) {
 
 			// Проверяем, что ответ был сжат с использованием zstd
 			assert.Equal(t, tt.expectedHeader, w.Header().Get("Content-Encoding"))
-			assert.Equal(t, tt.expectedBody, w.Body.String())
+			assert.Equal(t, tt.expectedBody, decompress(t, w))
 		})
 	}
 }
@@ -62,27 +88,26 @@ func TestZstdDecompress(t *testing.T) {
 		w.Write([]byte("Hello, world!"))
 	})
 
-	
 	zstdDecompress := Decompression(nextHandler)
 
 	// Таблица тестов
 	tests := []struct {
-		name           string
+		name            string
 		contentEncoding string
-		expectedHeader string
-		expectedBody   string
+		expectedHeader  string
+		expectedBody    string
 	}{
 		{
-			name:           "Content-Encoding: zstd",
+			name:            "Content-Encoding: zstd",
 			contentEncoding: "zstd",
-			expectedHeader: "",
-			expectedBody:   "Hello, world!",
+			expectedHeader:  "",
+			expectedBody:    "Hello, world!",
 		},
 		{
-			name:           "Content-Encoding: gzip",
+			name:            "Content-Encoding: gzip",
 			contentEncoding: "gzip",
-			expectedHeader: "",
-			expectedBody:   "Hello, world!",
+			expectedHeader:  "",
+			expectedBody:    "Hello, world!",
 		},
 	}
 
@@ -104,3 +129,146 @@ func TestZstdDecompress(t *testing.T) {
 		})
 	}
 }
+
+func TestZstdDecompressBody(t *testing.T) {
+	// Обработчик возвращает тело запроса как есть
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	})
+
+	payload := []byte(`[{"orig_url":"https://example.com"}]`)
+
+	tests := []struct {
+		name           string
+		body           []byte
+		maxDecodedSize int64
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "valid body",
+			body:           compress(t, payload),
+			maxDecodedSize: DefaultMaxDecodedSize,
+			expectedStatus: http.StatusOK,
+			expectedBody:   string(payload),
+		},
+		{
+			name:           "malformed body",
+			body:           []byte("definitely not zstd"),
+			maxDecodedSize: DefaultMaxDecodedSize,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "truncated body",
+			body:           compress(t, payload)[:10],
+			maxDecodedSize: DefaultMaxDecodedSize,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "decompression bomb",
+			body:           compress(t, bytes.Repeat([]byte{'a'}, 1<<16)),
+			maxDecodedSize: 1 << 10,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			// Окно кадра равно размеру данных и больше, чем память декодеров
+			// с лимитом по умолчанию
+			name:           "limit above default",
+			body:           compress(t, bytes.Repeat([]byte{'a'}, 6<<20)),
+			maxDecodedSize: 8 << 20,
+			expectedStatus: http.StatusOK,
+			expectedBody:   strings.Repeat("a", 6<<20),
+		},
+		{
+			name:           "window larger than limit allows",
+			body:           compress(t, bytes.Repeat([]byte{'a'}, 6<<20)),
+			maxDecodedSize: DefaultMaxDecodedSize,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", "zstd")
+			w := httptest.NewRecorder()
+
+			NewDecompression(tt.maxDecodedSize)(echo).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+var benchBody = []byte(strings.Repeat(`{"short_url":"Ph-VaNhL","orig_url":"https://example.com/some/long/path"}`, 16))
+
+func BenchmarkCompression(b *testing.B) {
+	handler := Compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(benchBody)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkCompressionUnpooled повторяет прежнее поведение middleware
+// (новый кодер на каждый запрос) для сравнения с BenchmarkCompression.
+func BenchmarkCompressionUnpooled(b *testing.B) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc, _ := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		defer enc.Close()
+		w.Header().Set("Content-Encoding", "zstd")
+		enc.Write(benchBody)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkDecompression(b *testing.B) {
+	handler := Decompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	compressed := compress(b, benchBody)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed))
+		req.Header.Set("Content-Encoding", "zstd")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkDecompressionUnpooled повторяет прежнее поведение middleware
+// (новый декодер на каждый запрос) для сравнения с BenchmarkDecompression.
+func BenchmarkDecompressionUnpooled(b *testing.B) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dec, _ := zstd.NewReader(r.Body)
+		defer dec.Close()
+		io.Copy(io.Discard, dec)
+	})
+	compressed := compress(b, benchBody)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed))
+		req.Header.Set("Content-Encoding", "zstd")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile applies a YAML or JSON config file to fs. Keys are the long flag
+// names, underscores may be used instead of dashes:
+//
+//	server-port: 8081
+//	log_output: [stdout, /var/log/shortener.log]
+func loadFile(path string, fs *pflag.FlagSet) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	// JSON is a subset of YAML, so one decoder handles both formats.
+	values := make(map[string]any)
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	for key, value := range values {
+		name := strings.ReplaceAll(key, "_", "-")
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown option %q", path, key)
+		}
+		if err := setFileValue(fs, name, value); err != nil {
+			return fmt.Errorf("config file %s: invalid %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+func setFileValue(fs *pflag.FlagSet, name string, value any) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		sv, ok := fs.Lookup(name).Value.(pflag.SliceValue)
+		if !ok {
+			return fmt.Errorf("list is not allowed")
+		}
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return sv.Replace(items)
+	case map[string]any:
+		return fmt.Errorf("nested objects are not allowed")
+	default:
+		return setFlag(fs, name, fmt.Sprint(v))
+	}
+}
+
+// readCSV splits a comma-separated list, trimming spaces around items.
+func readCSV(value string) ([]string, error) {
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+		if items[i] == "" {
+			return nil, fmt.Errorf("empty item in list %q", value)
+		}
+	}
+	return items, nil
+}
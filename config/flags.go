@@ -1,11 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"local/logger"
+	"net/netip"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
-	"go.uber.org/zap"
 )
 
 // Config represents the configuration for the application.
@@ -14,52 +17,239 @@ type Config struct {
 	ServerPort   string
 	BaseURL      string
 	LogLevel     string
+	LogFormat    string
+	LogOutputs   []string
+	LogMaxSize   int
+	LogMaxAge    int
+	LogBackups   int
 	FileStorage  string
 	DataBaseDSN  string
 	URLLength    uint16
+	AdminToken   string
+	CookieSecret string
+	TraceFile    string
+
+	// TrustedProxies lists the proxies (IPs or CIDRs) whose X-Forwarded-For
+	// and X-Real-IP headers are believed.
+	TrustedProxies []string
+
+	DBMaxOpenConns     int
+	DBMaxIdleConns     int
+	DBConnMaxLifetime  time.Duration
+	DBConnMaxIdleTime  time.Duration
+	DBStatementTimeout time.Duration
+	DBConnectTimeout   time.Duration
+	DBUsePgxPool       bool
+
+	CacheSize        int
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+
+	// ConfigFile is the config file the configuration was loaded from, if any.
+	ConfigFile string
+}
+
+// envVars maps environment variables to the flags they override.
+var envVars = []struct {
+	env  string
+	flag string
+}{
+	{"SERVER_ADDRESS", "server-address"},
+	{"SERVER_PORT", "server-port"},
+	{"BASE_URL", "base-url"},
+	{"LOG_LEVEL", "log-level"},
+	{"LOG_FORMAT", "log-format"},
+	{"LOG_OUTPUT", "log-output"},
+	{"LOG_MAX_SIZE", "log-max-size"},
+	{"LOG_MAX_AGE", "log-max-age"},
+	{"LOG_MAX_BACKUPS", "log-max-backups"},
+	{"FILE_STORAGE", "file-storage"},
+	{"DATABASE_DSN", "database-dsn"},
+	{"URL_LENGTH", "url-length"},
+	{"ADMIN_TOKEN", "admin-token"},
+	{"COOKIE_SECRET", "cookie-secret"},
+	{"TRACE_FILE", "trace-file"},
+	{"TRUSTED_PROXIES", "trusted-proxies"},
+	{"DB_MAX_OPEN_CONNS", "db-max-open-conns"},
+	{"DB_MAX_IDLE_CONNS", "db-max-idle-conns"},
+	{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime"},
+	{"DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time"},
+	{"DB_STATEMENT_TIMEOUT", "db-statement-timeout"},
+	{"DB_CONNECT_TIMEOUT", "db-connect-timeout"},
+	{"DB_USE_PGX_POOL", "db-use-pgx-pool"},
+	{"CACHE_SIZE", "cache-size"},
+	{"CACHE_TTL", "cache-ttl"},
+	{"CACHE_NEGATIVE_TTL", "cache-negative-ttl"},
+}
+
+// configEnv names the environment variable holding the config file path.
+const configEnv = "CONFIG"
+
+// newFlagSet defines every configuration flag bound to cfg. Defining the
+// flags also fills cfg with the default values.
+func newFlagSet(name string, cfg *Config) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+
+	fs.StringVarP(&cfg.ServerAdress, "server-address", "s", "localhost", "Server address")
+	fs.StringVarP(&cfg.ServerPort, "server-port", "p", "8080", "Server port")
+	fs.StringVarP(&cfg.BaseURL, "base-url", "b", "http://localhost:8080", "Base URL for return server")
+	fs.StringVar(&cfg.LogLevel, "log-level", "debug", "Log level (debug, info, warn, error)")
+	fs.StringVar(&cfg.LogFormat, "log-format", "console", "Log format (console, json)")
+	fs.StringSliceVar(&cfg.LogOutputs, "log-output", []string{"stdout"}, "Log outputs: stdout, stderr or file path (comma-separated)")
+	fs.IntVar(&cfg.LogMaxSize, "log-max-size", 100, "Max log file size in megabytes before rotation")
+	fs.IntVar(&cfg.LogMaxAge, "log-max-age", 7, "Max days to keep rotated log files")
+	fs.IntVar(&cfg.LogBackups, "log-max-backups", 5, "Max number of rotated log files to keep")
+	fs.StringVarP(&cfg.FileStorage, "file-storage", "f", "short-url-db.json", "Path to file storage")
+	fs.StringVarP(&cfg.DataBaseDSN, "database-dsn", "d", "postgres://postgres:1@localhost:5432/usvideos", "PostgreSQL DSN")
+	fs.Uint16VarP(&cfg.URLLength, "url-length", "l", 8, "URL length")
+	fs.StringVar(&cfg.AdminToken, "admin-token", "", "Bearer token for the /admin API (empty disables it)")
+	fs.StringVar(&cfg.CookieSecret, "cookie-secret", "", "Secret for signing user ID cookies (empty generates one at startup, so owners lose access to their links after a restart)")
+	fs.StringVar(&cfg.TraceFile, "trace-file", "", "File to export trace spans to as JSON lines (empty disables export)")
+	fs.StringSliceVar(&cfg.TrustedProxies, "trusted-proxies", nil, "Proxies (IPs or CIDRs, comma-separated) allowed to set X-Forwarded-For and X-Real-IP")
+	fs.IntVar(&cfg.DBMaxOpenConns, "db-max-open-conns", 20, "Max open PostgreSQL connections")
+	fs.IntVar(&cfg.DBMaxIdleConns, "db-max-idle-conns", 5, "Max idle PostgreSQL connections")
+	fs.DurationVar(&cfg.DBConnMaxLifetime, "db-conn-max-lifetime", 30*time.Minute, "Max lifetime of a PostgreSQL connection")
+	fs.DurationVar(&cfg.DBConnMaxIdleTime, "db-conn-max-idle-time", 5*time.Minute, "Max idle time of a PostgreSQL connection")
+	fs.DurationVar(&cfg.DBStatementTimeout, "db-statement-timeout", 5*time.Second, "PostgreSQL statement_timeout (0 disables it)")
+	fs.DurationVar(&cfg.DBConnectTimeout, "db-connect-timeout", 5*time.Second, "Timeout for establishing a PostgreSQL connection")
+	fs.BoolVar(&cfg.DBUsePgxPool, "db-use-pgx-pool", false, "Use the native pgx pool instead of database/sql")
+	fs.IntVar(&cfg.CacheSize, "cache-size", 10000, "Max number of cached lookups in front of the storage (0 disables the cache)")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", 5*time.Minute, "How long cached links are served")
+	fs.DurationVar(&cfg.CacheNegativeTTL, "cache-negative-ttl", 10*time.Second, "How long unknown short URLs are cached (0 disables negative caching)")
+
+	return fs
+}
+
+// InitConfig initializes the configuration for the application from the
+// command line, the environment and an optional config file.
+func InitConfig() (*Config, error) {
+	return Load(os.Args[0], os.Args[1:], os.LookupEnv)
+}
+
+// Load builds the configuration with the precedence
+// flags > environment > config file > defaults and validates the result.
+// The config file is taken from --config or the CONFIG environment variable.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg, _, err := LoadArgs(name, args, lookupEnv, nil)
+	return cfg, err
 }
 
-// InitConfig initializes the configuration for the application.
-func InitConfig() *Config {
+// LoadArgs is Load for commands that take their own flags and positional
+// arguments on top of the configuration: extra defines the additional flags
+// and the positional arguments are returned.
+func LoadArgs(name string, args []string, lookupEnv func(string) (string, bool), extra func(*pflag.FlagSet)) (*Config, []string, error) {
+	// Flags are parsed into their own copy first so that we know which of
+	// them were set explicitly and can apply them last.
+	flagCfg := &Config{}
+	flags := newFlagSet(name, flagCfg)
+	var configPath string
+	flags.StringVarP(&configPath, "config", "c", "", "Path to a YAML or JSON config file (env CONFIG)")
+	if extra != nil {
+		extra(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
 	cfg := &Config{}
+	target := newFlagSet(name, cfg)
 
-	// Define command-line flags
-	pflag.StringVarP(&cfg.ServerAdress, "server-address", "s", "localhost", "Server address")
-	pflag.StringVarP(&cfg.ServerPort, "server-port", "p", "8080", "Server port")
-	pflag.StringVarP(&cfg.BaseURL, "base-url", "b", "http://localhost:8080", "Base URL for return server")
-	pflag.StringVar(&cfg.LogLevel, "log-level", "debug", "Log level")
-	pflag.StringVarP(&cfg.FileStorage, "file-storage", "f", "short-url-db.json", "Path to file storage")
-	pflag.StringVarP(&cfg.DataBaseDSN, "database-dsn", "d", "postgres://postgres:1@localhost:5432/usvideos", "PostgreSQL DSN")
-	pflag.Uint16VarP(&cfg.URLLength, "url-length", "l", 8, "URL length")
-	// Override configuration with environment variables if they are set
-	if envServerAdress := os.Getenv("SERVER_ADDRESS"); envServerAdress != "" {
-		cfg.ServerAdress = envServerAdress
-		logger.Log.Infof("Server address set to ", zap.String("address", envServerAdress))
+	if configPath == "" {
+		configPath, _ = lookupEnv(configEnv)
+	}
+	if configPath != "" {
+		if err := loadFile(configPath, target); err != nil {
+			return nil, nil, err
+		}
+		logger.Log.Infow("Config file loaded", "path", configPath)
 	}
-	if envServerPort := os.Getenv("SERVER_PORT"); envServerPort != "" {
-		cfg.ServerPort = envServerPort
 
-		logger.Log.Infof("Server port set to ", zap.String("port", envServerPort))
+	for _, ev := range envVars {
+		value, ok := lookupEnv(ev.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setFlag(target, ev.flag, value); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", ev.env, err)
+		}
 	}
-	if envBaseURL := os.Getenv("BASE_URL"); envBaseURL != "" {
-		cfg.BaseURL = envBaseURL
-		logger.Log.Infof("Base URL set to ", zap.String("url", envBaseURL))
+
+	var err error
+	flags.Visit(func(f *pflag.Flag) {
+		// --config and the flags defined by extra are not part of the configuration
+		dst := target.Lookup(f.Name)
+		if err != nil || dst == nil {
+			return
+		}
+		err = copyFlag(dst, f)
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
-		cfg.LogLevel = envLogLevel
-		logger.Log.Infof("Log level set to ", zap.String("level", envLogLevel))
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
 	}
-	if envFileStorage := os.Getenv("FILE_STORAGE"); envFileStorage != "" {
-		cfg.FileStorage = envFileStorage
-		logger.Log.Infof("File storage set to ", zap.String("file", envFileStorage))
+	cfg.ConfigFile = configPath
+	return cfg, flags.Args(), nil
+}
+
+// setFlag sets a flag from its textual representation. Slice flags are
+// replaced rather than appended to.
+func setFlag(fs *pflag.FlagSet, name, value string) error {
+	f := fs.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("unknown option %q", name)
 	}
-	if envDataBaseDSN := os.Getenv("DATABASE_DSN"); envDataBaseDSN != "" {
-		cfg.DataBaseDSN = envDataBaseDSN
-		logger.Log.Infof("DATABASE_DSN set to ", zap.String("database", envDataBaseDSN))
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		values, err := readCSV(value)
+		if err != nil {
+			return err
+		}
+		return sv.Replace(values)
 	}
+	return f.Value.Set(value)
+}
 
-	// Parse command-line flags
-	pflag.Parse()
+// copyFlag copies the value of src into dst.
+func copyFlag(dst, src *pflag.Flag) error {
+	if sv, ok := src.Value.(pflag.SliceValue); ok {
+		return dst.Value.(pflag.SliceValue).Replace(sv.GetSlice())
+	}
+	return dst.Value.Set(src.Value.String())
+}
 
-	return cfg
+// LoggerOptions возвращает настройки логгера из конфигурации.
+func (c *Config) LoggerOptions() logger.Options {
+	return logger.Options{
+		Level:      c.LogLevel,
+		Format:     c.LogFormat,
+		Outputs:    c.LogOutputs,
+		MaxSizeMB:  c.LogMaxSize,
+		MaxAgeDays: c.LogMaxAge,
+		MaxBackups: c.LogBackups,
+	}
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. A bare IP stands for a prefix
+// holding just that address.
+func (c *Config) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, s := range c.TrustedProxies {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", s)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", s)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
 }
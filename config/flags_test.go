@@ -0,0 +1,156 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlPath := writeConfig(t, "config.yaml", `
+server-port: 9000
+base_url: http://file.example
+log-level: warn
+log-output: [stderr, /tmp/app.log]
+url-length: 10
+`)
+	jsonPath := writeConfig(t, "config.json", `{"server-port": "9100", "url_length": 12}`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected func(*Config)
+	}{
+		{
+			name: "defaults",
+			expected: func(c *Config) {
+				assert.Equal(t, "8080", c.ServerPort)
+				assert.Equal(t, "http://localhost:8080", c.BaseURL)
+				assert.Equal(t, uint16(8), c.URLLength)
+				assert.Equal(t, []string{"stdout"}, c.LogOutputs)
+			},
+		},
+		{
+			name: "file over defaults",
+			args: []string{"--config", yamlPath},
+			expected: func(c *Config) {
+				assert.Equal(t, "9000", c.ServerPort)
+				assert.Equal(t, "http://file.example", c.BaseURL)
+				assert.Equal(t, "warn", c.LogLevel)
+				assert.Equal(t, []string{"stderr", "/tmp/app.log"}, c.LogOutputs)
+				assert.Equal(t, uint16(10), c.URLLength)
+			},
+		},
+		{
+			name: "json file from env",
+			env:  map[string]string{"CONFIG": jsonPath},
+			expected: func(c *Config) {
+				assert.Equal(t, "9100", c.ServerPort)
+				assert.Equal(t, uint16(12), c.URLLength)
+			},
+		},
+		{
+			name: "env over file",
+			args: []string{"--config", yamlPath},
+			env:  map[string]string{"SERVER_PORT": "9001", "URL_LENGTH": "6", "LOG_OUTPUT": "stdout, stderr"},
+			expected: func(c *Config) {
+				assert.Equal(t, "9001", c.ServerPort)
+				assert.Equal(t, uint16(6), c.URLLength)
+				assert.Equal(t, []string{"stdout", "stderr"}, c.LogOutputs)
+				assert.Equal(t, "http://file.example", c.BaseURL)
+			},
+		},
+		{
+			name: "flags over env",
+			args: []string{"--config", yamlPath, "-p", "9002", "--log-output", "stderr"},
+			env:  map[string]string{"SERVER_PORT": "9001", "BASE_URL": "https://env.example"},
+			expected: func(c *Config) {
+				assert.Equal(t, "9002", c.ServerPort)
+				assert.Equal(t, "https://env.example", c.BaseURL)
+				assert.Equal(t, []string{"stderr"}, c.LogOutputs)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load("test", tt.args, env(tt.env))
+			require.NoError(t, err)
+			tt.expected(cfg)
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "invalid port flag", args: []string{"-p", "http"}},
+		{name: "invalid url length env", env: map[string]string{"URL_LENGTH": "abc"}},
+		{name: "url length out of range", args: []string{"-l", "100"}},
+		{name: "relative base url", env: map[string]string{"BASE_URL": "localhost:8080"}},
+		{name: "unknown log level", args: []string{"--log-level", "verbose"}},
+		{name: "negative db connections", args: []string{"--db-max-open-conns", "-1"}},
+		{name: "invalid db timeout env", env: map[string]string{"DB_STATEMENT_TIMEOUT": "soon"}},
+		{name: "short cookie secret", env: map[string]string{"COOKIE_SECRET": "secret"}},
+		{name: "invalid trusted proxy", env: map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8, proxy.local"}},
+		{name: "missing config file", args: []string{"--config", "does-not-exist.yaml"}},
+		{name: "unknown file option", args: []string{"--config", writeConfig(t, "bad.yaml", "colour: blue\n")}},
+		{name: "invalid file value", args: []string{"--config", writeConfig(t, "bad.json", `{"url-length": "long"}`)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load("test", tt.args, env(tt.env))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadArgs(t *testing.T) {
+	var format string
+	cfg, args, err := LoadArgs("test", []string{"--format", "csv", "-p", "9000", "dump.csv"}, env(nil), func(fs *pflag.FlagSet) {
+		fs.StringVar(&format, "format", "jsonl", "")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "csv", format)
+	assert.Equal(t, "9000", cfg.ServerPort)
+	assert.Equal(t, []string{"dump.csv"}, args)
+
+	_, _, err = LoadArgs("test", []string{"--format", "csv"}, env(nil), nil)
+	assert.Error(t, err, "extra flags are unknown without extra")
+}
+
+func TestTrustedProxyPrefixes(t *testing.T) {
+	cfg, err := Load("test", []string{"--trusted-proxies", "10.0.0.1/8, 192.0.2.1,::1"}, env(nil))
+	require.NoError(t, err)
+
+	prefixes, err := cfg.TrustedProxyPrefixes()
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("::1/128"),
+	}, prefixes)
+}
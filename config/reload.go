@@ -0,0 +1,148 @@
+package config
+
+import (
+	"context"
+	"local/logger"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloadable lists the options that can change without a restart. Their
+// consumers must read Reloader.Current on use or subscribe to reloads:
+// the log level is applied by a subscriber in cmd/server, the base URL is
+// read per request by the QR code handler.
+var reloadable = []struct {
+	name  string
+	get   func(*Config) string
+	apply func(dst, src *Config)
+}{
+	{"log-level", func(c *Config) string { return c.LogLevel }, func(dst, src *Config) { dst.LogLevel = src.LogLevel }},
+	{"base-url", func(c *Config) string { return c.BaseURL }, func(dst, src *Config) { dst.BaseURL = src.BaseURL }},
+}
+
+// Reloader holds the live configuration and reloads its reloadable subset
+// on SIGHUP or when the config file changes. Other options are only read
+// at startup; changing them is reported but has no effect until restart.
+type Reloader struct {
+	load    func() (*Config, error)
+	current atomic.Pointer[Config]
+
+	mu          sync.Mutex
+	subscribers []func(old, new *Config)
+}
+
+// NewReloader returns a Reloader serving cfg until the first reload.
+// load is used to read the configuration again, usually InitConfig.
+func NewReloader(cfg *Config, load func() (*Config, error)) *Reloader {
+	r := &Reloader{load: load}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the live configuration. The returned value must not be
+// modified.
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// Subscribe registers fn to be called after every reload that changed at
+// least one option.
+func (r *Reloader) Subscribe(fn func(old, new *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Reload reads the configuration again and applies the reloadable options.
+// On error the current configuration is kept.
+func (r *Reloader) Reload() error {
+	loaded, err := r.load()
+	if err != nil {
+		logger.Log.Errorw("config reload failed, keeping current config", "error", err)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.current.Load()
+	next := *old
+	changed := false
+	for _, opt := range reloadable {
+		if from, to := opt.get(old), opt.get(loaded); from != to {
+			opt.apply(&next, loaded)
+			changed = true
+			logger.Log.Warnw("config option reloaded", "option", opt.name, "from", from, "to", to)
+		}
+	}
+
+	// Anything else that differs needs a restart to take effect.
+	pending := *loaded
+	for _, opt := range reloadable {
+		opt.apply(&pending, old)
+	}
+	if !reflect.DeepEqual(&pending, old) {
+		logger.Log.Warn("config file has changes that require a restart to take effect")
+	}
+
+	if !changed {
+		logger.Log.Info("config reloaded, nothing changed")
+		return nil
+	}
+
+	r.current.Store(&next)
+	for _, fn := range r.subscribers {
+		fn(old, &next)
+	}
+	return nil
+}
+
+// Watch reloads the configuration on SIGHUP and whenever the modification
+// time of the config file changes, checking it every interval. It blocks
+// until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	path := r.Current().ConfigFile
+	lastMod := modTime(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Log.Info("SIGHUP received, reloading config")
+			_ = r.Reload()
+		case <-ticker.C:
+			if path == "" {
+				continue
+			}
+			if mod := modTime(path); !mod.Equal(lastMod) {
+				lastMod = mod
+				logger.Log.Infow("config file changed, reloading config", "path", path)
+				_ = r.Reload()
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
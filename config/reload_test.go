@@ -0,0 +1,65 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloaderReload(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "log-level: info\nserver-port: 8080\n")
+	load := func() (*Config, error) { return Load("test", []string{"--config", path}, env(nil)) }
+
+	cfg, err := load()
+	require.NoError(t, err)
+	r := NewReloader(cfg, load)
+
+	var calls [][2]*Config
+	r.Subscribe(func(old, new *Config) { calls = append(calls, [2]*Config{old, new}) })
+
+	// Ничего не изменилось — подписчики не вызываются
+	require.NoError(t, r.Reload())
+	assert.Empty(t, calls)
+
+	// Уровень логов и base URL применяются, порт — только после перезапуска
+	require.NoError(t, os.WriteFile(path, []byte("log-level: warn\nserver-port: 9090\nbase-url: https://sho.rt\n"), 0o600))
+	require.NoError(t, r.Reload())
+	require.Len(t, calls, 1)
+	assert.Equal(t, "info", calls[0][0].LogLevel)
+	assert.Equal(t, "warn", r.Current().LogLevel)
+	assert.Equal(t, "https://sho.rt", r.Current().BaseURL)
+	assert.Equal(t, "8080", r.Current().ServerPort)
+
+	// Невалидный файл не ломает текущую конфигурацию
+	require.NoError(t, os.WriteFile(path, []byte("log-level: loud\n"), 0o600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, "warn", r.Current().LogLevel)
+}
+
+func TestReloaderWatchFile(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "log-level: info\n")
+	load := func() (*Config, error) { return Load("test", []string{"--config", path}, env(nil)) }
+
+	cfg, err := load()
+	require.NoError(t, err)
+	r := NewReloader(cfg, load)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 5*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("log-level: error\n"), 0o600))
+
+	// Watch мог запомнить время модификации уже после записи,
+	// поэтому сдвигаем его, пока изменение не будет замечено
+	mod := time.Now()
+	assert.Eventually(t, func() bool {
+		mod = mod.Add(time.Second)
+		require.NoError(t, os.Chtimes(path, mod, mod))
+		return r.Current().LogLevel == "error"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// maxURLLength is the length of a base64-encoded SHA-256 hash, the longest
+// short URL the generator can produce.
+const maxURLLength = 44
+
+// minCookieSecret is the shortest secret accepted for signing cookies.
+const minCookieSecret = 16
+
+// Validate checks the configuration and reports every invalid option.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ServerAdress == "" {
+		errs = append(errs, errors.New("server address must not be empty"))
+	}
+	if port, err := strconv.Atoi(c.ServerPort); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid server port %q", c.ServerPort))
+	}
+	if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid base URL %q: must be an absolute http(s) URL", c.BaseURL))
+	}
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %q", c.LogLevel))
+	}
+	if c.LogFormat != "console" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("invalid log format %q: must be console or json", c.LogFormat))
+	}
+	if len(c.LogOutputs) == 0 {
+		errs = append(errs, errors.New("at least one log output is required"))
+	}
+	if c.LogMaxSize < 0 || c.LogMaxAge < 0 || c.LogBackups < 0 {
+		errs = append(errs, errors.New("log rotation limits must not be negative"))
+	}
+	if c.URLLength == 0 || c.URLLength > maxURLLength {
+		errs = append(errs, fmt.Errorf("invalid URL length %d: must be between 1 and %d", c.URLLength, maxURLLength))
+	}
+
+	if c.CookieSecret != "" && len(c.CookieSecret) < minCookieSecret {
+		errs = append(errs, fmt.Errorf("cookie secret is too short: must be at least %d bytes", minCookieSecret))
+	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 {
+		errs = append(errs, errors.New("database connection limits must not be negative"))
+	}
+	if c.DBConnMaxLifetime < 0 || c.DBConnMaxIdleTime < 0 || c.DBStatementTimeout < 0 || c.DBConnectTimeout < 0 {
+		errs = append(errs, errors.New("database timeouts must not be negative"))
+	}
+	if c.CacheSize < 0 || c.CacheTTL < 0 || c.CacheNegativeTTL < 0 {
+		errs = append(errs, errors.New("cache size and TTLs must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,29 @@
+package adminhandler
+
+import (
+	"crypto/subtle"
+	"local/logger"
+	"net/http"
+	"strings"
+)
+
+// WithAuth пропускает запрос дальше только с заголовком
+// Authorization: Bearer <token>. Пустой token отключает admin API целиком.
+func WithAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			logger.FromContext(r.Context()).Warnw("admin authentication failed", "uri", r.RequestURI)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
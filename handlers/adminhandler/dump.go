@@ -0,0 +1,118 @@
+package adminhandler
+
+import (
+	"errors"
+	"local/internal/storage"
+	"local/internal/storage/dump"
+	"local/logger"
+	"net/http"
+	"time"
+)
+
+// ImportResponse — итог POST /admin/import. При ошибке в Error её текст, а
+// счётчики показывают, сколько ссылок успело загрузиться.
+type ImportResponse struct {
+	dump.Stats
+	Error string `json:"error,omitempty"`
+}
+
+// DumpHandler выгружает и загружает ссылки хранилища:
+// GET /admin/export?format=jsonl|csv и
+// POST /admin/import?format=jsonl|csv&on_conflict=skip|overwrite|fail.
+type DumpHandler struct {
+	store storage.Storage
+}
+
+func NewDumpHandler(store storage.Storage) *DumpHandler {
+	return &DumpHandler{store: store}
+}
+
+// queryParam возвращает параметр запроса или значение по умолчанию.
+func queryParam(r *http.Request, name, def string) string {
+	if v := r.URL.Query().Get(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// Export отдаёт все ссылки файлом. Ошибка после первых записей уже не может
+// изменить код ответа, поэтому она только логируется и обрывает соединение,
+// чтобы клиент не принял обрезанный файл за полный.
+func (h *DumpHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	log := logger.FromContext(r.Context())
+
+	format, err := dump.ParseFormat(queryParam(r, "format", string(dump.JSONL)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == dump.CSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	filename := "links-" + time.Now().UTC().Format("20060102-150405") + "." + string(format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	n, err := dump.Export(r.Context(), h.store, w, format)
+	if err != nil {
+		log.Errorw("export failed", "exported", n, "error", err)
+		if n == 0 {
+			// Export буферизует вывод, так что клиенту ещё ничего не ушло
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Storage error", http.StatusInternalServerError)
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+	log.Infow("links exported", "count", n, "format", format)
+}
+
+// Import загружает ссылки из тела запроса.
+func (h *DumpHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	log := logger.FromContext(r.Context())
+
+	format, err := dump.ParseFormat(queryParam(r, "format", string(dump.JSONL)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	policy, err := dump.ParsePolicy(queryParam(r, "on_conflict", string(dump.Fail)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := dump.Import(r.Context(), h.store, r.Body, format, policy)
+	resp := ImportResponse{Stats: stats}
+	status := http.StatusOK
+	if err != nil {
+		resp.Error = err.Error()
+		switch {
+		case errors.Is(err, dump.ErrMalformed), errors.Is(err, storage.ErrInvalid):
+			status = http.StatusBadRequest
+		case errors.Is(err, storage.ErrConflict):
+			status = http.StatusConflict
+		default:
+			status = http.StatusInternalServerError
+		}
+	}
+	log.Infow("links imported",
+		"imported", stats.Imported,
+		"skipped", stats.Skipped,
+		"format", format,
+		"on_conflict", policy,
+		"error", resp.Error,
+	)
+
+	writeJSON(w, r, status, resp)
+}
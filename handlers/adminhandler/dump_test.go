@@ -0,0 +1,136 @@
+package adminhandler
+
+import (
+	"context"
+	"encoding/json"
+	"local/internal/storage"
+	"local/internal/storage/dump"
+	"local/internal/storage/memory"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpHandlerExport(t *testing.T) {
+	store, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	require.NoError(t, store.Save(context.Background(), "abc", "https://example.com"))
+	h := NewDumpHandler(store)
+
+	tests := []struct {
+		name           string
+		method         string
+		query          string
+		expectedStatus int
+		expectedType   string
+		expectedBody   string
+	}{
+		{name: "jsonl by default", method: http.MethodGet, expectedStatus: http.StatusOK, expectedType: "application/x-ndjson", expectedBody: `"short_url":"abc"`},
+		{name: "csv", method: http.MethodGet, query: "?format=csv", expectedStatus: http.StatusOK, expectedType: "text/csv; charset=utf-8", expectedBody: "abc,https://example.com,,"},
+		{name: "unknown format", method: http.MethodGet, query: "?format=xml", expectedStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			h.Export(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+				assert.Contains(t, w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestDumpHandlerImport(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		query          string
+		body           string
+		expectedStatus int
+		expectedStats  dump.Stats
+	}{
+		{
+			name:           "jsonl",
+			method:         http.MethodPost,
+			body:           `{"short_url":"new","orig_url":"https://new.example"}`,
+			expectedStatus: http.StatusOK,
+			expectedStats:  dump.Stats{Imported: 1},
+		},
+		{
+			name:           "csv with skip",
+			method:         http.MethodPost,
+			query:          "?format=csv&on_conflict=skip",
+			body:           "short_url,orig_url\nabc,https://other.example\nnew,https://new.example\n",
+			expectedStatus: http.StatusOK,
+			expectedStats:  dump.Stats{Imported: 1, Skipped: 1},
+		},
+		{
+			name:           "conflict",
+			method:         http.MethodPost,
+			body:           `{"short_url":"new","orig_url":"https://new.example"}` + "\n" + `{"short_url":"abc","orig_url":"https://other.example"}`,
+			expectedStatus: http.StatusConflict,
+			expectedStats:  dump.Stats{Imported: 1},
+		},
+		{
+			name:           "disabled link with skip",
+			method:         http.MethodPost,
+			query:          "?on_conflict=skip",
+			body:           `{"short_url":"off","orig_url":"https://off.example"}` + "\n" + `{"short_url":"new","orig_url":"https://new.example"}`,
+			expectedStatus: http.StatusOK,
+			expectedStats:  dump.Stats{Imported: 1, Skipped: 1},
+		},
+		{
+			name:           "disabled link",
+			method:         http.MethodPost,
+			body:           `{"short_url":"off","orig_url":"https://off.example"}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{name: "malformed", method: http.MethodPost, body: `{"short_url":`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid record", method: http.MethodPost, body: `{"short_url":"x"}`, expectedStatus: http.StatusBadRequest},
+		{name: "unknown policy", method: http.MethodPost, query: "?on_conflict=merge", expectedStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodGet, expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := memory.NewMemoryStorage()
+			require.NoError(t, err)
+			require.NoError(t, store.Save(context.Background(), "abc", "https://example.com"))
+			require.NoError(t, store.PutRecord(context.Background(), storage.Record{ShortURL: "off", OrigURL: "https://off.example", Disabled: true}))
+			h := NewDumpHandler(store)
+
+			req := httptest.NewRequest(tt.method, "/admin/import"+tt.query, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			h.Import(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if w.Header().Get("Content-Type") != "application/json" {
+				return
+			}
+			var resp ImportResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.expectedStats, resp.Stats)
+			assert.Equal(t, tt.expectedStatus != http.StatusOK, resp.Error != "")
+
+			_, err = store.Get(context.Background(), "new")
+			if tt.expectedStats.Imported > 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, storage.ErrNotFound)
+			}
+		})
+	}
+}
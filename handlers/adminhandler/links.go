@@ -0,0 +1,230 @@
+package adminhandler
+
+import (
+	"encoding/json"
+	"local/handlers/httperr"
+	"local/internal/storage"
+	"local/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Ограничения размера страницы GET /admin/links.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// actorAdmin записывается в историю ссылки, когда адрес меняет администратор.
+const actorAdmin = "admin"
+
+// Link — ссылка в ответах /admin/links. Хеш пароля не отдаётся: достаточно
+// знать, что пароль есть. Запись целиком, с хешем, выгружает только
+// /admin/export, чтобы ссылку можно было восстановить.
+type Link struct {
+	ShortURL  string    `json:"short_url"`
+	OrigURL   string    `json:"orig_url"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Disabled  bool      `json:"disabled"`
+	Preview   bool      `json:"preview"`
+	Protected bool      `json:"protected"`
+}
+
+func newLink(rec storage.Record) Link {
+	return Link{
+		ShortURL:  rec.ShortURL,
+		OrigURL:   rec.OrigURL,
+		Owner:     rec.Owner,
+		CreatedAt: rec.CreatedAt,
+		ExpiresAt: rec.ExpiresAt,
+		Disabled:  rec.Disabled,
+		Preview:   rec.Preview,
+		Protected: rec.Protected(),
+	}
+}
+
+// ListResponse — страница GET /admin/links. Next — значение параметра after
+// для следующей страницы; пустое, если страниц больше нет.
+type ListResponse struct {
+	Links []Link `json:"links"`
+	Next  string `json:"next,omitempty"`
+}
+
+// UpdateRequest — тело PATCH /admin/links/{code}. Отсутствующие поля не меняются.
+type UpdateRequest struct {
+	OrigURL  *string `json:"orig_url,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+	Preview  *bool   `json:"preview,omitempty"`
+}
+
+// LinksHandler управляет ссылками:
+//
+//	GET    /admin/links         список с фильтрами и постраничным выводом
+//	GET    /admin/links/{code}  ссылка с метаданными
+//	GET    /admin/links/{code}/history  прежние адреса ссылки
+//	PATCH  /admin/links/{code}  смена адреса, отключение, включение и предпросмотр
+//	DELETE /admin/links/{code}  удаление
+type LinksHandler struct {
+	store storage.Storage
+}
+
+func NewLinksHandler(store storage.Storage) *LinksHandler {
+	return &LinksHandler{store: store}
+}
+
+// List отдаёт ссылки в порядке короткого URL. Фильтры: owner, domain, q
+// (подстрока короткого или исходного URL), created_from и created_to
+// (RFC 3339 или ГГГГ-ММ-ДД, конец не включается), disabled (true/false).
+// Страница задаётся параметрами after и limit.
+func (h *LinksHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := storage.Filter{
+		Owner:  query.Get("owner"),
+		Domain: query.Get("domain"),
+		Search: query.Get("q"),
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseQueryTime(query.Get("created_from")); err != nil {
+		http.Error(w, "Invalid created_from", http.StatusBadRequest)
+		return
+	}
+	if filter.CreatedTo, err = parseQueryTime(query.Get("created_to")); err != nil {
+		http.Error(w, "Invalid created_to", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid disabled", http.StatusBadRequest)
+			return
+		}
+		filter.Disabled = &disabled
+	}
+	limit := defaultListLimit
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxListLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	links, err := h.store.List(r.Context(), filter, query.Get("after"), limit)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	resp := ListResponse{Links: make([]Link, 0, len(links))}
+	for _, rec := range links {
+		resp.Links = append(resp.Links, newLink(rec))
+	}
+	// Полная страница — возможно, есть следующая
+	if len(links) == limit {
+		resp.Next = links[len(links)-1].ShortURL
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// parseQueryTime разбирает время в RFC 3339 или дату; пустая строка — нулевое время.
+func parseQueryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+func (h *LinksHandler) Get(w http.ResponseWriter, r *http.Request) {
+	rec, err := h.store.GetRecord(r.Context(), r.PathValue("code"))
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newLink(rec))
+}
+
+func (h *LinksHandler) Update(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+		return
+	}
+	if req.OrigURL != nil && !storage.ValidURL(*req.OrigURL) {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+
+	var before storage.Record
+	rec, err := h.store.Update(r.Context(), code, actorAdmin, func(rec *storage.Record) error {
+		before = *rec
+		if req.OrigURL != nil {
+			rec.OrigURL = *req.OrigURL
+		}
+		if req.Disabled != nil {
+			rec.Disabled = *req.Disabled
+		}
+		if req.Preview != nil {
+			rec.Preview = *req.Preview
+		}
+		return nil
+	})
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Warnw("link updated",
+		"short_url", code,
+		"orig_url_from", before.OrigURL,
+		"orig_url_to", rec.OrigURL,
+		"disabled_from", before.Disabled,
+		"disabled_to", rec.Disabled,
+		"preview_from", before.Preview,
+		"preview_to", rec.Preview,
+	)
+	writeJSON(w, r, http.StatusOK, newLink(rec))
+}
+
+// History отдаёт прежние адреса ссылки от старых к новым.
+func (h *LinksHandler) History(w http.ResponseWriter, r *http.Request) {
+	history, err := h.store.History(r.Context(), r.PathValue("code"))
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, history)
+}
+
+func (h *LinksHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if err := h.store.Delete(r.Context(), code); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	logger.FromContext(r.Context()).Warnw("link deleted", "short_url", code)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeStorageError отвечает статусом, соответствующим ошибке хранилища.
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	status, msg := httperr.FromStorage(err)
+	if status >= http.StatusInternalServerError {
+		logger.FromContext(r.Context()).Errorw("storage error", "uri", r.RequestURI, "error", err)
+	}
+	http.Error(w, msg, status)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding JSON", err)
+	}
+}
@@ -0,0 +1,193 @@
+package adminhandler
+
+import (
+	"context"
+	"encoding/json"
+	"local/internal/storage"
+	"local/internal/storage/memory"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLinksMux регистрирует LinksHandler так же, как сервер.
+func newLinksMux(t *testing.T) (*http.ServeMux, storage.Storage) {
+	store, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	for i, rec := range []storage.Record{
+		{ShortURL: "abc", OrigURL: "https://example.com/a", Owner: "alice"},
+		{ShortURL: "def", OrigURL: "https://blog.example.org/b", Owner: "bob"},
+		{ShortURL: "ghi", OrigURL: "https://example.com/c", Owner: "alice", Disabled: true},
+	} {
+		rec.CreatedAt = time.Date(2024, 5, i+1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, store.PutRecord(context.Background(), rec))
+	}
+
+	h := NewLinksHandler(store)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/links", h.List)
+	mux.HandleFunc("GET /admin/links/{code}", h.Get)
+	mux.HandleFunc("GET /admin/links/{code}/history", h.History)
+	mux.HandleFunc("PATCH /admin/links/{code}", h.Update)
+	mux.HandleFunc("DELETE /admin/links/{code}", h.Delete)
+	return mux, store
+}
+
+func TestLinksHandlerList(t *testing.T) {
+	mux, _ := newLinksMux(t)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedLinks  []string
+		expectedNext   string
+	}{
+		{name: "all", expectedStatus: http.StatusOK, expectedLinks: []string{"abc", "def", "ghi"}},
+		{name: "first page", query: "?limit=2", expectedStatus: http.StatusOK, expectedLinks: []string{"abc", "def"}, expectedNext: "def"},
+		{name: "next page", query: "?limit=2&after=def", expectedStatus: http.StatusOK, expectedLinks: []string{"ghi"}},
+		{name: "owner", query: "?owner=alice", expectedStatus: http.StatusOK, expectedLinks: []string{"abc", "ghi"}},
+		{name: "domain", query: "?domain=example.org", expectedStatus: http.StatusOK, expectedLinks: []string{"def"}},
+		{name: "search", query: "?q=/c", expectedStatus: http.StatusOK, expectedLinks: []string{"ghi"}},
+		{name: "created range", query: "?created_from=2024-05-02&created_to=2024-05-03T00:00:00Z", expectedStatus: http.StatusOK, expectedLinks: []string{"def"}},
+		{name: "disabled", query: "?disabled=true", expectedStatus: http.StatusOK, expectedLinks: []string{"ghi"}},
+		{name: "nothing", query: "?owner=carol", expectedStatus: http.StatusOK, expectedLinks: []string{}},
+		{name: "invalid limit", query: "?limit=0", expectedStatus: http.StatusBadRequest},
+		{name: "limit too large", query: "?limit=100000", expectedStatus: http.StatusBadRequest},
+		{name: "invalid date", query: "?created_from=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "invalid disabled", query: "?disabled=maybe", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/links"+tt.query, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp ListResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			links := []string{}
+			for _, rec := range resp.Links {
+				links = append(links, rec.ShortURL)
+			}
+			assert.Equal(t, tt.expectedLinks, links)
+			assert.Equal(t, tt.expectedNext, resp.Next)
+		})
+	}
+}
+
+func TestLinksHandlerGet(t *testing.T) {
+	mux, _ := newLinksMux(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/links/ghi", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"short_url":"ghi","orig_url":"https://example.com/c","owner":"alice",
+		"created_at":"2024-05-03T00:00:00Z","disabled":true,"preview":false,"protected":false}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/links/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestLinksHandlerHidesPasswordHash(t *testing.T) {
+	mux, store := newLinksMux(t)
+	const hash = "$2a$10$abcdefghijklmnopqrstuu"
+	require.NoError(t, store.PutRecord(context.Background(), storage.Record{ShortURL: "pwd", OrigURL: "https://example.com/p", PasswordHash: hash}))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/links/pwd", nil),
+		httptest.NewRequest(http.MethodGet, "/admin/links?q=/p", nil),
+		httptest.NewRequest(http.MethodPatch, "/admin/links/pwd", strings.NewReader(`{"preview":true}`)),
+	} {
+		t.Run(req.Method+" "+req.URL.String(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"protected":true`)
+			assert.NotContains(t, w.Body.String(), "password_hash")
+			assert.NotContains(t, w.Body.String(), hash)
+		})
+	}
+}
+
+func TestLinksHandlerUpdate(t *testing.T) {
+	tests := []struct {
+		name           string
+		code           string
+		body           string
+		expectedStatus int
+		expectedURL    string
+		expectedErr    error
+	}{
+		{name: "change destination", code: "abc", body: `{"orig_url":"https://example.net/new"}`, expectedStatus: http.StatusOK, expectedURL: "https://example.net/new"},
+		{name: "disable", code: "abc", body: `{"disabled":true}`, expectedStatus: http.StatusOK, expectedErr: storage.ErrDisabled},
+		{name: "enable", code: "ghi", body: `{"disabled":false}`, expectedStatus: http.StatusOK, expectedURL: "https://example.com/c"},
+		{name: "always preview", code: "abc", body: `{"preview":true}`, expectedStatus: http.StatusOK, expectedURL: "https://example.com/a"},
+		{name: "empty patch", code: "abc", body: `{}`, expectedStatus: http.StatusOK, expectedURL: "https://example.com/a"},
+		{name: "relative url", code: "abc", body: `{"orig_url":"/local"}`, expectedStatus: http.StatusBadRequest, expectedURL: "https://example.com/a"},
+		{name: "bad json", code: "abc", body: `{`, expectedStatus: http.StatusBadRequest, expectedURL: "https://example.com/a"},
+		{name: "missing", code: "missing", body: `{"disabled":true}`, expectedStatus: http.StatusNotFound, expectedErr: storage.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, store := newLinksMux(t)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/admin/links/"+tt.code, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			long, err := store.Get(context.Background(), tt.code)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedURL, long)
+			}
+		})
+	}
+}
+
+func TestLinksHandlerHistory(t *testing.T) {
+	mux, _ := newLinksMux(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/admin/links/abc", strings.NewReader(`{"orig_url":"https://example.net/new"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/links/abc/history", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var history []storage.HistoryEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&history))
+	require.Len(t, history, 1)
+	assert.Equal(t, "https://example.com/a", history[0].OrigURL)
+	assert.Equal(t, "admin", history[0].Actor)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/links/missing/history", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestLinksHandlerDelete(t *testing.T) {
+	mux, store := newLinksMux(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/links/abc", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, err := store.GetRecord(context.Background(), "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/links/abc", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,133 @@
+package adminhandler
+
+import (
+	"encoding/json"
+	"local/logger"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LogLevelRequest — тело PUT /admin/loglevel.
+type LogLevelRequest struct {
+	Level string `json:"level"`
+	// Duration — через сколько вернуть предыдущий уровень, например "15m".
+	// Пустое значение означает постоянное изменение.
+	Duration string `json:"duration,omitempty"`
+}
+
+// LogLevelResponse — текущее состояние уровня логирования.
+type LogLevelResponse struct {
+	Level    string     `json:"level"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// LogLevelHandler показывает и меняет уровень логирования без перезапуска.
+type LogLevelHandler struct {
+	mu       sync.Mutex
+	timer    *time.Timer
+	revertAt *time.Time
+	// base — уровень до первого из идущих подряд временных изменений; к нему
+	// возвращается откат, даже если изменения наложились друг на друга.
+	base string
+	// gen растёт с каждым изменением, чтобы уже сработавший таймер
+	// не откатил более позднее изменение.
+	gen int
+}
+
+func NewLogLevelHandler() *LogLevelHandler {
+	return &LogLevelHandler{}
+}
+
+func (h *LogLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.writeState(w)
+	case http.MethodPut:
+		h.handlePut(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *LogLevelHandler) handlePut(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+		return
+	}
+
+	var revertAfter time.Duration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid duration", http.StatusBadRequest)
+			return
+		}
+		revertAfter = d
+	}
+
+	h.mu.Lock()
+	prev, err := logger.SetLevel(req.Level)
+	if err != nil {
+		h.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Новое изменение отменяет запланированный откат предыдущего, но
+	// временное изменение поверх временного откатывается к исходному уровню
+	base := prev.String()
+	h.gen++
+	if h.timer != nil {
+		h.timer.Stop()
+		base = h.base
+		h.timer, h.revertAt, h.base = nil, nil, ""
+	}
+	if revertAfter > 0 {
+		revertAt := time.Now().Add(revertAfter)
+		h.revertAt, h.base = &revertAt, base
+		gen := h.gen
+		h.timer = time.AfterFunc(revertAfter, func() { h.revert(gen, base) })
+	}
+	h.mu.Unlock()
+
+	// Запись об изменении пишется при любом новом уровне, даже error
+	logger.AuditLog.Warnw("log level changed",
+		"from", prev.String(),
+		"to", logger.Level().String(),
+		"revert_after", revertAfter,
+		"client", r.RemoteAddr,
+	)
+
+	h.writeState(w)
+}
+
+// revert возвращает уровень, действовавший до временного изменения.
+func (h *LogLevelHandler) revert(gen int, level string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if gen != h.gen {
+		return
+	}
+
+	prev, err := logger.SetLevel(level)
+	if err != nil {
+		logger.Log.Errorw("failed to revert log level", "level", level, "error", err)
+		return
+	}
+	h.timer, h.revertAt, h.base = nil, nil, ""
+	logger.AuditLog.Warnw("log level reverted", "from", prev.String(), "to", level)
+}
+
+func (h *LogLevelHandler) writeState(w http.ResponseWriter) {
+	h.mu.Lock()
+	resp := LogLevelResponse{Level: logger.Level().String(), RevertAt: h.revertAt}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Log.Error("Error encoding JSON", err)
+	}
+}
@@ -0,0 +1,140 @@
+package adminhandler
+
+import (
+	"encoding/json"
+	"local/logger"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	require.NoError(t, logger.InitLogger(logger.Options{Level: "info", Outputs: []string{"stderr"}}))
+	defer logger.CloseLogger()
+
+	handler := WithAuth("secret", NewLogLevelHandler())
+
+	tests := []struct {
+		name           string
+		method         string
+		token          string
+		body           string
+		expectedStatus int
+		expectedLevel  string
+	}{
+		{name: "no token", method: http.MethodGet, expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, token: "nope", expectedStatus: http.StatusUnauthorized},
+		{name: "get", method: http.MethodGet, token: "secret", expectedStatus: http.StatusOK, expectedLevel: "info"},
+		{name: "invalid level", method: http.MethodPut, token: "secret", body: `{"level":"verbose"}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid duration", method: http.MethodPut, token: "secret", body: `{"level":"debug","duration":"soon"}`, expectedStatus: http.StatusBadRequest},
+		{name: "set warn", method: http.MethodPut, token: "secret", body: `{"level":"warn"}`, expectedStatus: http.StatusOK, expectedLevel: "warn"},
+		{name: "wrong method", method: http.MethodPost, token: "secret", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/loglevel", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedLevel != "" {
+				var resp LogLevelResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.Equal(t, tt.expectedLevel, resp.Level)
+			}
+		})
+	}
+}
+
+func TestLogLevelHandlerRevert(t *testing.T) {
+	require.NoError(t, logger.InitLogger(logger.Options{Level: "info", Outputs: []string{"stderr"}}))
+	defer logger.CloseLogger()
+
+	handler := NewLogLevelHandler()
+	req := httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(`{"level":"debug","duration":"20ms"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp LogLevelResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.NotNil(t, resp.RevertAt)
+	assert.Equal(t, zapcore.DebugLevel, logger.Level())
+
+	assert.Eventually(t, func() bool {
+		return logger.Level() == zapcore.InfoLevel
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestLogLevelHandlerStackedRevert(t *testing.T) {
+	require.NoError(t, logger.InitLogger(logger.Options{Level: "info", Outputs: []string{"stderr"}}))
+	defer logger.CloseLogger()
+
+	handler := NewLogLevelHandler()
+	put := func(body string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// Второе временное изменение откатывается к уровню до первого, а не к debug
+	put(`{"level":"debug","duration":"1h"}`)
+	put(`{"level":"error","duration":"20ms"}`)
+	assert.Eventually(t, func() bool {
+		return logger.Level() == zapcore.InfoLevel
+	}, time.Second, 5*time.Millisecond)
+
+	// Постоянное изменение становится новым исходным уровнем
+	put(`{"level":"debug","duration":"1h"}`)
+	put(`{"level":"warn"}`)
+	put(`{"level":"error","duration":"20ms"}`)
+	assert.Eventually(t, func() bool {
+		return logger.Level() == zapcore.WarnLevel
+	}, time.Second, 5*time.Millisecond)
+}
+
+// Запись об изменении уровня остаётся в логе, даже если новый уровень её отсекает.
+func TestLogLevelHandlerAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, logger.InitLogger(logger.Options{Level: "info", Outputs: []string{path}}))
+	defer logger.CloseLogger()
+
+	handler := NewLogLevelHandler()
+	for _, level := range []string{"error", "fatal"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(`{"level":"`+level+`"}`)))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	logger.Log.Warn("filtered out")
+	logger.CloseLogger()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"from": "info", "to": "error"`)
+	assert.Contains(t, string(data), `"from": "error", "to": "fatal"`)
+	assert.NotContains(t, string(data), "filtered out")
+}
+
+func TestWithAuthDisabled(t *testing.T) {
+	handler := WithAuth("", NewLogLevelHandler())
+	req := httptest.NewRequest(http.MethodGet, "/admin/loglevel", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,105 @@
+// Package authhandler опознаёт пользователей по подписанной cookie, чтобы
+// ссылки можно было привязать к их создателю.
+package authhandler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieName — имя cookie с идентификатором пользователя.
+const CookieName = "user_id"
+
+// cookieMaxAge — срок жизни cookie; он продлевается при каждом ответе с новой cookie.
+const cookieMaxAge = 365 * 24 * time.Hour
+
+type ctxKey struct{}
+
+// user — значение в контексте: идентификатор и признак, что он выдан этим запросом.
+type user struct {
+	id     string
+	issued bool
+}
+
+// WithUser кладёт в контекст запроса идентификатор пользователя из cookie.
+// Если cookie нет или подпись не сходится, пользователь получает новый
+// идентификатор и cookie с ним.
+func WithUser(secret []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := "", false
+		if c, err := r.Cookie(CookieName); err == nil {
+			id, ok = verify(secret, c.Value)
+		}
+		if !ok {
+			id = newID()
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    sign(secret, id),
+				Path:     "/",
+				MaxAge:   int(cookieMaxAge / time.Second),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, user{id: id, issued: !ok})))
+	})
+}
+
+// UserID возвращает идентификатор пользователя из контекста или пустую
+// строку, если запрос не прошёл через WithUser.
+func UserID(ctx context.Context) string {
+	u, _ := ctx.Value(ctxKey{}).(user)
+	return u.id
+}
+
+// NewUser сообщает, что идентификатор выдан этим же запросом: клиент пришёл
+// без действующей cookie, и своих ссылок у него ещё нет.
+func NewUser(ctx context.Context) bool {
+	u, _ := ctx.Value(ctxKey{}).(user)
+	return u.issued
+}
+
+// NewSecret возвращает случайный ключ подписи для запуска без настроенного.
+func NewSecret() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+// newID создаёт случайный идентификатор пользователя.
+func newID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// sign возвращает значение cookie: идентификатор и его HMAC-SHA256 через точку.
+func sign(secret []byte, id string) string {
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac(secret, id))
+}
+
+// verify проверяет подпись значения cookie и возвращает идентификатор.
+func verify(secret []byte, value string) (string, bool) {
+	id, signature, ok := strings.Cut(value, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac(secret, id)) {
+		return "", false
+	}
+	return id, true
+}
+
+func mac(secret []byte, id string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(id))
+	return h.Sum(nil)
+}
@@ -0,0 +1,66 @@
+package authhandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithUser(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	var got string
+	var isNew bool
+	h := WithUser(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = UserID(r.Context())
+		isNew = NewUser(r.Context())
+	}))
+
+	// Первый запрос получает новый идентификатор
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	issued := cookies[0]
+	assert.Equal(t, CookieName, issued.Name)
+	assert.True(t, issued.HttpOnly)
+	require.NotEmpty(t, got)
+	assert.True(t, isNew)
+	first := got
+
+	tests := []struct {
+		name        string
+		cookie      string
+		expectedNew bool
+	}{
+		{name: "valid cookie", cookie: issued.Value, expectedNew: false},
+		{name: "forged id", cookie: "someone-else" + issued.Value[len(first):], expectedNew: true},
+		{name: "signed by another secret", cookie: sign([]byte("fedcba9876543210"), first), expectedNew: true},
+		{name: "no signature", cookie: first, expectedNew: true},
+		{name: "garbage", cookie: "...", expectedNew: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(&http.Cookie{Name: CookieName, Value: tt.cookie})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedNew, isNew)
+			if tt.expectedNew {
+				assert.NotEqual(t, first, got)
+				assert.Len(t, w.Result().Cookies(), 1)
+			} else {
+				assert.Equal(t, first, got)
+				assert.Empty(t, w.Result().Cookies())
+			}
+		})
+	}
+}
+
+func TestUserIDWithoutMiddleware(t *testing.T) {
+	assert.Empty(t, UserID(httptest.NewRequest(http.MethodGet, "/", nil).Context()))
+}
@@ -0,0 +1,32 @@
+// Package httperr сопоставляет ошибки хранилища с HTTP-ответами, чтобы все
+// обработчики отвечали на них одинаково.
+package httperr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"local/internal/storage"
+)
+
+// FromStorage возвращает HTTP-статус и текст ответа для ошибки хранилища.
+// Неизвестные ошибки — это сбой хранилища, а не отсутствие ссылки, поэтому 500.
+func FromStorage(err error) (int, string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout, "Request timeout"
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound, "URL not found"
+	case errors.Is(err, storage.ErrDeleted), errors.Is(err, storage.ErrDisabled), errors.Is(err, storage.ErrExpired):
+		return http.StatusGone, "URL is no longer available"
+	case errors.Is(err, storage.ErrDuplicateURL):
+		return http.StatusConflict, "URL already has a short link"
+	case errors.Is(err, storage.ErrConflict):
+		return http.StatusConflict, "Short URL already exists"
+	case errors.Is(err, storage.ErrInvalid):
+		return http.StatusBadRequest, "Invalid URL"
+	default:
+		return http.StatusInternalServerError, "Internal server error"
+	}
+}
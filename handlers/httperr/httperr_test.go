@@ -0,0 +1,39 @@
+package httperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"local/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromStorage(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "not found", err: storage.ErrNotFound, status: http.StatusNotFound},
+		{name: "wrapped not found", err: fmt.Errorf("get: %w", storage.ErrNotFound), status: http.StatusNotFound},
+		{name: "deleted", err: storage.ErrDeleted, status: http.StatusGone},
+		{name: "disabled", err: storage.ErrDisabled, status: http.StatusGone},
+		{name: "expired", err: storage.ErrExpired, status: http.StatusGone},
+		{name: "conflict", err: storage.ErrConflict, status: http.StatusConflict},
+		{name: "duplicate url", err: storage.ErrDuplicateURL, status: http.StatusConflict},
+		{name: "invalid", err: storage.ErrInvalid, status: http.StatusBadRequest},
+		{name: "timeout", err: context.DeadlineExceeded, status: http.StatusRequestTimeout},
+		{name: "storage outage", err: errors.New("connection refused"), status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := FromStorage(tt.err)
+			assert.Equal(t, tt.status, status)
+		})
+	}
+}
@@ -1,21 +1,196 @@
 package loghandler
 
 import (
-	"time"
-	"net/http"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"local/logger"
+	"local/metrics"
+	"local/tracing"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// RequestIDHeader — заголовок, в котором передаётся идентификатор запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen ограничивает длину входящего X-Request-ID, чтобы клиент
+// не мог раздуть логи произвольными значениями.
+const maxRequestIDLen = 128
+
+// responseWriter запоминает код ответа и количество записанных байт.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// WithLog пишет access log и HTTP-метрики для каждого запроса и кладёт в контекст
+// логгер с request ID, который используют обработчики и хранилища. Заголовкам
+// прокси WithLog не доверяет: адрес клиента берётся из соединения.
 func WithLog(next http.Handler) http.Handler {
+	return NewWithLog(nil)(next)
+}
+
+// NewWithLog создаёт WithLog, который берёт адрес клиента из X-Forwarded-For
+// и X-Real-IP, если запрос пришёл от прокси из trusted.
+func NewWithLog(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return withLog(next, trusted)
+	}
+}
+
+func withLog(next http.Handler, trusted []netip.Prefix) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLen {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		log := logger.Log.With("request_id", requestID)
+		span := tracing.SpanFromContext(r.Context())
+		if sc := span.SpanContext(); sc.IsValid() {
+			log = log.With("trace_id", sc.TraceID.String())
+			span.SetAttribute("request_id", requestID)
+		}
+		ip := clientIP(r, trusted)
+		ctx := context.WithValue(logger.WithContext(r.Context(), log), ctxKey{}, ip)
+		r = r.WithContext(ctx)
+
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
 		duration := time.Since(start)
 
-		logger.Log.Debugw("request",
+		// Маршрут берём из шаблона mux, чтобы не плодить серии на каждый short URL
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		span.SetAttribute("http.status_code", rw.status)
+
+		status := strconv.Itoa(rw.status)
+		method := metricMethod(r.Method)
+		metrics.HTTPRequests.With(route, method, status).Inc()
+		metrics.HTTPRequestDuration.With(route, method, status).Observe(duration.Seconds())
+
+		log.Infow("request",
 			"uri", r.RequestURI,
 			"method", r.Method,
+			"status", rw.status,
+			"size", rw.size,
 			"duration", duration,
+			"client_ip", ip,
+			"user_agent", r.UserAgent(),
 		)
 	})
 }
+
+type ctxKey struct{}
+
+// ClientIP возвращает адрес клиента, определённый WithLog, или пустую строку,
+// если запрос прошёл мимо него.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxKey{}).(string)
+	return ip
+}
+
+// metricMethod сводит нестандартные методы к OTHER, чтобы клиент не мог
+// создавать новые серии метрик.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// newRequestID генерирует случайный идентификатор запроса.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// clientIP определяет адрес клиента. Заголовки X-Forwarded-For и X-Real-IP
+// может прислать кто угодно, поэтому они учитываются, только если соединение
+// пришло от доверенного прокси. X-Forwarded-For разбирается справа налево:
+// первый адрес, не принадлежащий доверенным прокси, и есть клиент.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+		hops := strings.Split(strings.Join(fwd, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			host = hop
+			if !isTrusted(hop, trusted) {
+				break
+			}
+		}
+		return host
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return host
+}
+
+// isTrusted сообщает, принадлежит ли адрес одному из доверенных прокси.
+func isTrusted(host string, trusted []netip.Prefix) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
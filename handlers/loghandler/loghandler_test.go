@@ -0,0 +1,107 @@
+package loghandler
+
+import (
+	"local/logger"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWithLog(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	prev := logger.Log
+	logger.Log = zap.New(core).Sugar()
+	defer func() { logger.Log = prev }()
+
+	var ip string
+	handler := WithLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Обработчик пишет через логгер из контекста запроса
+		logger.FromContext(r.Context()).Info("inside handler")
+		ip = ClientIP(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short"))
+	}))
+
+	tests := []struct {
+		name      string
+		requestID string
+	}{
+		{name: "generated request ID", requestID: ""},
+		{name: "propagated request ID", requestID: "abc-123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.TakeAll()
+
+			req := httptest.NewRequest(http.MethodGet, "/Ph-VaNhL", nil)
+			req.Header.Set("User-Agent", "test-agent")
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			assert.NotEmpty(t, requestID)
+			if tt.requestID != "" {
+				assert.Equal(t, tt.requestID, requestID)
+			}
+
+			entries := logs.All()
+			if assert.Len(t, entries, 2) {
+				assert.Equal(t, requestID, entries[0].ContextMap()["request_id"])
+
+				access := entries[1].ContextMap()
+				assert.Equal(t, requestID, access["request_id"])
+				assert.EqualValues(t, http.StatusTeapot, access["status"])
+				assert.EqualValues(t, len("short"), access["size"])
+				assert.Equal(t, "192.0.2.1", access["client_ip"])
+				assert.Equal(t, "192.0.2.1", ip, "the handler sees the same client address")
+				assert.Equal(t, "test-agent", access["user_agent"])
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		trusted    []netip.Prefix
+		forwarded  []string
+		realIP     string
+		expected   string
+	}{
+		{name: "no proxy", remoteAddr: "203.0.113.5:4321", trusted: trusted, expected: "203.0.113.5"},
+		{name: "headers ignored without trusted proxies", remoteAddr: "192.0.2.1:1234", forwarded: []string{"198.51.100.7"}, realIP: "198.51.100.8", expected: "192.0.2.1"},
+		{name: "spoofed by untrusted client", remoteAddr: "203.0.113.5:4321", trusted: trusted, forwarded: []string{"198.51.100.7"}, realIP: "198.51.100.8", expected: "203.0.113.5"},
+		{name: "forwarded by trusted proxy", remoteAddr: "192.0.2.1:1234", trusted: trusted, forwarded: []string{"198.51.100.7"}, expected: "198.51.100.7"},
+		{name: "client prepends fake hop", remoteAddr: "192.0.2.1:1234", trusted: trusted, forwarded: []string{"1.1.1.1, 198.51.100.7"}, expected: "198.51.100.7"},
+		{name: "chain of trusted proxies", remoteAddr: "192.0.2.1:1234", trusted: trusted, forwarded: []string{"1.1.1.1, 198.51.100.7", "10.1.2.3"}, expected: "198.51.100.7"},
+		{name: "real IP from trusted proxy", remoteAddr: "10.0.0.2:1234", trusted: trusted, realIP: "198.51.100.8", expected: "198.51.100.8"},
+		{name: "IPv4-mapped remote address", remoteAddr: "[::ffff:10.0.0.2]:1234", trusted: trusted, realIP: "198.51.100.8", expected: "198.51.100.8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			assert.Equal(t, tt.expected, clientIP(req, tt.trusted))
+		})
+	}
+}
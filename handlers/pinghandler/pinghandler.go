@@ -1,36 +1,48 @@
 package pinghandler
 
 import (
-	"local/internal/db"
-	"local/internal/storage"
+	"context"
 	"local/logger"
 	"net/http"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// pingTimeout ограничивает проверку хранилища, чтобы /ping отвечал быстро.
+const pingTimeout = 3 * time.Second
+
+// DBPinger — хранилище, умеющее проверять соединение с базой данных.
+type DBPinger interface {
+	Ping(ctx context.Context) error
+}
+
 type PingHandler struct {
-   db storage.Storage
+	db DBPinger
 }
 
-func NewPingHandler(db storage.Storage) *PingHandler {
-   return &PingHandler{
-   	db: storage.Storage
-   }
+func NewPingHandler(db DBPinger) *PingHandler {
+	return &PingHandler{
+		db: db,
+	}
 }
 
 func (p *PingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-   if r.Method != http.MethodGet {
-   	logger.Log.Warn("Method not allowed", zap.String("method", r.Method))
-   	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-   	return
-   }
-   if err := p.dbConnector.PingDataBase(); err != nil {
-   	logger.Log.Error("Failed to ping database", zap.Error(err))
-   	http.Error(w, err.Error(), http.StatusInternalServerError)
-   	return
-   }
-   logger.Log.Info("Ping successful")
-   w.WriteHeader(http.StatusOK)
-   w.Write([]byte("OK"))
+	log := logger.FromContext(r.Context())
+	if r.Method != http.MethodGet {
+		log.Warn("Method not allowed", zap.String("method", r.Method))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+	if err := p.db.Ping(ctx); err != nil {
+		log.Error("Failed to ping database", zap.Error(err))
+		http.Error(w, "Storage unavailable", http.StatusInternalServerError)
+		return
+	}
+	log.Debug("Ping successful")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
 }
@@ -0,0 +1,37 @@
+package pinghandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func TestPingHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		status int
+	}{
+		{name: "ok", method: http.MethodGet, status: http.StatusOK},
+		{name: "storage down", method: http.MethodGet, err: errors.New("connection refused"), status: http.StatusInternalServerError},
+		{name: "wrong method", method: http.MethodPost, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewPingHandler(pingerFunc(func(context.Context) error { return tt.err }))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/ping", nil))
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
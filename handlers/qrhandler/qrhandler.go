@@ -0,0 +1,179 @@
+package qrhandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local/handlers/httperr"
+	"local/internal/qrcode"
+	"local/logger"
+	"local/tracing"
+
+	"go.uber.org/zap"
+)
+
+// Параметры запроса по умолчанию и их допустимые пределы.
+const (
+	defaultSize   = 256
+	minSize       = 32
+	maxSize       = 4096
+	defaultMargin = 4 // поле в 4 модуля требует стандарт
+	maxMargin     = 16
+	defaultLevel  = qrcode.Medium
+)
+
+// cacheMaxAge — сколько клиенты и прокси могут не перезапрашивать картинку.
+// Картинка зависит только от короткого URL, но ссылку могут удалить.
+const cacheMaxAge = 24 * time.Hour
+
+// URLGetter — хранилище, в котором проверяется, что ссылка существует.
+type URLGetter interface {
+	Get(ctx context.Context, shortURL string) (string, error)
+}
+
+// QRHandler отдаёт QR-код с полным коротким URL (GET /{id}/qr). Параметры:
+// format (png или svg), size (ширина в пикселях), ec (уровень коррекции
+// L, M, Q или H) и margin (поле в модулях).
+type QRHandler struct {
+	store URLGetter
+	// baseURL читается на каждый запрос: base URL меняется без перезапуска.
+	baseURL func() string
+}
+
+func NewQRHandler(store URLGetter, baseURL func() string) *QRHandler {
+	return &QRHandler{store: store, baseURL: baseURL}
+}
+
+// options — разобранные параметры запроса.
+type options struct {
+	format string
+	size   int
+	margin int
+	level  qrcode.Level
+}
+
+func (h *QRHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "HandleQR")
+	defer span.End()
+
+	log := logger.FromContext(r.Context())
+
+	shortURL := r.PathValue("id")
+	span.SetAttribute("short_url", shortURL)
+
+	opts, err := parseOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// QR-код на несуществующую ссылку печатать незачем
+	if _, err := h.store.Get(ctx, shortURL); err != nil {
+		span.RecordError(err)
+		status, msg := httperr.FromStorage(err)
+		if status >= http.StatusInternalServerError {
+			log.Error("error getting URL", zap.Error(err))
+		}
+		http.Error(w, msg, status)
+		return
+	}
+
+	content := strings.TrimSuffix(h.baseURL(), "/") + "/" + shortURL
+	etag := etagOf(content, opts)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cacheMaxAge/time.Second)))
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	code, err := qrcode.Encode([]byte(content), opts.level)
+	if err != nil {
+		log.Error("error encoding QR code", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttribute("qr.version", code.Version())
+
+	var buf bytes.Buffer
+	side := code.Size() + 2*opts.margin
+	switch opts.format {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = code.WriteSVG(&buf, opts.size, opts.margin)
+	default:
+		// Модуль — целое число пикселей, иначе края расплываются, поэтому
+		// картинка бывает чуть меньше запрошенной
+		w.Header().Set("Content-Type", "image/png")
+		err = code.WritePNG(&buf, max(opts.size/side, 1), opts.margin)
+	}
+	if err != nil {
+		log.Error("error rendering QR code", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+func parseOptions(r *http.Request) (options, error) {
+	query := r.URL.Query()
+	opts := options{format: "png", size: defaultSize, margin: defaultMargin, level: defaultLevel}
+
+	if v := query.Get("format"); v != "" {
+		if v != "png" && v != "svg" {
+			return opts, fmt.Errorf("invalid format %q: must be png or svg", v)
+		}
+		opts.format = v
+	}
+	if v := query.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minSize || n > maxSize {
+			return opts, fmt.Errorf("invalid size %q: must be between %d and %d", v, minSize, maxSize)
+		}
+		opts.size = n
+	}
+	if v := query.Get("margin"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxMargin {
+			return opts, fmt.Errorf("invalid margin %q: must be between 0 and %d", v, maxMargin)
+		}
+		opts.margin = n
+	}
+	if v := query.Get("ec"); v != "" {
+		level, err := qrcode.ParseLevel(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid error correction level %q: must be L, M, Q or H", v)
+		}
+		opts.level = level
+	}
+	return opts, nil
+}
+
+// etagOf строит ETag из всего, от чего зависит картинка.
+func etagOf(content string, opts options) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\n%s\n%d\n%d\n%s", content, opts.format, opts.size, opts.margin, opts.level))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch проверяет заголовок If-None-Match. Слабые ETag сравниваются как
+// сильные: для GET разницы нет.
+func etagMatch(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
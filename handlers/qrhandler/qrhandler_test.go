@@ -0,0 +1,138 @@
+package qrhandler
+
+import (
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"local/internal/storage"
+	"local/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newQRMux(t *testing.T) *http.ServeMux {
+	t.Helper()
+	store, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	require.NoError(t, store.Save(context.Background(), "abc", "https://example.com"))
+	require.NoError(t, store.PutRecord(context.Background(), storage.Record{ShortURL: "off", OrigURL: "https://example.org", Disabled: true}))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /{id}/qr", NewQRHandler(store, func() string { return "https://sho.rt/" }))
+	return mux
+}
+
+func TestQRHandler(t *testing.T) {
+	mux := newQRMux(t)
+
+	tests := []struct {
+		name                string
+		path                string
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{name: "png by default", path: "/abc/qr", expectedStatus: http.StatusOK, expectedContentType: "image/png"},
+		{name: "svg", path: "/abc/qr?format=svg", expectedStatus: http.StatusOK, expectedContentType: "image/svg+xml"},
+		{name: "all options", path: "/abc/qr?size=512&ec=H&margin=0", expectedStatus: http.StatusOK, expectedContentType: "image/png"},
+		{name: "unknown format", path: "/abc/qr?format=gif", expectedStatus: http.StatusBadRequest},
+		{name: "size too small", path: "/abc/qr?size=8", expectedStatus: http.StatusBadRequest},
+		{name: "size not a number", path: "/abc/qr?size=big", expectedStatus: http.StatusBadRequest},
+		{name: "negative margin", path: "/abc/qr?margin=-1", expectedStatus: http.StatusBadRequest},
+		{name: "unknown level", path: "/abc/qr?ec=X", expectedStatus: http.StatusBadRequest},
+		{name: "missing link", path: "/missing/qr", expectedStatus: http.StatusNotFound},
+		{name: "disabled link", path: "/off/qr", expectedStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedContentType == "" {
+				return
+			}
+			assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+			assert.NotEmpty(t, w.Header().Get("ETag"))
+			assert.NotEmpty(t, w.Body.Bytes())
+		})
+	}
+}
+
+func TestQRHandlerSize(t *testing.T) {
+	mux := newQRMux(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/qr?size=300", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	img, err := png.Decode(w.Body)
+	require.NoError(t, err)
+	// «https://sho.rt/abc» помещается в версию 2 (25 модулей) с полем 4:
+	// 33 модуля по 9 пикселей
+	assert.Equal(t, 297, img.Bounds().Dx())
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/qr?format=svg&size=300", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `width="300"`)
+}
+
+func TestQRHandlerETag(t *testing.T) {
+	mux := newQRMux(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/qr", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.True(t, strings.HasPrefix(etag, `"`))
+
+	tests := []struct {
+		name           string
+		path           string
+		ifNoneMatch    string
+		expectedStatus int
+	}{
+		{name: "same image", path: "/abc/qr", ifNoneMatch: etag, expectedStatus: http.StatusNotModified},
+		{name: "weak and listed", path: "/abc/qr", ifNoneMatch: `"other", W/` + etag, expectedStatus: http.StatusNotModified},
+		{name: "other options", path: "/abc/qr?ec=H", ifNoneMatch: etag, expectedStatus: http.StatusOK},
+		{name: "stale etag", path: "/abc/qr", ifNoneMatch: `"stale"`, expectedStatus: http.StatusOK},
+		{name: "deleted link is not served from cache", path: "/missing/qr", ifNoneMatch: "*", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusNotModified {
+				assert.Empty(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestQRHandlerLiveBaseURL(t *testing.T) {
+	store, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	require.NoError(t, store.Save(context.Background(), "abc", "https://example.com"))
+
+	baseURL := "https://sho.rt"
+	h := NewQRHandler(store, func() string { return baseURL })
+	mux := http.NewServeMux()
+	mux.Handle("GET /{id}/qr", h)
+	opts := options{format: "png", size: defaultSize, margin: defaultMargin, level: defaultLevel}
+
+	// Новый base URL попадает в картинку без пересоздания обработчика
+	for _, base := range []string{"https://sho.rt", "https://new.example/"} {
+		baseURL = base
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc/qr", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, etagOf(strings.TrimSuffix(base, "/")+"/abc", opts), w.Header().Get("ETag"))
+	}
+}
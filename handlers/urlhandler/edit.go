@@ -0,0 +1,151 @@
+package urlhandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"local/handlers/authhandler"
+	"local/handlers/httperr"
+	"local/internal/storage"
+	"local/logger"
+	"local/tracing"
+
+	"go.uber.org/zap"
+)
+
+// UpdateRequest — тело PATCH /api/urls/{id}. Отсутствующие поля не меняются.
+type UpdateRequest struct {
+	OrigURL string `json:"orig_url,omitempty"`
+	// Preview включает или выключает страницу предпросмотра вместо редиректа.
+	Preview *bool `json:"preview,omitempty"`
+}
+
+// UpdateResponse — ответ на PATCH /api/urls/{id}.
+type UpdateResponse struct {
+	ShortURL string `json:"short_url"`
+	OrigURL  string `json:"orig_url"`
+	Preview  bool   `json:"preview"`
+}
+
+// errNotOwner отменяет изменение ссылки, если её меняет не владелец.
+var errNotOwner = errors.New("not the owner of the link")
+
+// HandleUpdate меняет адрес, на который ведёт ссылка, и флаг предпросмотра
+// (PATCH /api/urls/{id}). Менять ссылку может только её владелец; прежний
+// адрес остаётся в истории.
+func (h *URLHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "HandleUpdate")
+	defer span.End()
+
+	log := logger.FromContext(r.Context())
+
+	shortURL := r.PathValue("id")
+	span.SetAttribute("short_url", shortURL)
+
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+		return
+	}
+	if req.OrigURL == "" && req.Preview == nil {
+		http.Error(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+	if req.OrigURL != "" && !storage.ValidURL(req.OrigURL) {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+
+	user := authhandler.UserID(r.Context())
+	var previous string
+	rec, err := h.storage.Update(ctx, shortURL, user, func(rec *storage.Record) error {
+		if !ownedBy(*rec, user) {
+			return errNotOwner
+		}
+		previous = rec.OrigURL
+		if req.OrigURL != "" {
+			rec.OrigURL = req.OrigURL
+		}
+		if req.Preview != nil {
+			rec.Preview = *req.Preview
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		writeError(w, r, err)
+		return
+	}
+	log.Info("link updated",
+		zap.String("short_url", shortURL),
+		zap.String("from", previous),
+		zap.String("to", rec.OrigURL),
+		zap.Bool("preview", rec.Preview),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(UpdateResponse{ShortURL: rec.ShortURL, OrigURL: rec.OrigURL, Preview: rec.Preview}); err != nil {
+		log.Error("Error encoding JSON", zap.Error(err))
+	}
+}
+
+// HandleHistory отдаёт владельцу прежние адреса ссылки от старых к новым
+// (GET /api/urls/{id}/history).
+func (h *URLHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "HandleHistory")
+	defer span.End()
+
+	shortURL := r.PathValue("id")
+	span.SetAttribute("short_url", shortURL)
+
+	rec, err := h.storage.GetRecord(ctx, shortURL)
+	if err == nil && !ownedBy(rec, authhandler.UserID(r.Context())) {
+		err = errNotOwner
+	}
+	var history []storage.HistoryEntry
+	if err == nil {
+		history, err = h.storage.History(ctx, shortURL)
+	}
+	if err != nil {
+		span.RecordError(err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding JSON", zap.Error(err))
+	}
+}
+
+// ownedBy сообщает, принадлежит ли ссылка пользователю. Ссылки без владельца,
+// созданные до появления владельцев, может менять только администратор.
+func ownedBy(rec storage.Record, user string) bool {
+	return rec.Owner != "" && rec.Owner == user
+}
+
+// writeError отвечает на ошибку изменения ссылки.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	log := logger.FromContext(r.Context())
+	if errors.Is(err, errNotOwner) {
+		log.Info("access denied", zap.Error(err))
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	status, msg := httperr.FromStorage(err)
+	if status >= http.StatusInternalServerError {
+		log.Error("storage error", zap.Error(err))
+	} else {
+		log.Info(msg, zap.Error(err))
+	}
+	http.Error(w, msg, status)
+}
@@ -0,0 +1,139 @@
+package urlhandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"local/handlers/authhandler"
+	"local/internal/storage"
+	"local/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEditServer регистрирует обработчики за authhandler.WithUser, как сервер,
+// и создаёт ссылку abc от имени пользователя, чья cookie возвращается.
+func newEditServer(t *testing.T) (http.Handler, storage.Storage, *http.Cookie) {
+	t.Helper()
+	store, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	h := NewURLHandler(store, testGenerator)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/shorten", h.HandlePost)
+	mux.HandleFunc("PATCH /api/urls/{id}", h.HandleUpdate)
+	mux.HandleFunc("GET /api/urls/{id}/history", h.HandleHistory)
+	handler := authhandler.WithUser([]byte("0123456789abcdef"), mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader("url=https%3A%2F%2Fexample.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	// Ссылка без владельца, как у созданных до появления владельцев
+	require.NoError(t, store.PutRecord(context.Background(), storage.Record{ShortURL: "old", OrigURL: "https://example.net"}))
+	return handler, store, cookies[0]
+}
+
+func TestHandleUpdate(t *testing.T) {
+	tests := []struct {
+		name            string
+		code            string
+		body            string
+		owner           bool
+		status          int
+		expectedURL     string
+		expectedPreview bool
+	}{
+		{name: "owner", code: "abc", body: `{"orig_url":"https://example.com/new"}`, owner: true, status: http.StatusOK, expectedURL: "https://example.com/new"},
+		{name: "someone else", code: "abc", body: `{"orig_url":"https://evil.example"}`, status: http.StatusForbidden, expectedURL: "https://example.com"},
+		{name: "link without owner", code: "old", body: `{"orig_url":"https://evil.example"}`, owner: true, status: http.StatusForbidden, expectedURL: "https://example.net"},
+		{name: "missing", code: "missing", body: `{"orig_url":"https://example.com/new"}`, owner: true, status: http.StatusNotFound},
+		{name: "relative url", code: "abc", body: `{"orig_url":"/local"}`, owner: true, status: http.StatusBadRequest, expectedURL: "https://example.com"},
+		{name: "bad json", code: "abc", body: `{`, owner: true, status: http.StatusBadRequest, expectedURL: "https://example.com"},
+		{name: "always preview", code: "abc", body: `{"preview":true}`, owner: true, status: http.StatusOK, expectedURL: "https://example.com", expectedPreview: true},
+		{name: "nothing to update", code: "abc", body: `{}`, owner: true, status: http.StatusBadRequest, expectedURL: "https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, store, cookie := newEditServer(t)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/urls/"+tt.code, strings.NewReader(tt.body))
+			if tt.owner {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+
+			if tt.status == http.StatusOK {
+				var resp UpdateResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, UpdateResponse{ShortURL: tt.code, OrigURL: tt.expectedURL, Preview: tt.expectedPreview}, resp)
+			}
+			if tt.expectedURL != "" {
+				rec, err := store.GetRecord(context.Background(), tt.code)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedURL, rec.OrigURL)
+				assert.Equal(t, tt.expectedPreview, rec.Preview)
+			}
+		})
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	handler, _, cookie := newEditServer(t)
+
+	for _, dest := range []string{"https://example.com/2", "https://example.com/3"} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/urls/abc", strings.NewReader(`{"orig_url":"`+dest+`"}`))
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/urls/abc/history", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var history []storage.HistoryEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history, 2)
+	assert.Equal(t, "https://example.com", history[0].OrigURL)
+	assert.Equal(t, "https://example.com/2", history[1].OrigURL)
+	owner, _, _ := strings.Cut(cookie.Value, ".")
+	assert.Equal(t, owner, history[0].Actor)
+	assert.False(t, history[0].ChangedAt.IsZero())
+
+	tests := []struct {
+		name   string
+		path   string
+		owner  bool
+		status int
+	}{
+		{name: "someone else", path: "/api/urls/abc/history", status: http.StatusForbidden},
+		{name: "link without owner", path: "/api/urls/old/history", owner: true, status: http.StatusForbidden},
+		{name: "missing", path: "/api/urls/missing/history", owner: true, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.owner {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
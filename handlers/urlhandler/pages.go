@@ -0,0 +1,89 @@
+package urlhandler
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"local/logger"
+
+	"go.uber.org/zap"
+)
+
+// pages — HTML-страницы, которые видят посетители коротких ссылок. Общая
+// разметка вынесена в шаблоны head и foot. html/template экранирует данные
+// по контексту: в тексте как HTML, в href как URL, а адреса с опасной схемой
+// вроде javascript: заменяет безопасной заглушкой.
+var pages = template.Must(template.New("pages").Parse(`
+{{- define "head" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.}}</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:40rem;margin:4rem auto;padding:0 1rem;color:#222}
+.url{word-break:break-all;font-family:monospace;background:#f4f4f4;padding:.75rem;border-radius:4px}
+.meta{color:#666;font-size:.9rem}
+.error{color:#b91c1c}
+input{padding:.5rem;font-size:1rem}
+a.button,button{display:inline-block;margin-top:1rem;padding:.6rem 1.2rem;background:#2563eb;color:#fff;text-decoration:none;border:0;border-radius:4px;font-size:1rem}
+</style>
+</head>
+<body>
+{{- end}}
+
+{{- define "foot"}}
+</body>
+</html>
+{{end}}
+
+{{- define "preview"}}{{template "head" "Link preview"}}
+<h1>This link leads to</h1>
+<p class="url">{{.OrigURL}}</p>
+{{- if not .CreatedAt.IsZero}}
+<p class="meta">Created <time datetime="{{.CreatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.UTC.Format "January 2, 2006"}}</time></p>
+{{- end}}
+<a class="button" href="{{.OrigURL}}" rel="noopener noreferrer nofollow">Continue</a>
+{{- template "foot"}}{{end}}
+
+{{- define "password"}}{{template "head" "Password required"}}
+<h1>This link is protected</h1>
+<p>Enter the password to continue.</p>
+{{- with .Error}}
+<p class="error">{{.}}</p>
+{{- end}}
+<form method="post" action="/{{.ShortURL}}/unlock">
+<input type="password" name="password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+{{- template "foot"}}{{end}}
+`))
+
+// PageHeader называет страницу, которой сервер ответил вместо редиректа:
+// preview или password. По нему API-клиенты отличают страницы друг от друга,
+// не разбирая HTML.
+const PageHeader = "X-Link-Page"
+
+// writePage отвечает HTML-страницей name из pages.
+func writePage(w http.ResponseWriter, r *http.Request, name string, status int, data any) {
+	var buf bytes.Buffer
+	if err := pages.ExecuteTemplate(&buf, name, data); err != nil {
+		logger.FromContext(r.Context()).Error("error rendering page", zap.String("page", name), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Страницам не нужны скрипты, фреймы и Referer. Отправку формы CSP не
+	// ограничивает: после пароля браузер уходит на чужой адрес
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(PageHeader, name)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
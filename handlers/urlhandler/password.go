@@ -0,0 +1,228 @@
+package urlhandler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"local/handlers/loghandler"
+	"local/logger"
+	"local/metrics"
+	"local/tracing"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLen — bcrypt учитывает только первые 72 байта пароля; длинные
+// пароли отклоняются, чтобы хвост не оказался незаметно лишним.
+const maxPasswordLen = 72
+
+// Сколько неверных паролей допускается за окно одному клиенту для одной
+// ссылки и всем клиентам вместе. Счётчик по клиенту не даёт одному адресу
+// заблокировать ссылку для остальных, а общий ограничивает перебор с многих
+// адресов. Адрес клиента берётся из loghandler, который доверяет заголовкам
+// только от известных прокси.
+const (
+	unlockAttempts     = 5
+	unlockLinkAttempts = 100
+	unlockWindow       = time.Minute
+)
+
+var errPasswordTooLong = errors.New("password is too long")
+
+// hashPassword возвращает bcrypt-хеш пароля ссылки.
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLen {
+		return "", errPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// passwordPage — данные формы ввода пароля.
+type passwordPage struct {
+	ShortURL string
+	Error    string
+}
+
+// writePasswordForm отвечает формой ввода пароля для защищённой ссылки.
+func writePasswordForm(w http.ResponseWriter, r *http.Request, shortURL string, status int, msg string) {
+	writePage(w, r, "password", status, passwordPage{ShortURL: shortURL, Error: msg})
+}
+
+// HandleUnlock проверяет пароль защищённой ссылки (POST /{id}/unlock) и при
+// верном пароле перенаправляет на исходный URL. После unlockAttempts неверных
+// паролей ссылка не принимает попыток клиента до конца окна, а после
+// unlockLinkAttempts — попыток всех клиентов.
+func (h *URLHandler) HandleUnlock(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "HandleUnlock")
+	defer span.End()
+
+	log := logger.FromContext(r.Context())
+
+	shortURL := r.PathValue("id")
+	span.SetAttribute("short_url", shortURL)
+
+	rec, err := h.storage.GetRecord(ctx, shortURL)
+	if err == nil {
+		err = rec.Available(time.Now())
+	}
+	if err != nil {
+		span.RecordError(err)
+		writeError(w, r, err)
+		return
+	}
+
+	if rec.Protected() {
+		client := attemptKey(shortURL, clientAddr(r))
+		if wait, ok := h.allowUnlock(shortURL, client); !ok {
+			metrics.UnlockAttempts.With("limited").Inc()
+			log.Warn("too many password attempts", zap.String("short_url", shortURL))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writePasswordForm(w, r, shortURL, http.StatusTooManyRequests, "Too many attempts. Try again later.")
+			return
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(rec.PasswordHash), []byte(r.PostFormValue("password")))
+		if err != nil {
+			if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				log.Error("error checking password", zap.String("short_url", shortURL), zap.Error(err))
+			}
+			metrics.UnlockAttempts.With("wrong").Inc()
+			log.Info("wrong password", zap.String("short_url", shortURL))
+			writePasswordForm(w, r, shortURL, http.StatusForbidden, "Wrong password.")
+			return
+		}
+		h.attempts.succeed(client)
+		h.linkAttempts.succeed(shortURL)
+		metrics.UnlockAttempts.With("ok").Inc()
+	}
+
+	if rec.Preview {
+		writePreview(w, r, rec)
+		return
+	}
+	// 303: браузер переходит по адресу запросом GET, а не повторяет POST
+	w.Header().Set("Location", rec.OrigURL)
+	w.WriteHeader(http.StatusSeeOther)
+	metrics.Redirects.With().Inc()
+	log.Info("redirection", zap.String("to", rec.OrigURL))
+}
+
+// allowUnlock учитывает попытку и по клиенту, и по ссылке. Если не пускает
+// общий лимит ссылки, попытка клиента возвращается: он её не сделал.
+func (h *URLHandler) allowUnlock(shortURL, client string) (time.Duration, bool) {
+	if wait, ok := h.attempts.allow(client); !ok {
+		return wait, false
+	}
+	if wait, ok := h.linkAttempts.allow(shortURL); !ok {
+		h.attempts.succeed(client)
+		return wait, false
+	}
+	return 0, true
+}
+
+// clientAddr — адрес клиента из loghandler или, если запрос прошёл мимо
+// него, адрес соединения.
+func clientAddr(r *http.Request) string {
+	if ip := loghandler.ClientIP(r.Context()); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// attemptKey — ключ попыток клиента для ссылки. Нулевой байт не встречается
+// ни в коде ссылки, ни в адресе.
+func attemptKey(shortURL, client string) string {
+	return shortURL + "\x00" + client
+}
+
+// attemptLimiter считает попытки ввода пароля по ключу в окне, которое
+// начинается с первой попытки. Попытка учитывается до проверки пароля, иначе
+// параллельные запросы успели бы пройти проверку лимита, пока идёт bcrypt;
+// удачная попытка затем возвращается. Счётчики живут в памяти процесса: у
+// каждого экземпляра сервиса они свои.
+type attemptLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]attempts
+}
+
+// attempts — попытки по ключу с начала окна.
+type attempts struct {
+	count int
+	since time.Time
+}
+
+// sweepThreshold — с какого количества ключей allow вычищает истёкшие окна.
+const sweepThreshold = 1024
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		limit:    limit,
+		window:   window,
+		now:      time.Now,
+		failures: make(map[string]attempts),
+	}
+}
+
+// allow учитывает попытку и сообщает, можно ли проверить пароль; если
+// нельзя — через сколько.
+func (l *attemptLimiter) allow(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.failures) >= sweepThreshold {
+		for k, a := range l.failures {
+			if !now.Before(a.since.Add(l.window)) {
+				delete(l.failures, k)
+			}
+		}
+	}
+	a, ok := l.failures[key]
+	if !ok || !now.Before(a.since.Add(l.window)) {
+		a = attempts{since: now}
+	}
+	if a.count >= l.limit {
+		return a.since.Add(l.window).Sub(now), false
+	}
+	a.count++
+	l.failures[key] = a
+	return 0, true
+}
+
+// succeed возвращает попытку, учтённую allow, если пароль оказался верным.
+func (l *attemptLimiter) succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.failures[key]
+	if !ok {
+		return
+	}
+	if a.count <= 1 {
+		delete(l.failures, key)
+		return
+	}
+	a.count--
+	l.failures[key] = a
+}
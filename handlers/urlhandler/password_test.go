@@ -0,0 +1,263 @@
+package urlhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"local/internal/storage"
+	"local/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newProtectedHandler создаёт обработчик с защищённой ссылкой abc (пароль
+// secret), такой же ссылкой с предпросмотром prv и открытой ссылкой pub.
+func newProtectedHandler(t *testing.T) *URLHandler {
+	t.Helper()
+	store, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	for _, rec := range []storage.Record{
+		{ShortURL: "abc", OrigURL: "https://example.com/doc", PasswordHash: string(hash)},
+		{ShortURL: "prv", OrigURL: "https://example.com/doc", PasswordHash: string(hash), Preview: true},
+		{ShortURL: "pub", OrigURL: "https://example.org"},
+	} {
+		require.NoError(t, store.PutRecord(context.Background(), rec))
+	}
+	return NewURLHandler(store, testGenerator)
+}
+
+func unlock(h *URLHandler, code, password string) *httptest.ResponseRecorder {
+	return unlockFrom(h, "192.0.2.1:1234", code, password)
+}
+
+// unlockFrom вводит пароль с адреса remoteAddr.
+func unlockFrom(h *URLHandler, remoteAddr, code, password string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{id}/unlock", h.HandleUnlock)
+	req := httptest.NewRequest(http.MethodPost, "/"+code+"/unlock", strings.NewReader(url.Values{"password": {password}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlePostPassword(t *testing.T) {
+	mem, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	h := NewURLHandler(mem, &sequenceGenerator{})
+
+	post := func(contentType, body string) (int, []URLRequest) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.HandlePost(w, req)
+		var resp []URLRequest
+		if w.Code == http.StatusCreated {
+			require.NotContains(t, w.Body.String(), "password")
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w.Code, resp
+	}
+
+	_, public := post("application/x-www-form-urlencoded", "url=https%3A%2F%2Fexample.com")
+	_, protected := post("application/x-www-form-urlencoded", "url=https%3A%2F%2Fexample.com&password=secret")
+	_, again := post("application/json", `[{"orig_url":"https://example.com","password":"secret"}]`)
+	require.Len(t, protected, 1)
+	require.Len(t, again, 1)
+	assert.NotEqual(t, public[0].ShortURL, protected[0].ShortURL, "a protected link is never the public one")
+	assert.NotEqual(t, protected[0].ShortURL, again[0].ShortURL, "every protected link is new")
+
+	rec, err := mem.GetRecord(context.Background(), protected[0].ShortURL)
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(rec.PasswordHash), []byte("secret")))
+
+	// Открытая ссылка по-прежнему переиспользуется
+	_, third := post("application/x-www-form-urlencoded", "url=https%3A%2F%2Fexample.com")
+	assert.Equal(t, public, third)
+
+	status, _ := post("application/json", `[{"orig_url":"https://example.com","password":"`+strings.Repeat("x", maxPasswordLen+1)+`"}]`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestHandleGetProtected(t *testing.T) {
+	h := newProtectedHandler(t)
+
+	for _, path := range []string{"/abc", "/abc+", "/abc?preview=1", "/prv"} {
+		t.Run(path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.HandleGet(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("Location"))
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, "password", w.Header().Get(PageHeader))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			assert.Contains(t, w.Body.String(), `type="password"`)
+			assert.NotContains(t, w.Body.String(), "example.com", "the destination is hidden until unlocked")
+		})
+	}
+}
+
+func TestHandleUnlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		password string
+		status   int
+		location string
+		contains string
+	}{
+		{name: "correct password", code: "abc", password: "secret", status: http.StatusSeeOther, location: "https://example.com/doc"},
+		{name: "wrong password", code: "abc", password: "guess", status: http.StatusForbidden, contains: "Wrong password."},
+		{name: "empty password", code: "abc", status: http.StatusForbidden, contains: "Wrong password."},
+		{name: "preview after password", code: "prv", password: "secret", status: http.StatusOK, contains: `href="https://example.com/doc"`},
+		{name: "link without password", code: "pub", status: http.StatusSeeOther, location: "https://example.org"},
+		{name: "missing", code: "missing", password: "secret", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := unlock(newProtectedHandler(t), tt.code, tt.password)
+
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+			assert.Contains(t, w.Body.String(), tt.contains)
+		})
+	}
+}
+
+func TestHandleUnlockRateLimit(t *testing.T) {
+	h := newProtectedHandler(t)
+	now := time.Now()
+	h.attempts.now = func() time.Time { return now }
+	h.linkAttempts.now = h.attempts.now
+
+	for range unlockAttempts {
+		assert.Equal(t, http.StatusForbidden, unlock(h, "abc", "guess").Code)
+	}
+
+	// Даже верный пароль не проверяется до конца окна
+	w := unlock(h, "abc", "secret")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Попытки считаются по ссылке и клиенту: другие ссылки и другие клиенты
+	// не заблокированы
+	assert.Equal(t, http.StatusOK, unlock(h, "prv", "secret").Code)
+	assert.Equal(t, http.StatusSeeOther, unlockFrom(h, "198.51.100.7:1234", "abc", "secret").Code)
+
+	now = now.Add(unlockWindow)
+	w = unlock(h, "abc", "secret")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+}
+
+func TestHandleUnlockLinkLimit(t *testing.T) {
+	h := newProtectedHandler(t)
+	now := time.Now()
+	h.attempts.now = func() time.Time { return now }
+	h.linkAttempts.now = h.attempts.now
+
+	// Перебор с многих адресов упирается в общий лимит ссылки
+	for i := range unlockLinkAttempts {
+		addr := fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+		require.Equal(t, http.StatusForbidden, unlockFrom(h, addr, "abc", "guess").Code)
+	}
+	w := unlockFrom(h, "198.51.100.7:1234", "abc", "secret")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Отказ по общему лимиту не расходует попытки клиента
+	assert.NotContains(t, h.attempts.failures, attemptKey("abc", "198.51.100.7"))
+
+	now = now.Add(unlockWindow)
+	assert.Equal(t, http.StatusSeeOther, unlockFrom(h, "198.51.100.7:1234", "abc", "secret").Code)
+}
+
+func TestHandleUnlockConcurrent(t *testing.T) {
+	store, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	// Настоящая стоимость bcrypt: проверка идёт долго, и все запросы успевают
+	// прийти, пока она не закончилась
+	hash, err := hashPassword("secret")
+	require.NoError(t, err)
+	require.NoError(t, store.PutRecord(context.Background(), storage.Record{ShortURL: "abc", OrigURL: "https://example.com", PasswordHash: hash}))
+	h := NewURLHandler(store, testGenerator)
+
+	// Пройти проверку лимита всё равно успевают не больше unlockAttempts
+	const requests = 4 * unlockAttempts
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- unlock(h, "abc", "guess").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{
+		http.StatusForbidden:       unlockAttempts,
+		http.StatusTooManyRequests: requests - unlockAttempts,
+	}, counts)
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(2, time.Minute)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	// Верный пароль возвращает попытку
+	_, ok := l.allow("k")
+	require.True(t, ok)
+	l.succeed("k")
+	_, ok = l.allow("k")
+	require.True(t, ok)
+	_, ok = l.allow("k")
+	require.True(t, ok)
+
+	now = now.Add(time.Second)
+	wait, ok := l.allow("k")
+	assert.False(t, ok)
+	assert.Equal(t, time.Minute-time.Second, wait)
+
+	now = now.Add(time.Minute)
+	_, ok = l.allow("k")
+	assert.True(t, ok, "a new window starts")
+}
+
+func TestAttemptLimiterSweep(t *testing.T) {
+	l := newAttemptLimiter(1, time.Minute)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := range sweepThreshold {
+		l.allow(strings.Repeat("k", i+1))
+	}
+	now = now.Add(time.Minute)
+	l.allow("fresh")
+	assert.Len(t, l.failures, 1, "expired windows are swept")
+	_, ok := l.allow("fresh")
+	assert.False(t, ok)
+	_, ok = l.allow("k")
+	assert.True(t, ok)
+}
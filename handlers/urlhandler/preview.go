@@ -0,0 +1,30 @@
+package urlhandler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"local/internal/storage"
+	"local/metrics"
+)
+
+// previewSuffix после короткого URL (GET /abc+) просит страницу предпросмотра
+// вместо редиректа. То же делает параметр preview=1.
+const previewSuffix = "+"
+
+// wantsPreview отделяет признак предпросмотра от короткого URL.
+func wantsPreview(r *http.Request, shortURL string) (string, bool) {
+	shortURL, suffix := strings.CutSuffix(shortURL, previewSuffix)
+	if suffix {
+		return shortURL, true
+	}
+	preview, _ := strconv.ParseBool(r.URL.Query().Get("preview"))
+	return shortURL, preview
+}
+
+// writePreview отвечает страницей предпросмотра ссылки.
+func writePreview(w http.ResponseWriter, r *http.Request, rec storage.Record) {
+	writePage(w, r, "preview", http.StatusOK, rec)
+	metrics.Previews.With().Inc()
+}
@@ -0,0 +1,82 @@
+package urlhandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"local/internal/storage"
+	"local/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetPreview(t *testing.T) {
+	s, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	created := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	records := []storage.Record{
+		{ShortURL: "abc", OrigURL: "https://example.com/path?a=1&b=2", CreatedAt: created},
+		{ShortURL: "flag", OrigURL: "https://example.org", Preview: true},
+		{ShortURL: "xss", OrigURL: `https://example.com/"><script>alert(1)</script>`},
+		{ShortURL: "js", OrigURL: "javascript:alert(1)"},
+		{ShortURL: "off", OrigURL: "https://example.net", Disabled: true},
+	}
+	for _, rec := range records {
+		require.NoError(t, s.PutRecord(context.Background(), rec))
+	}
+	h := NewURLHandler(s, testGenerator)
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		location    string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:   "plus suffix",
+			path:   "/abc+",
+			status: http.StatusOK,
+			contains: []string{
+				`<p class="url">https://example.com/path?a=1&amp;b=2</p>`,
+				`href="https://example.com/path?a=1&amp;b=2"`,
+				`datetime="2024-05-03T12:00:00Z">May 3, 2024</time>`,
+			},
+		},
+		{name: "query parameter", path: "/abc?preview=1", status: http.StatusOK, contains: []string{"Continue"}},
+		{name: "query parameter off", path: "/abc?preview=0", status: http.StatusTemporaryRedirect, location: "https://example.com/path?a=1&b=2"},
+		{name: "always preview", path: "/flag", status: http.StatusOK, contains: []string{`href="https://example.org"`}, notContains: []string{"Created"}},
+		{name: "markup is escaped", path: "/xss+", status: http.StatusOK, contains: []string{"&lt;script&gt;"}, notContains: []string{"<script>"}},
+		{name: "dangerous scheme is not linked", path: "/js+", status: http.StatusOK, notContains: []string{`href="javascript:`}},
+		{name: "missing", path: "/missing+", status: http.StatusNotFound},
+		{name: "disabled", path: "/off+", status: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.HandleGet(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+			if tt.status != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, "preview", w.Header().Get(PageHeader))
+			assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+			assert.Contains(t, w.Header().Get("Content-Security-Policy"), "default-src 'none'")
+			for _, s := range tt.contains {
+				assert.Contains(t, w.Body.String(), s)
+			}
+			for _, s := range tt.notContains {
+				assert.NotContains(t, w.Body.String(), s)
+			}
+		})
+	}
+}
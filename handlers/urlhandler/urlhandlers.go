@@ -1,165 +1,304 @@
 package urlhandler
 
 import (
-   "context"
-   "encoding/json"
-   "errors"
-   "net/http"
-   "strings"
-   "time"
-
-   "local/internal/storage/postgres"
-   "local/logger"
-
-   "go.uber.org/zap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"local/handlers/authhandler"
+	"local/handlers/httperr"
+	"local/internal/storage"
+	"local/logger"
+	"local/metrics"
+	"local/tracing"
+
+	"go.uber.org/zap"
 )
 
-// URLRequest представляет запрос на URL.
+// URLRequest представляет запрос на URL. Password — необязательный пароль:
+// ссылка с паролем открывается только после его ввода.
 type URLRequest struct {
-   ShortURL string `json:"short_url"`
-   OrigURL  string `json:"orig_url"`
+	ShortURL string `json:"short_url"`
+	OrigURL  string `json:"orig_url"`
+	Password string `json:"password,omitempty"`
 }
 
 func NewURLRequest(origURL string) *URLRequest {
 
-   return &URLRequest{
-   	ShortURL: "",
-   	OrigURL:  origURL,
-   }
+	return &URLRequest{
+		ShortURL: "",
+		OrigURL:  origURL,
+	}
 
 }
 
-
 // URLStorage — интерфейс для хранения URL.
 type URLStorage interface {
-   Get(ctx context.Context, shortURL string) (string, error)
-   Save(ctx context.Context, shortURL, origURL string) error
-   Close() error
-   FindByLongURL(ctx context.Context, shortURL string) (string, error)
+	Get(ctx context.Context, shortURL string) (string, error)
+	Save(ctx context.Context, shortURL, origURL string) error
+	Close() error
+	FindByLongURL(ctx context.Context, shortURL string) (string, error)
+	FindOwned(ctx context.Context, longURL, owner string) (string, error)
+	GetRecord(ctx context.Context, shortURL string) (storage.Record, error)
+	SaveRecord(ctx context.Context, rec storage.Record) error
+	Update(ctx context.Context, shortURL, actor string, fn func(*storage.Record) error) (storage.Record, error)
+	History(ctx context.Context, shortURL string) ([]storage.HistoryEntry, error)
 }
 
+// maxGenerateAttempts ограничивает попытки подобрать свободный короткий URL.
+// Генератор детерминированный, и код исходного URL может быть занят ссылкой,
+// адрес которой потом поменяли.
+const maxGenerateAttempts = 3
+
 // URLGenerator — интерфейс для генерации коротких URL.
 type URLGenerator interface {
-   GenerateShortURL(origURL string) (string, error)
+	GenerateShortURL(origURL string) (string, error)
 }
 
 // URLHandler — обработчик для работы с URL.
 type URLHandler struct {
-   storage      URLStorage
-   urlGenerator URLGenerator
+	storage      URLStorage
+	urlGenerator URLGenerator
+	attempts     *attemptLimiter // по ссылке и клиенту
+	linkAttempts *attemptLimiter // по ссылке
 }
 
 // NewURLHandler создает новый URLHandler.
 func NewURLHandler(storage URLStorage, urlGenerator URLGenerator) *URLHandler {
-   return &URLHandler{storage: storage, urlGenerator: urlGenerator}
+	return &URLHandler{
+		storage:      storage,
+		urlGenerator: urlGenerator,
+		attempts:     newAttemptLimiter(unlockAttempts, unlockWindow),
+		linkAttempts: newAttemptLimiter(unlockLinkAttempts, unlockWindow),
+	}
 }
 
-// HandleGet обрабатывает GET-запрос.
+// HandleGet обрабатывает GET-запрос: перенаправляет на исходный URL или, если
+// об этом просят запрос (GET /abc+, ?preview=1) или флаг ссылки, показывает
+// страницу предпросмотра. Для ссылки с паролем отдаёт форму его ввода.
 func (h *URLHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
-   ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-   defer cancel()
-
-   shortURL := strings.TrimPrefix(r.URL.Path, "/")
-   logger.Log.Info("shortURL", zap.String("shortURL", shortURL))
-   origUrl, err := h.storage.Get(ctx, shortURL)
-   if err != nil {
-   	if errors.Is(err, context.DeadlineExceeded) {
-   		http.Error(w, "Request timeout", http.StatusRequestTimeout)
-   	} else {
-   		logger.Log.Error("URL not found", zap.Error(err))
-   		http.Error(w, "URL not found", http.StatusNotFound)
-   	}
-   	return
-   }
-
-    w.Header().Set("Location", origUrl)
-    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-    w.WriteHeader(http.StatusTemporaryRedirect)
-    logger.Log.Info("redirection", zap.String("to", origUrl))
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "HandleGet")
+	defer span.End()
+
+	log := logger.FromContext(r.Context())
+
+	shortURL, preview := wantsPreview(r, strings.TrimPrefix(r.URL.Path, "/"))
+	span.SetAttribute("short_url", shortURL)
+	log.Info("shortURL", zap.String("shortURL", shortURL))
+	rec, err := h.storage.GetRecord(ctx, shortURL)
+	if err == nil {
+		err = rec.Available(time.Now())
+	}
+	if err != nil {
+		span.RecordError(err)
+		status, msg := httperr.FromStorage(err)
+		if status >= http.StatusInternalServerError {
+			log.Error("error getting URL", zap.Error(err))
+		} else {
+			log.Info(msg, zap.Error(err))
+		}
+		http.Error(w, msg, status)
+		return
+	}
+
+	// Предпросмотр показал бы адрес без пароля, поэтому форма — раньше него
+	if rec.Protected() {
+		writePasswordForm(w, r, shortURL, http.StatusOK, "")
+		log.Info("password required", zap.String("short_url", shortURL))
+		return
+	}
+	if preview || rec.Preview {
+		writePreview(w, r, rec)
+		log.Info("preview", zap.String("to", rec.OrigURL))
+		return
+	}
+
+	w.Header().Set("Location", rec.OrigURL)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusTemporaryRedirect)
+	metrics.Redirects.With().Inc()
+	log.Info("redirection", zap.String("to", rec.OrigURL))
 
 }
 func (h *URLHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
-   ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-   defer cancel()
-
-   defer func() {
-      if r.Body != nil {
-          r.Body.Close()
-      }
-   }()
-
-   var origUrl string
-   requestURLs := make([]URLRequest, 0)
-   responseURLs := make([]URLRequest, 0)
-
-   contentType := r.Header.Get("Content-Type")
-
-   // Обработка FormData
-   if contentType == "application/x-www-form-urlencoded" {
-   	err := r.ParseForm()
-   	if err != nil {
-   		http.Error(w, "Invalid form data", http.StatusBadRequest)
-   		return
-   	}
-   	origUrl = r.FormValue("url")
-   	if origUrl == "" {
-   		http.Error(w, "URL is required", http.StatusBadRequest)
-   		return
-   	}
-   	requestURLs = append(requestURLs, URLRequest{OrigURL: origUrl})
-
-   	// Обработка JSON
-   } else if contentType == "application/json" {
-   	dec := json.NewDecoder(r.Body)
-      
-   	if err := dec.Decode(&requestURLs); err != nil {
-   		http.Error(w, "Error decoding JSON", http.StatusBadRequest)
-   		return
-   	}
-   } else {
-   	http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
-   	return
-   }
-
-   // Создание сокращенных URL для каждого из запросов
-   for _, url := range requestURLs {
-   	shortURL, err := h.storage.FindByLongURL(ctx, url.OrigURL)
-   	if err != nil && !errors.Is(err, postgres.ErrURLNotFound) {
-   		http.Error(w, "Error checking for existing short URL", http.StatusInternalServerError)
-   		return
-   	}
-
-   	// Если короткий URL уже существует, добавляем его в ответ
-   	if shortURL != "" {
-   		responseURLs = append(responseURLs, URLRequest{ShortURL: shortURL, OrigURL: url.OrigURL})
-   	} else {
-   		shortURL, err = h.urlGenerator.GenerateShortURL(url.OrigURL)
-   		if err != nil && !errors.Is(err, postgres.ErrURLNotFound) {
-   			logger.Log.Error("Ошибка после функции", zap.Error(err), zap.String(url.OrigURL, shortURL))
-   		}
-
-   		responseURLs = append(responseURLs, URLRequest{ShortURL: shortURL, OrigURL: url.OrigURL})
-
-   		// Сохранение нового URL в базу данных
-   		err = h.storage.Save(ctx, shortURL, url.OrigURL)
-   		if err != nil {
-   			http.Error(w, "Error saving URL", http.StatusInternalServerError)
-   			return
-   		}
-   	}
-   }
-
-   // Ответ клиенту
-   w.Header().Set("Content-Type", contentType)
-   w.WriteHeader(http.StatusCreated)
-
-   err := json.NewEncoder(w).Encode(responseURLs)
-   if err != nil {
-   	logger.Log.Error("Error encoding JSON", zap.Error(err))
-   }
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "HandlePost")
+	defer span.End()
+
+	log := logger.FromContext(r.Context())
+
+	defer func() {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+	}()
+
+	var origUrl string
+	requestURLs := make([]URLRequest, 0)
+	responseURLs := make([]URLRequest, 0)
+
+	contentType := r.Header.Get("Content-Type")
+
+	// Обработка FormData
+	if contentType == "application/x-www-form-urlencoded" {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		origUrl = r.FormValue("url")
+		if origUrl == "" {
+			http.Error(w, "URL is required", http.StatusBadRequest)
+			return
+		}
+		requestURLs = append(requestURLs, URLRequest{OrigURL: origUrl, Password: r.FormValue("password")})
+
+		// Обработка JSON
+	} else if contentType == "application/json" {
+		dec := json.NewDecoder(r.Body)
+
+		if err := dec.Decode(&requestURLs); err != nil {
+			http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+			return
+		}
+	} else {
+		http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	span.SetAttribute("urls", len(requestURLs))
+	user := authhandler.UserID(r.Context())
+	newUser := authhandler.NewUser(r.Context())
+
+	// Создание сокращенных URL для каждого из запросов
+	for _, url := range requestURLs {
+		// Ссылку с паролем всегда создаём заново: готовую без пароля отдавать
+		// нельзя, а защищённые FindByLongURL не находит
+		var shortURL string
+		var foreign bool
+		var err error
+		if url.Password == "" {
+			shortURL, foreign, err = h.findReusable(ctx, url.OrigURL, user, newUser)
+			if err != nil {
+				span.RecordError(err)
+				log.Error("Error checking for existing short URL", zap.Error(err))
+				status, msg := httperr.FromStorage(err)
+				http.Error(w, msg, status)
+				return
+			}
+		}
+
+		// Если короткий URL уже существует, добавляем его в ответ
+		if shortURL != "" {
+			responseURLs = append(responseURLs, URLRequest{ShortURL: shortURL, OrigURL: url.OrigURL})
+		} else {
+			rec := storage.Record{OrigURL: url.OrigURL, Owner: user}
+			base := url.OrigURL
+			if foreign {
+				// Код из одного URL совпал бы с кодом чужой ссылки, поэтому
+				// у каждого пользователя своя ссылка на тот же адрес
+				base += "#owner:" + user
+			}
+			if url.Password != "" {
+				if rec.PasswordHash, err = hashPassword(url.Password); err != nil {
+					if errors.Is(err, errPasswordTooLong) {
+						http.Error(w, "Password is too long", http.StatusBadRequest)
+						return
+					}
+					log.Error("Error hashing password", zap.Error(err))
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				// В хеше случайная соль, поэтому у каждой защищённой ссылки
+				// свой код, не совпадающий с кодом ссылки без пароля
+				base += "#" + rec.PasswordHash
+			}
+			for attempt := range maxGenerateAttempts {
+				seed := base
+				if attempt > 0 {
+					seed = fmt.Sprintf("%s#%d", base, attempt)
+				}
+				rec.ShortURL, err = h.urlGenerator.GenerateShortURL(seed)
+				if err != nil {
+					log.Error("Ошибка генерации короткого URL", zap.Error(err), zap.String("url", url.OrigURL))
+					http.Error(w, "Invalid URL", http.StatusBadRequest)
+					return
+				}
+				// Сохранение нового URL в базу данных
+				if err = h.storage.SaveRecord(ctx, rec); !errors.Is(err, storage.ErrConflict) {
+					break
+				}
+				log.Info("short URL is taken", zap.String("short_url", rec.ShortURL))
+			}
+			if errors.Is(err, storage.ErrDuplicateURL) {
+				// Параллельный запрос того же пользователя успел создать ссылку
+				if existing, findErr := h.storage.FindOwned(ctx, url.OrigURL, user); findErr == nil {
+					responseURLs = append(responseURLs, URLRequest{ShortURL: existing, OrigURL: url.OrigURL})
+					continue
+				}
+			}
+			if err != nil {
+				span.RecordError(err)
+				log.Error("Error saving URL", zap.Error(err))
+				status, msg := httperr.FromStorage(err)
+				http.Error(w, msg, status)
+				return
+			}
+
+			responseURLs = append(responseURLs, URLRequest{ShortURL: rec.ShortURL, OrigURL: url.OrigURL})
+			metrics.LinksCreated.With().Inc()
+		}
+	}
+
+	// Ответ клиенту
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusCreated)
+
+	err := json.NewEncoder(w).Encode(responseURLs)
+	if err != nil {
+		log.Error("Error encoding JSON", zap.Error(err))
+	}
 }
 
+// findReusable ищет готовую ссылку на longURL, которую можно отдать user.
+// Владелец может перенаправить свою ссылку, поэтому сначала ищутся ссылки
+// самого user и ссылки без владельца. Клиент без cookie (newUser) или без
+// пользователя вовсе своих ссылок не имеет и получает любую готовую: иначе
+// каждый запрос из curl создавал бы новую ссылку. foreign сообщает, что
+// нашлась только чужая ссылка.
+func (h *URLHandler) findReusable(ctx context.Context, longURL, user string, newUser bool) (shortURL string, foreign bool, err error) {
+	owners := []string{""}
+	if user != "" && !newUser {
+		owners = []string{user, ""}
+	}
+	for _, owner := range owners {
+		shortURL, err = h.storage.FindOwned(ctx, longURL, owner)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return shortURL, false, err
+		}
+	}
 
+	shortURL, err = h.storage.FindByLongURL(ctx, longURL)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if user == "" || newUser {
+		return shortURL, false, nil
+	}
+	return "", true, nil
+}
 
 func (h *URLHandler) HandURL(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -168,9 +307,8 @@ func (h *URLHandler) HandURL(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		h.HandlePost(w, r)
 	default:
-		logger.Log.Error("Method not allowed", zap.Int("status", http.StatusMethodNotAllowed))
+		logger.FromContext(r.Context()).Error("Method not allowed", zap.Int("status", http.StatusMethodNotAllowed))
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 
 	}
 }
-
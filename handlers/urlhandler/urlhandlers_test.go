@@ -0,0 +1,363 @@
+package urlhandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"local/handlers/authhandler"
+	"local/internal/storage"
+	"local/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSaves считает сохранения ссылок поверх настоящего хранилища.
+type countingSaves struct {
+	URLStorage
+	saves int
+}
+
+func (s *countingSaves) SaveRecord(ctx context.Context, rec storage.Record) error {
+	s.saves++
+	return s.URLStorage.SaveRecord(ctx, rec)
+}
+
+// sequenceGenerator выдаёт короткие URL по порядку, поэтому повторный
+// вызов для того же URL дал бы другой код — дедупликация обязана его избежать.
+type sequenceGenerator struct {
+	n int
+}
+
+func (g *sequenceGenerator) GenerateShortURL(string) (string, error) {
+	g.n++
+	return fmt.Sprintf("code%d", g.n), nil
+}
+
+func TestHandlePostDedupe(t *testing.T) {
+	mem, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	store := &countingSaves{URLStorage: mem}
+	h := NewURLHandler(store, &sequenceGenerator{})
+
+	post := func(contentType, body string) []URLRequest {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		h.HandlePost(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+		var resp []URLRequest
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	first := post("application/x-www-form-urlencoded", "url=https%3A%2F%2Fexample.com")
+	require.Len(t, first, 1)
+
+	second := post("application/x-www-form-urlencoded", "url=https%3A%2F%2Fexample.com")
+	assert.Equal(t, first, second)
+
+	batch := post("application/json", `[{"orig_url":"https://example.com"},{"orig_url":"https://example.org"},{"orig_url":"https://example.org"}]`)
+	require.Len(t, batch, 3)
+	assert.Equal(t, first[0].ShortURL, batch[0].ShortURL)
+	assert.Equal(t, batch[1].ShortURL, batch[2].ShortURL)
+	assert.NotEqual(t, batch[0].ShortURL, batch[1].ShortURL)
+
+	assert.Equal(t, 2, store.saves, "each long URL is stored once")
+}
+
+func TestHandlePostOwners(t *testing.T) {
+	mem, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	store := &countingSaves{URLStorage: mem}
+	h := authhandler.WithUser([]byte("0123456789abcdef"), http.HandlerFunc(NewURLHandler(store, &sequenceGenerator{}).HandlePost))
+
+	// post создаёт ссылку; cookie — пользователь, пустая — клиент без cookie
+	post := func(cookie *http.Cookie, longURL string) (string, *http.Cookie) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader("url="+longURL))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+		var resp []URLRequest
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp, 1)
+		if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+			cookie = cookies[0]
+		}
+		return resp[0].ShortURL, cookie
+	}
+
+	// Клиенты без cookie получают одну и ту же ссылку
+	anon, _ := post(nil, "a.example")
+	for range 3 {
+		again, _ := post(nil, "a.example")
+		assert.Equal(t, anon, again)
+	}
+
+	// Пользователь с cookie получает свою ссылку и находит её после других URL
+	_, alice := post(nil, "b.example")
+	own, _ := post(alice, "a.example")
+	assert.NotEqual(t, anon, own)
+	_, _ = post(alice, "b.example")
+	again, _ := post(alice, "a.example")
+	assert.Equal(t, own, again)
+
+	// Чужая ссылка, созданная позже, не заслоняет ссылку без владельца
+	_, bob := post(nil, "c.example")
+	theirs, _ := post(bob, "a.example")
+	assert.NotEqual(t, own, theirs)
+	again, _ = post(nil, "a.example")
+	assert.Equal(t, anon, again)
+
+	assert.Equal(t, 5, store.saves)
+}
+
+// stubStorage возвращает заданные ошибки, а в остальном ведёт себя как
+// хранилище в памяти. При block Get и GetRecord ждут отмены контекста.
+type stubStorage struct {
+	URLStorage
+	getErr, findErr, saveErr error
+	block                    bool
+}
+
+func newStubStorage(t *testing.T) *stubStorage {
+	t.Helper()
+	mem, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	return &stubStorage{URLStorage: mem}
+}
+
+func (s *stubStorage) Get(ctx context.Context, shortURL string) (string, error) {
+	if s.block {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	if s.getErr != nil {
+		return "", s.getErr
+	}
+	return s.URLStorage.Get(ctx, shortURL)
+}
+
+func (s *stubStorage) GetRecord(ctx context.Context, shortURL string) (storage.Record, error) {
+	if s.block {
+		<-ctx.Done()
+		return storage.Record{}, ctx.Err()
+	}
+	if s.getErr != nil {
+		return storage.Record{}, s.getErr
+	}
+	return s.URLStorage.GetRecord(ctx, shortURL)
+}
+
+func (s *stubStorage) FindByLongURL(ctx context.Context, longURL string) (string, error) {
+	if s.findErr != nil {
+		return "", s.findErr
+	}
+	return s.URLStorage.FindByLongURL(ctx, longURL)
+}
+
+func (s *stubStorage) FindOwned(ctx context.Context, longURL, owner string) (string, error) {
+	if s.findErr != nil {
+		return "", s.findErr
+	}
+	return s.URLStorage.FindOwned(ctx, longURL, owner)
+}
+
+func (s *stubStorage) SaveRecord(ctx context.Context, rec storage.Record) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	return s.URLStorage.SaveRecord(ctx, rec)
+}
+
+// fakeGenerator возвращает короткий URL из таблицы, для остальных — ошибку.
+type fakeGenerator map[string]string
+
+func (g fakeGenerator) GenerateShortURL(origURL string) (string, error) {
+	if short, ok := g[origURL]; ok {
+		return short, nil
+	}
+	return "", errors.New("invalid URL for generate")
+}
+
+var testGenerator = fakeGenerator{
+	"https://example.com":   "abc",
+	"https://example.com#1": "abc1",
+	"https://example.com#2": "abc2",
+	"https://example.org":   "def",
+}
+
+func TestHandleGet(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		setup    func(s *stubStorage)
+		timeout  time.Duration
+		status   int
+		location string
+	}{
+		{name: "redirect", path: "/abc", status: http.StatusTemporaryRedirect, location: "https://example.com"},
+		{name: "not found", path: "/zzz", status: http.StatusNotFound},
+		{name: "deleted", path: "/abc", setup: func(s *stubStorage) { s.getErr = storage.ErrDeleted }, status: http.StatusGone},
+		{name: "storage failure", path: "/abc", setup: func(s *stubStorage) { s.getErr = errors.New("connection refused") }, status: http.StatusInternalServerError},
+		{name: "timeout", path: "/abc", setup: func(s *stubStorage) { s.block = true }, timeout: 10 * time.Millisecond, status: http.StatusRequestTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubStorage(t)
+			require.NoError(t, s.URLStorage.Save(context.Background(), "abc", "https://example.com"))
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+			h := NewURLHandler(s, testGenerator)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.timeout > 0 {
+				ctx, cancel := context.WithTimeout(req.Context(), tt.timeout)
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+			h.HandleGet(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.location, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHandlePost(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		setup       func(s *stubStorage)
+		status      int
+		expected    []URLRequest
+	}{
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "url=https%3A%2F%2Fexample.com",
+			status:      http.StatusCreated,
+			expected:    []URLRequest{{ShortURL: "abc", OrigURL: "https://example.com"}},
+		},
+		{
+			name:        "json batch",
+			contentType: "application/json",
+			body:        `[{"orig_url":"https://example.com"},{"orig_url":"https://example.org"}]`,
+			status:      http.StatusCreated,
+			expected: []URLRequest{
+				{ShortURL: "abc", OrigURL: "https://example.com"},
+				{ShortURL: "def", OrigURL: "https://example.org"},
+			},
+		},
+		{name: "form without url", contentType: "application/x-www-form-urlencoded", body: "link=x", status: http.StatusBadRequest},
+		{name: "malformed json", contentType: "application/json", body: `{"orig_url":`, status: http.StatusBadRequest},
+		{name: "unsupported content type", contentType: "text/plain", body: "https://example.com", status: http.StatusUnsupportedMediaType},
+		{name: "ungeneratable url", contentType: "application/json", body: `[{"orig_url":""}]`, status: http.StatusBadRequest},
+		{
+			name:        "code of an edited link",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "url=https%3A%2F%2Fexample.com",
+			setup: func(s *stubStorage) {
+				require.NoError(t, s.URLStorage.Save(context.Background(), "abc", "https://moved.example"))
+			},
+			status:   http.StatusCreated,
+			expected: []URLRequest{{ShortURL: "abc1", OrigURL: "https://example.com"}},
+		},
+		{
+			name:        "short url taken",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "url=https%3A%2F%2Fexample.com",
+			setup:       func(s *stubStorage) { s.saveErr = storage.ErrConflict },
+			status:      http.StatusConflict,
+		},
+		{
+			name:        "url taken by the same owner",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "url=https%3A%2F%2Fexample.com",
+			setup:       func(s *stubStorage) { s.saveErr = storage.ErrDuplicateURL },
+			status:      http.StatusConflict,
+		},
+		{
+			name:        "storage failure",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "url=https%3A%2F%2Fexample.com",
+			setup:       func(s *stubStorage) { s.findErr = errors.New("connection refused") },
+			status:      http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubStorage(t)
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+			h := NewURLHandler(s, testGenerator)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			h.HandlePost(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.expected == nil {
+				return
+			}
+			var resp []URLRequest
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected, resp)
+
+			for _, u := range tt.expected {
+				long, err := s.Get(context.Background(), u.ShortURL)
+				require.NoError(t, err)
+				assert.Equal(t, u.OrigURL, long)
+			}
+		})
+	}
+}
+
+func TestHandURL(t *testing.T) {
+	s := newStubStorage(t)
+	require.NoError(t, s.Save(context.Background(), "abc", "https://example.com"))
+	h := NewURLHandler(s, testGenerator)
+
+	tests := []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusTemporaryRedirect},
+		{http.MethodPost, http.StatusCreated},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/abc", strings.NewReader("url=https%3A%2F%2Fexample.org"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			h.HandURL(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
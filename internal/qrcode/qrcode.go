@@ -0,0 +1,571 @@
+// Package qrcode кодирует данные в QR-код (ISO/IEC 18004) в байтовом режиме
+// и рисует его в PNG или SVG. Версия символа подбирается минимальная, в
+// которую помещаются данные при заданном уровне коррекции ошибок.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Level — уровень коррекции ошибок: какую долю повреждённых модулей код
+// переживает.
+type Level int
+
+const (
+	Low      Level = iota // около 7%
+	Medium                // около 15%
+	Quartile              // около 25%
+	High                  // около 30%
+)
+
+// ErrTooLong — данные не помещаются даже в QR-код версии 40.
+var ErrTooLong = errors.New("qrcode: data too long")
+
+// ParseLevel разбирает уровень коррекции по букве: L, M, Q или H.
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "L", "l":
+		return Low, nil
+	case "M", "m":
+		return Medium, nil
+	case "Q", "q":
+		return Quartile, nil
+	case "H", "h":
+		return High, nil
+	}
+	return 0, fmt.Errorf("qrcode: unknown error correction level %q", s)
+}
+
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// formatBits — код уровня в служебной информации символа.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// eccPerBlock — байт коррекции в каждом блоке по уровню и версии.
+var eccPerBlock = [4][maxVersion + 1]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// eccBlocks — количество блоков коррекции по уровню и версии.
+var eccBlocks = [4][maxVersion + 1]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Code — готовый QR-код: квадрат из Size()×Size() модулей без полей.
+type Code struct {
+	version int
+	level   Level
+	size    int
+	modules []bool
+	// function отмечает служебные модули: узоры поиска, синхронизации,
+	// выравнивания и служебную информацию. Маска их не затрагивает.
+	function []bool
+}
+
+// Encode кодирует data с уровнем коррекции level в QR-код наименьшей
+// подходящей версии.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("qrcode: invalid error correction level %d", level)
+	}
+	version := minVersion
+	for ; ; version++ {
+		if version > maxVersion {
+			return nil, ErrTooLong
+		}
+		if dataBits(version, len(data)) <= dataCodewords(version, level)*8 {
+			break
+		}
+	}
+
+	c := newCode(version, level)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addECC(encodeData(data, version, level)))
+
+	// Из восьми масок берём ту, что даёт наименьший штраф по правилам стандарта
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // маска — XOR, повторное применение её снимает
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c, nil
+}
+
+// Size возвращает ширину кода в модулях.
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Version возвращает версию символа, от 1 до 40.
+func (c *Code) Version() int {
+	return c.version
+}
+
+// Dark сообщает, тёмный ли модуль в столбце x и строке y. Координаты вне
+// кода считаются светлыми, то есть полем.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.size || y >= c.size {
+		return false
+	}
+	return c.modules[y*c.size+x]
+}
+
+func newCode(version int, level Level) *Code {
+	size := version*4 + 17
+	return &Code{
+		version:  version,
+		level:    level,
+		size:     size,
+		modules:  make([]bool, size*size),
+		function: make([]bool, size*size),
+	}
+}
+
+// charCountBits — длина поля счётчика байт в байтовом режиме.
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// dataBits — сколько бит занимают n байт данных вместе с заголовком.
+func dataBits(version, n int) int {
+	return 4 + charCountBits(version) + 8*n
+}
+
+// rawDataModules — количество модулей под данные и коррекцию без служебных.
+func rawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// dataCodewords — сколько байт данных помещается в символ.
+func dataCodewords(version int, level Level) int {
+	return rawDataModules(version)/8 - eccPerBlock[level][version]*eccBlocks[level][version]
+}
+
+// encodeData собирает поток данных: режим, длину, сами байты, терминатор
+// и заполнение до ёмкости символа.
+func encodeData(data []byte, version int, level Level) []byte {
+	var bb bitBuffer
+	bb.append(0b0100, 4) // байтовый режим
+	bb.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	capacity := dataCodewords(version, level) * 8
+	bb.append(0, min(4, capacity-bb.len()))
+	bb.append(0, (8-bb.len()%8)%8)
+	for pad := 0xEC; bb.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	return bb.bytes()
+}
+
+// addECC делит данные на блоки, дописывает к каждому коды Рида — Соломона
+// и перемежает блоки побайтно.
+func (c *Code) addECC(data []byte) []byte {
+	numBlocks := eccBlocks[c.level][c.version]
+	eccLen := eccPerBlock[c.level][c.version]
+	raw := rawDataModules(c.version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := rsDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := make([]byte, 0, shortLen+1)
+		block = append(block, data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < numShort {
+			block = append(block, 0) // выравниваем с длинными блоками
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, raw)
+	for i := range shortLen + 1 {
+		for j, block := range blocks {
+			// Пропускаем байты-заглушки коротких блоков
+			if i != shortLen-eccLen || j >= numShort {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// set ставит служебный модуль.
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y*c.size+x] = dark
+	c.function[y*c.size+x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	// Узоры синхронизации
+	for i := range c.size {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	// Узоры поиска вместе с разделителями
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	// Узоры выравнивания, кроме мест, занятых узорами поиска
+	pos := c.alignmentPositions()
+	n := len(pos)
+	for i := range n {
+		for j := range n {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			c.drawAlignment(pos[i], pos[j])
+		}
+	}
+
+	// Резервируем место под служебную информацию; настоящая маска будет
+	// записана после её выбора
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.size || yy >= c.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.set(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions возвращает координаты центров узоров выравнивания по
+// одной оси.
+func (c *Code) alignmentPositions() []int {
+	if c.version == 1 {
+		return nil
+	}
+	numAlign := c.version/7 + 2
+	step := (c.version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, c.size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// formatBits — 15 бит служебной информации: уровень, маска и код БЧХ.
+func formatBits(level Level, mask int) int {
+	data := level.formatBits()<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(c.level, mask)
+
+	// Копия у левого верхнего узора поиска
+	for i := range 6 {
+		c.set(8, i, bit(bits, i))
+	}
+	c.set(8, 7, bit(bits, 6))
+	c.set(8, 8, bit(bits, 7))
+	c.set(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(bits, i))
+	}
+
+	// Копия у двух других узоров поиска
+	for i := range 8 {
+		c.set(c.size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.size-15+i, bit(bits, i))
+	}
+	c.set(8, c.size-8, true) // всегда тёмный модуль
+}
+
+// versionBits — 18 бит информации о версии для версий от 7.
+func versionBits(version int) int {
+	rem := version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+	if c.version < 7 {
+		return
+	}
+	bits := versionBits(c.version)
+	for i := range 18 {
+		a, b := c.size-11+i%3, i/3
+		c.set(a, b, bit(bits, i))
+		c.set(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords раскладывает байты змейкой по парам столбцов снизу вверх и
+// обратно, обходя служебные модули.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // столбец синхронизации пропускается целиком
+		}
+		upward := (right+1)&2 == 0
+		for vert := range c.size {
+			y := vert
+			if upward {
+				y = c.size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if c.function[y*c.size+x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y*c.size+x] = bit(int(data[i>>3]), 7-i&7)
+				i++
+			}
+		}
+	}
+}
+
+// masks — условия масок 0–7 для модуля в столбце x и строке y.
+var masks = [8]func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := range c.size {
+		for x := range c.size {
+			if !c.function[y*c.size+x] && masks[mask](x, y) {
+				c.modules[y*c.size+x] = !c.modules[y*c.size+x]
+			}
+		}
+	}
+}
+
+// Веса правил штрафа из стандарта.
+const (
+	penaltyRun    = 3
+	penaltyBlock  = 3
+	penaltyFinder = 40
+	penaltyDark   = 10
+)
+
+// finderLike — последовательность, похожая на узор поиска, со светлым полем
+// с одной из сторон.
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty оценивает, насколько символ трудно читать с данной маской.
+func (c *Code) penalty() int {
+	result := 0
+	dark := 0
+	for _, horizontal := range []bool{true, false} {
+		at := func(line, i int) bool {
+			if horizontal {
+				return c.modules[line*c.size+i]
+			}
+			return c.modules[i*c.size+line]
+		}
+		for line := range c.size {
+			// Длинные серии одного цвета
+			run := 1
+			for i := 1; i < c.size; i++ {
+				if at(line, i) == at(line, i-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += penaltyRun + run - 5
+				}
+				run = 1
+			}
+			if run >= 5 {
+				result += penaltyRun + run - 5
+			}
+
+			// Ложные узоры поиска
+			for i := 0; i+11 <= c.size; i++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, v := range pattern {
+						if at(line, i+k) != v {
+							match = false
+							break
+						}
+					}
+					if match {
+						result += penaltyFinder
+					}
+				}
+			}
+		}
+	}
+
+	for y := range c.size {
+		for x := range c.size {
+			v := c.modules[y*c.size+x]
+			if v {
+				dark++
+			}
+			// Квадраты 2×2 одного цвета
+			if x+1 < c.size && y+1 < c.size &&
+				v == c.modules[y*c.size+x+1] &&
+				v == c.modules[(y+1)*c.size+x] &&
+				v == c.modules[(y+1)*c.size+x+1] {
+				result += penaltyBlock
+			}
+		}
+	}
+
+	// Отклонение доли тёмных модулей от половины, шагами по 5%
+	total := c.size * c.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * penaltyDark
+	return result
+}
+
+// rsDivisor возвращает порождающий многочлен Рида — Соломона степени degree
+// без старшего коэффициента.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder возвращает байты коррекции для data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMul умножает в поле GF(2^8) по модулю x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// bitBuffer — последовательность бит, старший бит первым.
+type bitBuffer struct {
+	bits []bool
+}
+
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		bb.bits = append(bb.bits, value>>i&1 == 1)
+	}
+}
+
+func (bb *bitBuffer) len() int {
+	return len(bb.bits)
+}
+
+func (bb *bitBuffer) bytes() []byte {
+	result := make([]byte, (len(bb.bits)+7)/8)
+	for i, b := range bb.bits {
+		if b {
+			result[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return result
+}
+
+func bit(x, i int) bool {
+	return x>>i&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
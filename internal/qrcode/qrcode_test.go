@@ -0,0 +1,256 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Эталонные значения взяты из примеров к стандарту ISO/IEC 18004.
+func TestReferenceValues(t *testing.T) {
+	// Байты коррекции для «HELLO WORLD» в версии 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, rsRemainder(data, rsDivisor(10)))
+
+	formats := []struct {
+		level    Level
+		mask     int
+		expected int
+	}{
+		{Low, 0, 0b111011111000100},
+		{Low, 1, 0b111001011110011},
+		{Medium, 0, 0b101010000010010},
+		{Quartile, 0, 0b011010101011111},
+		{High, 0, 0b001011010001001},
+		{High, 7, 0b000100000111011},
+	}
+	for _, f := range formats {
+		assert.Equal(t, f.expected, formatBits(f.level, f.mask), "%v mask %d", f.level, f.mask)
+	}
+
+	assert.Equal(t, 0b000111110010010100, versionBits(7))
+	assert.Equal(t, 0b101000110001101001, versionBits(40))
+
+	assert.Nil(t, newCode(1, Low).alignmentPositions())
+	assert.Equal(t, []int{6, 18}, newCode(2, Low).alignmentPositions())
+	assert.Equal(t, []int{6, 22, 38}, newCode(7, Low).alignmentPositions())
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, newCode(32, Low).alignmentPositions())
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, newCode(40, Low).alignmentPositions())
+
+	assert.Equal(t, 19, dataCodewords(1, Low))
+	assert.Equal(t, 9, dataCodewords(1, High))
+	assert.Equal(t, 62, dataCodewords(5, Quartile))
+	assert.Equal(t, 2956, dataCodewords(40, Low))
+	assert.Equal(t, 1276, dataCodewords(40, High))
+}
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		level    Level
+		expected int
+	}{
+		{name: "fits version 1", n: 17, level: Low, expected: 1},
+		{name: "one byte more", n: 18, level: Low, expected: 2},
+		{name: "higher level needs more space", n: 17, level: High, expected: 3},
+		{name: "largest", n: 2953, level: Low, expected: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Encode(bytes.Repeat([]byte("a"), tt.n), tt.level)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, c.Version())
+			assert.Equal(t, tt.expected*4+17, c.Size())
+		})
+	}
+
+	_, err := Encode(bytes.Repeat([]byte("a"), 2954), Low)
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"https://short.example/abc123",
+		"https://example.com/" + strings.Repeat("путь/", 40),
+		strings.Repeat("x", 1000),
+	}
+	for _, input := range inputs {
+		for level := Low; level <= High; level++ {
+			c, err := Encode([]byte(input), level)
+			require.NoError(t, err)
+			assert.Equal(t, input, string(decode(t, c)), "level %v, version %d", level, c.Version())
+		}
+	}
+}
+
+// decode читает код обратно: служебную информацию, модули данных и байты
+// коррекции, которые должны совпасть с пересчитанными.
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+
+	var format int
+	for i := range 6 {
+		format |= btoi(c.Dark(8, i)) << i
+	}
+	format |= btoi(c.Dark(8, 7))<<6 | btoi(c.Dark(8, 8))<<7 | btoi(c.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		format |= btoi(c.Dark(14-i, 8)) << i
+	}
+	level, mask := Level(-1), -1
+	for l := Low; l <= High; l++ {
+		for m := range 8 {
+			if formatBits(l, m) == format {
+				level, mask = l, m
+			}
+		}
+	}
+	require.NotEqual(t, -1, mask, "format information is damaged")
+	second := 0
+	for i := range 8 {
+		second |= btoi(c.Dark(c.size-1-i, 8)) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= btoi(c.Dark(8, c.size-15+i)) << i
+	}
+	require.Equal(t, format, second, "format information copies differ")
+	require.Equal(t, c.level, level)
+
+	// Служебные модули той же версии и снятая маска
+	ref := newCode(c.Version(), level)
+	ref.drawFunctionPatterns()
+	for y := range c.size {
+		for x := range c.size {
+			i := y*c.size + x
+			if ref.function[i] {
+				continue
+			}
+			ref.modules[i] = c.modules[i] != masks[mask](x, y)
+		}
+	}
+
+	// Чтение змейкой в обратном порядке раскладки
+	var codewords []byte
+	var cur byte
+	n := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range c.size {
+			y := vert
+			if upward {
+				y = c.size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if ref.function[y*c.size+x] {
+					continue
+				}
+				cur = cur<<1 | byte(btoi(ref.modules[y*c.size+x]))
+				if n++; n%8 == 0 {
+					codewords = append(codewords, cur)
+					cur = 0
+				}
+			}
+		}
+	}
+
+	// Разбор блоков и проверка коррекции
+	numBlocks := eccBlocks[level][c.version]
+	eccLen := eccPerBlock[level][c.version]
+	raw := rawDataModules(c.version) / 8
+	require.Len(t, codewords, raw)
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range shortLen - eccLen + 1 {
+		for j := range blocks {
+			if i == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+	var data []byte
+	for j, block := range blocks {
+		ecc := make([]byte, eccLen)
+		for i := range ecc {
+			ecc[i] = codewords[k+i*numBlocks+j]
+		}
+		assert.Equal(t, rsRemainder(block, rsDivisor(eccLen)), ecc, "block %d", j)
+		data = append(data, block...)
+	}
+
+	// Байтовый режим: 4 бита режима, счётчик и сами байты
+	var bb bitBuffer
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	read := func(n int) int {
+		v := 0
+		for range n {
+			v = v<<1 | btoi(bb.bits[0])
+			bb.bits = bb.bits[1:]
+		}
+		return v
+	}
+	require.Equal(t, 0b0100, read(4))
+	result := make([]byte, read(charCountBits(c.version)))
+	for i := range result {
+		result[i] = byte(read(8))
+	}
+	return result
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"L", "m", "Q", "h"} {
+		level, err := ParseLevel(s)
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToUpper(s), level.String())
+	}
+	_, err := ParseLevel("X")
+	assert.Error(t, err)
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode([]byte("https://short.example/abc"), Medium)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WritePNG(&buf, 3, 4))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	side := (c.Size() + 8) * 3
+	assert.Equal(t, side, img.Bounds().Dx())
+	assert.Equal(t, side, img.Bounds().Dy())
+	// Поле светлое, левый верхний угол узора поиска тёмный
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+	r, _, _, _ = img.At(4*3, 4*3).RGBA()
+	assert.Equal(t, uint32(0), r)
+
+	buf.Reset()
+	require.NoError(t, c.WriteSVG(&buf, 200, 2))
+	svg := buf.String()
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	assert.Contains(t, svg, `width="200"`)
+	assert.Contains(t, svg, `viewBox="0 0 29 29"`)
+	// Верхняя строка узора поиска — семь тёмных модулей подряд
+	assert.Contains(t, svg, `M2 2h7v1h-7z`)
+}
@@ -0,0 +1,68 @@
+package qrcode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// palette — светлый и тёмный цвета модулей.
+var palette = color.Palette{color.White, color.Black}
+
+// Image рисует код с полем шириной margin модулей, scale пикселей на модуль.
+func (c *Code) Image(scale, margin int) image.Image {
+	scale = max(scale, 1)
+	margin = max(margin, 0)
+	side := (c.size + 2*margin) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), palette)
+	for y := range c.size {
+		for x := range c.size {
+			if !c.Dark(x, y) {
+				continue
+			}
+			px, py := (x+margin)*scale, (y+margin)*scale
+			for dy := range scale {
+				row := img.Pix[(py+dy)*img.Stride:]
+				for dx := range scale {
+					row[px+dx] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG записывает код в формате PNG; параметры — как у Image.
+func (c *Code) WritePNG(w io.Writer, scale, margin int) error {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	return enc.Encode(w, c.Image(scale, margin))
+}
+
+// WriteSVG записывает код в формате SVG размером size×size пикселей с полем
+// шириной margin модулей. Модули одной строки, идущие подряд, сливаются в один
+// прямоугольник, поэтому файл получается небольшим.
+func (c *Code) WriteSVG(w io.Writer, size, margin int) error {
+	margin = max(margin, 0)
+	side := c.size + 2*margin
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, side, side)
+	fmt.Fprint(bw, `<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y := range c.size {
+		for x := 0; x < c.size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			start := x
+			for x < c.size && c.Dark(x, y) {
+				x++
+			}
+			fmt.Fprintf(bw, "M%d %dh%dv1h-%dz", start+margin, y+margin, x-start, x-start)
+		}
+	}
+	fmt.Fprint(bw, `"/></svg>`)
+	return bw.Flush()
+}
@@ -0,0 +1,283 @@
+// Package cache реализует read-through кэш перед любым хранилищем.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"local/internal/storage"
+	"local/metrics"
+	"sync"
+	"time"
+)
+
+// Options задаёт размер и время жизни записей кэша.
+type Options struct {
+	// Size — максимальное количество записей; самые старые по использованию вытесняются.
+	Size int
+	// TTL — время жизни найденных значений.
+	TTL time.Duration
+	// NegativeTTL — время жизни промахов (ссылка не найдена). 0 отключает их кэширование.
+	NegativeTTL time.Duration
+}
+
+type kind uint8
+
+const (
+	byRecord  kind = iota // Get и GetRecord
+	byLongURL             // FindByLongURL
+	byOwned               // FindOwned, значение — ownedValue
+)
+
+type key struct {
+	kind  kind
+	value string
+}
+
+type entry struct {
+	key      key
+	value    any
+	err      error
+	expireAt time.Time
+}
+
+// ownedValue — значение ключа byOwned. Нулевой байт не встречается ни в URL,
+// ни в идентификаторе пользователя.
+func ownedValue(owner, longURL string) string {
+	return owner + "\x00" + longURL
+}
+
+// urlKeys — ключи поиска ссылки rec по её URL.
+func urlKeys(rec storage.Record) []key {
+	return []key{{byLongURL, rec.OrigURL}, {byOwned, ownedValue(rec.Owner, rec.OrigURL)}}
+}
+
+// Storage — хранилище с LRU-кэшем для Get, FindByLongURL, FindOwned и GetRecord.
+// Save сбрасывает затронутые записи.
+type Storage struct {
+	next storage.Storage
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[key]*list.Element
+	// gen растёт при каждом сбросе. Значение, загруженное до сброса, могло
+	// устареть, и lookup его не кэширует.
+	gen uint64
+}
+
+// New оборачивает next кэшем.
+func New(next storage.Storage, opts Options) *Storage {
+	return &Storage{
+		next:    next,
+		opts:    opts,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: make(map[key]*list.Element, opts.Size),
+	}
+}
+
+// Get читает ссылку через кэш записей и проверяет её при каждом обращении:
+// ссылка может истечь, пока лежит в кэше.
+func (c *Storage) Get(ctx context.Context, shortUrl string) (string, error) {
+	rec, err := c.GetRecord(ctx, shortUrl)
+	if err != nil {
+		return "", err
+	}
+	if err := rec.Available(c.now()); err != nil {
+		return "", err
+	}
+	return rec.OrigURL, nil
+}
+
+func (c *Storage) FindByLongURL(ctx context.Context, longURL string) (string, error) {
+	return lookup(ctx, c, key{byLongURL, longURL}, c.next.FindByLongURL)
+}
+
+func (c *Storage) FindOwned(ctx context.Context, longURL, owner string) (string, error) {
+	return lookup(ctx, c, key{byOwned, ownedValue(owner, longURL)}, func(ctx context.Context, _ string) (string, error) {
+		return c.next.FindOwned(ctx, longURL, owner)
+	})
+}
+
+func (c *Storage) Save(ctx context.Context, shortUrl, longUrl string) error {
+	err := c.next.Save(ctx, shortUrl, longUrl)
+	// Сбрасываем записи даже при ошибке: хранилище могло успеть сохранить ссылку.
+	c.invalidate(append(urlKeys(storage.Record{OrigURL: longUrl}), key{byRecord, shortUrl})...)
+	return err
+}
+
+func (c *Storage) SaveRecord(ctx context.Context, rec storage.Record) error {
+	err := c.next.SaveRecord(ctx, rec)
+	c.invalidate(append(urlKeys(rec), key{byRecord, rec.ShortURL})...)
+	return err
+}
+
+// PutRecord может заменить ссылку на другой URL, поэтому сбрасывает и запись
+// поиска по прежнему URL.
+func (c *Storage) PutRecord(ctx context.Context, rec storage.Record) error {
+	keys := append(urlKeys(rec), key{byRecord, rec.ShortURL})
+	if old, err := c.next.GetRecord(ctx, rec.ShortURL); err == nil {
+		keys = append(keys, urlKeys(old)...)
+	}
+	err := c.next.PutRecord(ctx, rec)
+	c.invalidate(keys...)
+	return err
+}
+
+// GetRecord кэшируется: по записи редирект узнаёт, нужна ли страница
+// предпросмотра. Срок действия проверяет вызывающий, поэтому истёкшая
+// запись из кэша не опаснее истёкшей из хранилища.
+func (c *Storage) GetRecord(ctx context.Context, shortURL string) (storage.Record, error) {
+	return lookup(ctx, c, key{byRecord, shortURL}, c.next.GetRecord)
+}
+
+// Iterate нужен для администрирования и не кэшируется.
+func (c *Storage) Iterate(ctx context.Context, after string, fn func(storage.Record) error) error {
+	return c.next.Iterate(ctx, after, fn)
+}
+
+func (c *Storage) List(ctx context.Context, filter storage.Filter, after string, limit int) ([]storage.Record, error) {
+	return c.next.List(ctx, filter, after, limit)
+}
+
+// Update сбрасывает записи и по прежнему, и по новому URL ссылки.
+func (c *Storage) Update(ctx context.Context, shortURL, actor string, fn func(*storage.Record) error) (storage.Record, error) {
+	var old storage.Record
+	rec, err := c.next.Update(ctx, shortURL, actor, func(r *storage.Record) error {
+		old = *r
+		return fn(r)
+	})
+	keys := append(urlKeys(old), urlKeys(rec)...)
+	c.invalidate(append(keys, key{byRecord, shortURL})...)
+	return rec, err
+}
+
+func (c *Storage) History(ctx context.Context, shortURL string) ([]storage.HistoryEntry, error) {
+	return c.next.History(ctx, shortURL)
+}
+
+// PutHistory не трогает кэш: история не кэшируется.
+func (c *Storage) PutHistory(ctx context.Context, shortURL string, history []storage.HistoryEntry) error {
+	return c.next.PutHistory(ctx, shortURL, history)
+}
+
+func (c *Storage) Delete(ctx context.Context, shortURL string) error {
+	keys := []key{{byRecord, shortURL}}
+	if old, err := c.next.GetRecord(ctx, shortURL); err == nil {
+		keys = append(keys, urlKeys(old)...)
+	}
+	err := c.next.Delete(ctx, shortURL)
+	c.invalidate(keys...)
+	return err
+}
+
+func (c *Storage) Ping(ctx context.Context) error {
+	return c.next.Ping(ctx)
+}
+
+func (c *Storage) Close() error {
+	return c.next.Close()
+}
+
+// Len возвращает количество записей в кэше.
+func (c *Storage) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// lookup — функция, а не метод: у методов не бывает параметров типа.
+func lookup[T any](ctx context.Context, c *Storage, k key, load func(context.Context, string) (T, error)) (T, error) {
+	if value, err, ok := c.get(k); ok {
+		metrics.CacheRequests.With("hit").Inc()
+		v, _ := value.(T)
+		return v, err
+	}
+	metrics.CacheRequests.With("miss").Inc()
+
+	gen := c.generation()
+	value, err := load(ctx, k.value)
+	switch {
+	case err == nil:
+		c.put(k, gen, value, nil, c.opts.TTL)
+	case isNotFound(err) && c.opts.NegativeTTL > 0:
+		var zero T
+		c.put(k, gen, zero, err, c.opts.NegativeTTL)
+	}
+	return value, err
+}
+
+func (c *Storage) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// isNotFound отделяет отсутствие ссылки от сбоев хранилища, которые кэшировать нельзя.
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrNotFound)
+}
+
+func (c *Storage) get(k key) (any, error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[k]
+	if !ok {
+		return nil, nil, false
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expireAt) {
+		c.remove(el)
+		return nil, nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.value, e.err, true
+}
+
+// put кэширует значение, загруженное в поколении gen, если с тех пор
+// ничего не сбрасывалось.
+func (c *Storage) put(k key, gen uint64, value any, err error, ttl time.Duration) {
+	if c.opts.Size <= 0 || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+
+	expireAt := c.now().Add(ttl)
+	if el, ok := c.entries[k]; ok {
+		e := el.Value.(*entry)
+		e.value, e.err, e.expireAt = value, err, expireAt
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[k] = c.lru.PushFront(&entry{key: k, value: value, err: err, expireAt: expireAt})
+	for c.lru.Len() > c.opts.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate сбрасывает записи и начинает новое поколение, чтобы загрузки,
+// начатые до сброса, не вернули в кэш старые значения.
+func (c *Storage) invalidate(keys ...key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, k := range keys {
+		if el, ok := c.entries[k]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *Storage) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"local/internal/storage"
+	"local/internal/storage/memory"
+	"local/internal/storage/storagetest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage — хранилище в памяти, считающее обращения к нему.
+type countingStorage struct {
+	urls  map[string]string
+	calls int
+	err   error
+}
+
+func newCountingStorage() *countingStorage {
+	return &countingStorage{urls: make(map[string]string)}
+}
+
+func (s *countingStorage) Get(_ context.Context, shortURL string) (string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	if long, ok := s.urls[shortURL]; ok {
+		return long, nil
+	}
+	return "", storage.ErrNotFound
+}
+
+func (s *countingStorage) FindByLongURL(_ context.Context, longURL string) (string, error) {
+	s.calls++
+	for short, long := range s.urls {
+		if long == longURL {
+			return short, nil
+		}
+	}
+	return "", storage.ErrNotFound
+}
+
+// FindOwned находит только ссылки без владельца: других здесь не бывает.
+func (s *countingStorage) FindOwned(ctx context.Context, longURL, owner string) (string, error) {
+	if owner != "" {
+		s.calls++
+		return "", storage.ErrNotFound
+	}
+	return s.FindByLongURL(ctx, longURL)
+}
+
+func (s *countingStorage) Save(_ context.Context, shortURL, longURL string) error {
+	s.urls[shortURL] = longURL
+	return nil
+}
+
+func (s *countingStorage) GetRecord(_ context.Context, shortURL string) (storage.Record, error) {
+	s.calls++
+	if s.err != nil {
+		return storage.Record{}, s.err
+	}
+	if long, ok := s.urls[shortURL]; ok {
+		return storage.Record{ShortURL: shortURL, OrigURL: long}, nil
+	}
+	return storage.Record{}, storage.ErrNotFound
+}
+
+func (s *countingStorage) SaveRecord(ctx context.Context, rec storage.Record) error {
+	return s.Save(ctx, rec.ShortURL, rec.OrigURL)
+}
+
+func (s *countingStorage) PutRecord(ctx context.Context, rec storage.Record) error {
+	return s.Save(ctx, rec.ShortURL, rec.OrigURL)
+}
+
+func (s *countingStorage) Iterate(context.Context, string, func(storage.Record) error) error {
+	return nil
+}
+
+func (s *countingStorage) List(context.Context, storage.Filter, string, int) ([]storage.Record, error) {
+	return nil, nil
+}
+
+func (s *countingStorage) Update(_ context.Context, shortURL, _ string, fn func(*storage.Record) error) (storage.Record, error) {
+	long, ok := s.urls[shortURL]
+	if !ok {
+		return storage.Record{}, storage.ErrNotFound
+	}
+	rec := storage.Record{ShortURL: shortURL, OrigURL: long}
+	if err := fn(&rec); err != nil {
+		return storage.Record{}, err
+	}
+	s.urls[shortURL] = rec.OrigURL
+	return rec, nil
+}
+
+func (s *countingStorage) History(context.Context, string) ([]storage.HistoryEntry, error) {
+	return nil, nil
+}
+
+func (s *countingStorage) PutHistory(context.Context, string, []storage.HistoryEntry) error {
+	return nil
+}
+
+func (s *countingStorage) Delete(_ context.Context, shortURL string) error {
+	delete(s.urls, shortURL)
+	return nil
+}
+
+func (s *countingStorage) Ping(context.Context) error { return nil }
+
+func (s *countingStorage) Close() error { return nil }
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+		return func() (storage.Storage, error) {
+			next, err := memory.NewMemoryStorage()
+			if err != nil {
+				return nil, err
+			}
+			return New(next, Options{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute}), nil
+		}
+	}, storagetest.Options{})
+}
+
+func TestCacheHitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingStorage()
+	c := New(backend, Options{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+
+	// Промах кэшируется
+	_, err := c.Get(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = c.Get(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, 1, backend.calls)
+
+	// Save сбрасывает отрицательную запись
+	require.NoError(t, c.Save(ctx, "abc", "https://example.com"))
+	for range 3 {
+		long, err := c.Get(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", long)
+	}
+	assert.Equal(t, 2, backend.calls)
+
+	for range 3 {
+		short, err := c.FindByLongURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "abc", short)
+	}
+	assert.Equal(t, 3, backend.calls)
+}
+
+func TestCacheRecords(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingStorage()
+	backend.urls["abc"] = "https://example.com"
+	c := New(backend, Options{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+
+	for range 3 {
+		rec, err := c.GetRecord(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", rec.OrigURL)
+	}
+	assert.Equal(t, 1, backend.calls)
+
+	// Update сбрасывает запись вместе с адресом
+	_, err := c.Update(ctx, "abc", "", func(r *storage.Record) error {
+		r.OrigURL = "https://example.org"
+		return nil
+	})
+	require.NoError(t, err)
+	rec, err := c.GetRecord(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", rec.OrigURL)
+	assert.Equal(t, 2, backend.calls)
+
+	// Отрицательная запись сбрасывается при сохранении
+	_, err = c.GetRecord(ctx, "new")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	require.NoError(t, c.Save(ctx, "new", "https://example.net"))
+	rec, err = c.GetRecord(ctx, "new")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.net", rec.OrigURL)
+}
+
+func TestCacheDoesNotCacheFailures(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingStorage()
+	backend.err = errors.New("connection refused")
+	c := New(backend, Options{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+
+	for range 2 {
+		_, err := c.Get(ctx, "abc")
+		assert.EqualError(t, err, "connection refused")
+	}
+	assert.Equal(t, 2, backend.calls)
+	assert.Zero(t, c.Len())
+}
+
+// slowStorage задерживает GetRecord, пока тест не разрешит ему вернуться.
+type slowStorage struct {
+	*countingStorage
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStorage) GetRecord(ctx context.Context, shortURL string) (storage.Record, error) {
+	rec, err := s.countingStorage.GetRecord(ctx, shortURL)
+	select {
+	case s.loading <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return rec, err
+}
+
+// Значение, прочитанное до изменения ссылки, не должно попасть в кэш после сброса.
+func TestCacheStaleLoad(t *testing.T) {
+	ctx := context.Background()
+	backend := &slowStorage{
+		countingStorage: newCountingStorage(),
+		loading:         make(chan struct{}, 1),
+		release:         make(chan struct{}),
+	}
+	backend.urls["abc"] = "https://example.com"
+	c := New(backend, Options{Size: 10, TTL: time.Minute})
+
+	done := make(chan string)
+	go func() {
+		long, _ := c.Get(ctx, "abc")
+		done <- long
+	}()
+	<-backend.loading
+
+	_, err := c.Update(ctx, "abc", "", func(r *storage.Record) error {
+		r.OrigURL = "https://example.org"
+		return nil
+	})
+	require.NoError(t, err)
+	close(backend.release)
+	assert.Equal(t, "https://example.com", <-done)
+
+	long, err := c.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", long)
+}
+
+// Ссылка истекает, пока лежит в кэше.
+func TestCacheExpiredLink(t *testing.T) {
+	ctx := context.Background()
+	backend, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, backend.SaveRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: "https://example.com", ExpiresAt: now.Add(30 * time.Second)}))
+	c := New(backend, Options{Size: 10, TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	long, err := c.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", long)
+
+	now = now.Add(31 * time.Second)
+	_, err = c.Get(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrExpired)
+}
+
+func TestCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingStorage()
+	backend.urls["abc"] = "https://example.com"
+	c := New(backend, Options{Size: 10, TTL: time.Minute})
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	_, _ = c.Get(ctx, "abc")
+	_, _ = c.Get(ctx, "abc")
+	assert.Equal(t, 1, backend.calls)
+
+	now = now.Add(time.Minute)
+	_, _ = c.Get(ctx, "abc")
+	assert.Equal(t, 2, backend.calls)
+
+	// Без NegativeTTL промахи не кэшируются
+	_, _ = c.Get(ctx, "missing")
+	_, _ = c.Get(ctx, "missing")
+	assert.Equal(t, 4, backend.calls)
+}
+
+func TestCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingStorage()
+	for _, short := range []string{"a", "b", "c"} {
+		backend.urls[short] = "https://example.com/" + short
+	}
+	c := New(backend, Options{Size: 2, TTL: time.Minute})
+
+	_, _ = c.Get(ctx, "a")
+	_, _ = c.Get(ctx, "b")
+	_, _ = c.Get(ctx, "a") // "a" становится самой свежей записью
+	_, _ = c.Get(ctx, "c") // вытесняет "b"
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, 3, backend.calls)
+
+	_, _ = c.Get(ctx, "a")
+	assert.Equal(t, 3, backend.calls)
+	_, _ = c.Get(ctx, "b")
+	assert.Equal(t, 4, backend.calls)
+}
@@ -0,0 +1,306 @@
+// Package dump выгружает ссылки из любого хранилища в JSON Lines или CSV
+// и загружает их обратно. Вместе с каждой ссылкой выгружается история её
+// прежних адресов (Storage.History).
+package dump
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"local/internal/storage"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ErrMalformed оборачивает ошибки разбора загружаемых данных, чтобы их можно
+// было отличить от ошибок хранилища.
+var ErrMalformed = errors.New("malformed input")
+
+// Format — формат выгрузки.
+type Format string
+
+const (
+	// JSONL — по одному JSON-объекту storage.Record на строку; история — в
+	// поле history.
+	JSONL Format = "jsonl"
+	// CSV — таблица с заголовком, см. csvHeader.
+	CSV Format = "csv"
+)
+
+// ParseFormat проверяет название формата.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case JSONL, CSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (want jsonl or csv)", s)
+}
+
+// Policy определяет, что делать с загружаемой ссылкой, чей короткий URL
+// уже занят другой ссылкой.
+type Policy string
+
+const (
+	// Skip оставляет существующую ссылку.
+	Skip Policy = "skip"
+	// Overwrite заменяет существующую ссылку загружаемой.
+	Overwrite Policy = "overwrite"
+	// Fail прерывает загрузку с ошибкой storage.ErrConflict.
+	Fail Policy = "fail"
+)
+
+// ParsePolicy проверяет название политики.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Skip, Overwrite, Fail:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (want skip, overwrite or fail)", s)
+}
+
+// csvHeader — колонки CSV. Время записывается в RFC 3339 в UTC, пустая
+// ячейка означает нулевое время; disabled и preview — true или false;
+// password_hash — bcrypt-хеш пароля, пустой у ссылок без пароля; history —
+// JSON-массив истории, пустой у ссылок без неё.
+var csvHeader = []string{"short_url", "orig_url", "owner", "created_at", "expires_at", "disabled", "preview", "password_hash", "history"}
+
+// line — ссылка вместе с историей, одна строка выгрузки.
+type line struct {
+	storage.Record
+	History []storage.HistoryEntry `json:"history,omitempty"`
+}
+
+// Export записывает в w все ссылки хранилища в порядке короткого URL и
+// возвращает их количество.
+func Export(ctx context.Context, s storage.Storage, w io.Writer, format Format) (int, error) {
+	bw := bufio.NewWriter(w)
+	var write func(line) error
+	var flush func() error
+
+	switch format {
+	case JSONL:
+		enc := json.NewEncoder(bw)
+		write = func(l line) error { return enc.Encode(l) }
+		flush = bw.Flush
+	case CSV:
+		cw := csv.NewWriter(bw)
+		if err := cw.Write(csvHeader); err != nil {
+			return 0, err
+		}
+		write = func(l line) error {
+			var history string
+			if len(l.History) > 0 {
+				data, err := json.Marshal(l.History)
+				if err != nil {
+					return err
+				}
+				history = string(data)
+			}
+			rec := l.Record
+			return cw.Write([]string{rec.ShortURL, rec.OrigURL, rec.Owner, formatTime(rec.CreatedAt), formatTime(rec.ExpiresAt), strconv.FormatBool(rec.Disabled), strconv.FormatBool(rec.Preview), rec.PasswordHash, history})
+		}
+		flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	var n int
+	err := s.Iterate(ctx, "", func(rec storage.Record) error {
+		history, err := s.History(ctx, rec.ShortURL)
+		if err != nil {
+			return fmt.Errorf("history of %s: %w", rec.ShortURL, err)
+		}
+		n++
+		return write(line{Record: rec, History: history})
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// Stats — итог загрузки.
+type Stats struct {
+	// Imported — сколько ссылок записано. Ссылка, которая уже есть в
+	// хранилище с тем же URL, тоже считается записанной, но метаданные
+	// существующей ссылки при этом не меняются (кроме политики Overwrite).
+	Imported int `json:"imported"`
+	// Skipped — сколько ссылок пропущено из-за конфликта при политике Skip.
+	Skipped int `json:"skipped"`
+}
+
+// Import загружает ссылки из r в хранилище. Ошибка в записи прерывает
+// загрузку; уже загруженные ссылки остаются в хранилище и учтены в Stats.
+// История из выгрузки заменяет историю ссылки при политике Overwrite, а при
+// остальных записывается, только если своей истории у ссылки нет.
+func Import(ctx context.Context, s storage.Storage, r io.Reader, format Format, policy Policy) (Stats, error) {
+	var stats Stats
+	if _, err := ParsePolicy(string(policy)); err != nil {
+		return stats, err
+	}
+
+	next, err := newReader(r, format)
+	if err != nil {
+		return stats, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	for n := 1; ; n++ {
+		l, err := next()
+		rec := l.Record
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("%w: record %d: %w", ErrMalformed, n, err)
+		}
+
+		if policy == Overwrite {
+			err = s.PutRecord(ctx, rec)
+		} else {
+			err = s.SaveRecord(ctx, rec)
+		}
+		// Ссылка с тем же URL, но отключённая администратором — тоже
+		// конфликт: загрузка не должна ни включать её, ни падать
+		if errors.Is(err, storage.ErrDisabled) {
+			err = fmt.Errorf("%w: %w", storage.ErrConflict, err)
+		}
+		if errors.Is(err, storage.ErrConflict) && policy == Skip {
+			stats.Skipped++
+			continue
+		}
+		if err == nil && len(l.History) > 0 {
+			err = importHistory(ctx, s, rec.ShortURL, l.History, policy == Overwrite)
+		}
+		if err != nil {
+			return stats, fmt.Errorf("record %d (%s): %w", n, rec.ShortURL, err)
+		}
+		stats.Imported++
+	}
+}
+
+// importHistory записывает историю ссылки; без replace существующая
+// история не меняется.
+func importHistory(ctx context.Context, s storage.Storage, shortURL string, history []storage.HistoryEntry, replace bool) error {
+	if !replace {
+		existing, err := s.History(ctx, shortURL)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return nil
+		}
+	}
+	return s.PutHistory(ctx, shortURL, history)
+}
+
+// newReader возвращает функцию, читающую записи по одной; конец данных — io.EOF.
+func newReader(r io.Reader, format Format) (func() (line, error), error) {
+	switch format {
+	case JSONL:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		return func() (line, error) {
+			var l line
+			err := dec.Decode(&l)
+			return l, err
+		}, nil
+	case CSV:
+		return newCSVReader(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// newCSVReader сопоставляет колонки по заголовку, поэтому их порядок не важен,
+// а необязательные колонки можно опустить.
+func newCSVReader(r io.Reader) (func() (line, error), error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return func() (line, error) { return line{}, io.EOF }, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range header {
+		if !slices.Contains(csvHeader, name) {
+			return nil, fmt.Errorf("unknown csv column %q", name)
+		}
+	}
+	for _, name := range csvHeader[:2] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv column %q is missing", name)
+		}
+	}
+
+	return func() (line, error) {
+		row, err := cr.Read()
+		if err != nil {
+			return line{}, err
+		}
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return row[i]
+			}
+			return ""
+		}
+
+		rec := storage.Record{
+			ShortURL:     cell("short_url"),
+			OrigURL:      cell("orig_url"),
+			Owner:        cell("owner"),
+			PasswordHash: cell("password_hash"),
+		}
+		if rec.CreatedAt, err = parseTime(cell("created_at")); err != nil {
+			return line{}, fmt.Errorf("created_at: %w", err)
+		}
+		if rec.ExpiresAt, err = parseTime(cell("expires_at")); err != nil {
+			return line{}, fmt.Errorf("expires_at: %w", err)
+		}
+		if disabled := cell("disabled"); disabled != "" {
+			if rec.Disabled, err = strconv.ParseBool(disabled); err != nil {
+				return line{}, fmt.Errorf("disabled: %w", err)
+			}
+		}
+		if preview := cell("preview"); preview != "" {
+			if rec.Preview, err = strconv.ParseBool(preview); err != nil {
+				return line{}, fmt.Errorf("preview: %w", err)
+			}
+		}
+		l := line{Record: rec}
+		if history := cell("history"); history != "" {
+			if err := json.Unmarshal([]byte(history), &l.History); err != nil {
+				return line{}, fmt.Errorf("history: %w", err)
+			}
+		}
+		return l, nil
+	}, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,270 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"local/internal/storage"
+	"local/internal/storage/memory"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = []storage.Record{
+	{
+		ShortURL:  "abc",
+		OrigURL:   "https://example.com/?a=1,b=2",
+		Owner:     "user-1",
+		CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		ShortURL:  "def",
+		OrigURL:   "https://пример.рф/\"quoted\"",
+		CreatedAt: time.Date(2024, 5, 2, 8, 0, 0, 123456000, time.UTC),
+		Disabled:  true,
+		Preview:   true,
+	},
+}
+
+func newStorage(t *testing.T, records ...storage.Record) storage.Storage {
+	s, err := memory.NewMemoryStorage()
+	require.NoError(t, err)
+	for _, rec := range records {
+		require.NoError(t, s.PutRecord(context.Background(), rec))
+	}
+	return s
+}
+
+func allRecords(t *testing.T, s storage.Storage) []storage.Record {
+	var records []storage.Record
+	require.NoError(t, s.Iterate(context.Background(), "", func(rec storage.Record) error {
+		records = append(records, rec)
+		return nil
+	}))
+	return records
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{JSONL, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			ctx := context.Background()
+			var buf bytes.Buffer
+			n, err := Export(ctx, newStorage(t, testRecords...), &buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			dst := newStorage(t)
+			stats, err := Import(ctx, dst, &buf, format, Fail)
+			require.NoError(t, err)
+			assert.Equal(t, Stats{Imported: 2}, stats)
+			assert.Equal(t, testRecords, allRecords(t, dst))
+		})
+	}
+}
+
+func TestRoundTripHistory(t *testing.T) {
+	for _, format := range []Format{JSONL, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			ctx := context.Background()
+			src := newStorage(t, testRecords...)
+			_, err := src.Update(ctx, "abc", "user-1", func(rec *storage.Record) error {
+				rec.OrigURL = "https://example.com/new"
+				return nil
+			})
+			require.NoError(t, err)
+			want, err := src.History(ctx, "abc")
+			require.NoError(t, err)
+			require.Len(t, want, 1)
+
+			var buf bytes.Buffer
+			_, err = Export(ctx, src, &buf, format)
+			require.NoError(t, err)
+
+			dst := newStorage(t)
+			_, err = Import(ctx, dst, &buf, format, Fail)
+			require.NoError(t, err)
+			history, err := dst.History(ctx, "abc")
+			require.NoError(t, err)
+			require.Len(t, history, 1)
+			assert.Equal(t, want[0].OrigURL, history[0].OrigURL)
+			assert.Equal(t, want[0].Actor, history[0].Actor)
+			assert.True(t, want[0].ChangedAt.Equal(history[0].ChangedAt))
+			history, err = dst.History(ctx, "def")
+			require.NoError(t, err)
+			assert.Empty(t, history)
+		})
+	}
+}
+
+func TestImportHistoryPolicies(t *testing.T) {
+	own := []storage.HistoryEntry{{OrigURL: "https://own.example", Actor: "admin", ChangedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	input := `{"short_url":"abc","orig_url":"https://example.com","history":[{"orig_url":"https://imported.example","changed_at":"2024-02-01T00:00:00Z"}]}` + "\n"
+
+	tests := []struct {
+		policy Policy
+		want   string
+	}{
+		{policy: Fail, want: "https://own.example"},
+		{policy: Skip, want: "https://own.example"},
+		{policy: Overwrite, want: "https://imported.example"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t, storage.Record{ShortURL: "abc", OrigURL: "https://example.com"})
+			require.NoError(t, s.PutHistory(ctx, "abc", own))
+
+			_, err := Import(ctx, s, strings.NewReader(input), JSONL, tt.policy)
+			require.NoError(t, err)
+			history, err := s.History(ctx, "abc")
+			require.NoError(t, err)
+			require.Len(t, history, 1)
+			assert.Equal(t, tt.want, history[0].OrigURL)
+		})
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Export(context.Background(), newStorage(t, testRecords[0]), &buf, CSV)
+	require.NoError(t, err)
+	assert.Equal(t, "short_url,orig_url,owner,created_at,expires_at,disabled,preview,password_hash,history\n"+
+		`abc,"https://example.com/?a=1,b=2",user-1,2024-05-01T12:30:00Z,2030-01-01T00:00:00Z,false,false,,`+"\n", buf.String())
+}
+
+func TestImportPolicies(t *testing.T) {
+	existing := storage.Record{
+		ShortURL:  "abc",
+		OrigURL:   "https://existing.example",
+		CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	input := `{"short_url":"abc","orig_url":"https://imported.example"}
+{"short_url":"new","orig_url":"https://new.example"}
+`
+
+	tests := []struct {
+		policy  Policy
+		stats   Stats
+		wantErr error
+		wantABC string
+	}{
+		{policy: Skip, stats: Stats{Imported: 1, Skipped: 1}, wantABC: "https://existing.example"},
+		{policy: Overwrite, stats: Stats{Imported: 2}, wantABC: "https://imported.example"},
+		{policy: Fail, wantErr: storage.ErrConflict, wantABC: "https://existing.example"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t, existing)
+
+			stats, err := Import(ctx, s, strings.NewReader(input), JSONL, tt.policy)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorContains(t, err, "record 1 (abc)")
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.stats, stats)
+
+			long, err := s.Get(ctx, "abc")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantABC, long)
+		})
+	}
+}
+
+func TestImportDisabled(t *testing.T) {
+	disabled := storage.Record{ShortURL: "abc", OrigURL: "https://example.com", Disabled: true}
+	input := `{"short_url":"abc","orig_url":"https://example.com"}
+{"short_url":"new","orig_url":"https://new.example"}
+`
+
+	tests := []struct {
+		policy       Policy
+		stats        Stats
+		wantErr      bool
+		wantDisabled bool
+	}{
+		{policy: Skip, stats: Stats{Imported: 1, Skipped: 1}, wantDisabled: true},
+		{policy: Overwrite, stats: Stats{Imported: 2}},
+		{policy: Fail, wantErr: true, wantDisabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t, disabled)
+
+			stats, err := Import(ctx, s, strings.NewReader(input), JSONL, tt.policy)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, storage.ErrConflict)
+				assert.ErrorIs(t, err, storage.ErrDisabled)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.stats, stats)
+
+			rec, err := s.GetRecord(ctx, "abc")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDisabled, rec.Disabled)
+		})
+	}
+}
+
+func TestImportCSVColumns(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+
+	// Колонки в другом порядке, без owner и expires_at
+	input := "orig_url,created_at,short_url\nhttps://example.com,2024-05-01T12:30:00Z,abc\n"
+	stats, err := Import(ctx, s, strings.NewReader(input), CSV, Fail)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Imported)
+
+	rec, err := s.GetRecord(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", rec.OrigURL)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), rec.CreatedAt)
+}
+
+func TestImportInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		input   string
+		wantErr string
+		wantIs  error
+	}{
+		{name: "broken json", format: JSONL, input: `{"short_url":`, wantErr: "record 1", wantIs: ErrMalformed},
+		{name: "unknown json field", format: JSONL, input: `{"short_url":"a","orig_url":"b","colour":"blue"}`, wantErr: "record 1", wantIs: ErrMalformed},
+		{name: "missing orig url", format: JSONL, input: `{"short_url":"a","orig_url":"b"}` + "\n" + `{"short_url":"c"}`, wantErr: "record 2 (c)", wantIs: storage.ErrInvalid},
+		{name: "missing csv column", format: CSV, input: "short_url,owner\na,b\n", wantErr: `csv column "orig_url" is missing`, wantIs: ErrMalformed},
+		{name: "unknown csv column", format: CSV, input: "short_url,orig_url,colour\na,b,c\n", wantErr: `unknown csv column "colour"`, wantIs: ErrMalformed},
+		{name: "bad csv time", format: CSV, input: "short_url,orig_url,created_at\na,b,yesterday\n", wantErr: "record 1: created_at", wantIs: ErrMalformed},
+		{name: "unknown format", format: "xml", input: "", wantErr: "unknown format", wantIs: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Import(context.Background(), newStorage(t), strings.NewReader(tt.input), tt.format, Fail)
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.ErrorIs(t, err, tt.wantIs)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	f, err := ParseFormat("csv")
+	require.NoError(t, err)
+	assert.Equal(t, CSV, f)
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+
+	p, err := ParsePolicy("overwrite")
+	require.NoError(t, err)
+	assert.Equal(t, Overwrite, p)
+	_, err = ParsePolicy("merge")
+	assert.Error(t, err)
+}
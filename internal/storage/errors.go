@@ -0,0 +1,23 @@
+package storage
+
+import "errors"
+
+// Ошибки, которые возвращают все хранилища. Бэкенды могут оборачивать их
+// (fmt.Errorf("...: %w", ErrNotFound)), поэтому проверять их нужно через errors.Is.
+var (
+	// ErrNotFound — ссылки с таким ключом нет.
+	ErrNotFound = errors.New("storage: not found")
+	// ErrConflict — короткий URL уже занят другой ссылкой.
+	ErrConflict = errors.New("storage: conflict")
+	// ErrDuplicateURL — у владельца уже есть открытая ссылка на этот URL под
+	// другим коротким адресом.
+	ErrDuplicateURL = errors.New("storage: duplicate long URL")
+	// ErrDeleted — ссылка была удалена.
+	ErrDeleted = errors.New("storage: deleted")
+	// ErrDisabled — ссылка отключена администратором.
+	ErrDisabled = errors.New("storage: disabled")
+	// ErrExpired — срок действия ссылки истёк.
+	ErrExpired = errors.New("storage: expired")
+	// ErrInvalid — некорректные аргументы, например пустой URL.
+	ErrInvalid = errors.New("storage: invalid argument")
+)
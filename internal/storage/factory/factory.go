@@ -0,0 +1,43 @@
+// Package factory выбирает реализацию хранилища по конфигурации.
+package factory
+
+import (
+	"local/config"
+	"local/internal/storage"
+	"local/internal/storage/file"
+	"local/internal/storage/memory"
+	"local/internal/storage/postgres"
+)
+
+// NewStorage создаёт postgres-хранилище, если задан DSN, иначе файловое,
+// если задан путь к файлу, иначе хранилище в памяти.
+func NewStorage(c config.Config) (storage.Storage, error) {
+	if c.DataBaseDSN != "" {
+		s, err := postgres.NewPostgresStorage(c.DataBaseDSN, postgres.Options{
+			MaxOpenConns:     c.DBMaxOpenConns,
+			MaxIdleConns:     c.DBMaxIdleConns,
+			ConnMaxLifetime:  c.DBConnMaxLifetime,
+			ConnMaxIdleTime:  c.DBConnMaxIdleTime,
+			StatementTimeout: c.DBStatementTimeout,
+			ConnectTimeout:   c.DBConnectTimeout,
+			UsePgxPool:       c.DBUsePgxPool,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return storage.WithMetrics(s, "postgres"), nil
+	}
+	if c.FileStorage != "" {
+		s, err := file.NewFileStorage(c.FileStorage)
+		if err != nil {
+			return nil, err
+		}
+		return storage.WithMetrics(s, "file"), nil
+	}
+
+	s, err := memory.NewMemoryStorage()
+	if err != nil {
+		return nil, err
+	}
+	return storage.WithMetrics(s, "memory"), nil
+}
@@ -1,132 +1,376 @@
 package file
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"local/internal/storage/postgres"
+	"local/internal/storage"
+	"local/internal/storage/memory"
 	"local/logger"
-	"log"
 	"os"
 	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Операции журнала.
+const (
+	opPut     = "put"
+	opDelete  = "delete"
+	opHistory = "history"
 )
 
+// entry — строка журнала. Record встраивается, поэтому его поля лежат на
+// верхнем уровне объекта рядом с op. History — прежний адрес ссылки, если
+// запись сделана Update и адрес изменился: так ссылка и её история
+// попадают в файл одной строкой.
+type entry struct {
+	Op string `json:"op"`
+	storage.Record
+	History *storage.HistoryEntry `json:"history,omitempty"`
+	// Entries — вся история ссылки в строке historyEntry.
+	Entries []storage.HistoryEntry `json:"entries,omitempty"`
+}
+
+// deleteEntry — строка журнала об удалении ссылки; читается как entry.
+type deleteEntry struct {
+	Op       string `json:"op"`
+	ShortURL string `json:"short_url"`
+}
+
+// historyEntry — строка журнала, заменяющая историю ссылки; читается как entry.
+type historyEntry struct {
+	Op       string                 `json:"op"`
+	ShortURL string                 `json:"short_url"`
+	Entries  []storage.HistoryEntry `json:"entries"`
+}
+
+// Storage держит индекс ссылок в хранилище в памяти, а файл использует как
+// журнал: каждое изменение дописывается в конец отдельным JSON-объектом.
+// Чтения обслуживает индекс и файл не трогают. Все изменяющие методы индекса
+// переопределены, чтобы изменения попадали в журнал.
 type Storage struct {
-	urls     map[string]string
-	longURLs map[string]string
-	mu       sync.Mutex
-	file     *os.File
+	*memory.Storage
+
+	// mu сериализует изменения: проверку индекса, запись в файл и обновление индекса.
+	mu   sync.Mutex
+	file *os.File
+	now  func() time.Time
 }
 
+// Load читает все JSON-объекты файла по очереди; более поздние дополняют
+// и перезаписывают более ранние. Объекты без поля op — старый формат, где
+// каждый объект был map короткий URL → исходный URL (раньше туда писался
+// весь набор ссылок разом), поэтому старые файлы читаются как есть.
+// Оборванная последняя строка — след сбоя посреди записи — отбрасывается.
 func (us *Storage) Load() error {
 	us.mu.Lock()
 	defer us.mu.Unlock()
 
+	ctx := context.Background()
 	decoder := json.NewDecoder(us.file)
-	if err := decoder.Decode(&us.urls); err != nil && err != io.EOF {
-		return err
-	}
+	for {
+		// Конец последнего целиком прочитанного объекта
+		loaded := decoder.InputOffset()
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return us.dropTornLine(loaded, err)
+		}
 
-	// Восстанавливаем `longURLs` для быстрого поиска по длинному URL
-	us.longURLs = make(map[string]string)
-	for short, long := range us.urls {
-		us.longURLs[long] = short
+		var e entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			// Значения старого формата — строки, в entry они не ложатся
+			e.Op = ""
+		}
+		if e.Op == "" {
+			var legacy map[string]string
+			if err := json.Unmarshal(raw, &legacy); err != nil {
+				return err
+			}
+			for short, long := range legacy {
+				if err := us.Storage.PutRecord(ctx, storage.Record{ShortURL: short, OrigURL: long}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		switch e.Op {
+		case opPut:
+			if err := us.Storage.PutRecord(ctx, e.Record); err != nil {
+				return err
+			}
+			if e.History != nil {
+				us.Storage.AppendHistory(e.ShortURL, *e.History)
+			}
+		case opDelete:
+			if err := us.Storage.Delete(ctx, e.ShortURL); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+		case opHistory:
+			if err := us.Storage.PutHistory(ctx, e.ShortURL, e.Entries); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown journal operation %q", e.Op)
+		}
 	}
 
 	return nil
 }
 
+// dropTornLine обрезает файл после offset, если за ним осталась одна
+// недописанная строка, и возвращает decodeErr, если испорчено что-то ещё:
+// такой журнал чинить автоматически нельзя. Вызывается под mu.
+func (us *Storage) dropTornLine(offset int64, decodeErr error) error {
+	if _, err := us.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	rest, err := io.ReadAll(us.file)
+	if err != nil {
+		return err
+	}
+	torn := bytes.TrimSpace(rest)
+	if bytes.ContainsRune(torn, '\n') {
+		return decodeErr
+	}
+
+	logger.Log.Warn("dropping torn last line of the journal",
+		zap.String("file", us.file.Name()), zap.Int("bytes", len(rest)), zap.Error(decodeErr))
+	end := offset
+	if offset > 0 {
+		// Оставляем перевод строки после последнего целого объекта
+		end++
+	}
+	if err := us.file.Truncate(end); err != nil {
+		return err
+	}
+	if offset > 0 {
+		if _, err := us.file.WriteAt([]byte{'\n'}, offset); err != nil {
+			return err
+		}
+	}
+	return us.file.Sync()
+}
+
 func NewFileStorage(filename string) (*Storage, error) {
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, err
 	}
+	index, err := memory.NewMemoryStorage()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
 	storage := &Storage{
-		urls:     make(map[string]string),
-		longURLs: make(map[string]string),
-		mu:       sync.Mutex{},
-		file:     file,
+		Storage: index,
+		file:    file,
+		now:     time.Now,
+	}
+	if err := storage.Load(); err != nil {
+		file.Close()
+		return nil, err
 	}
-	storage.Load()
 	return storage, nil
 }
 
+// Ping проверяет, что файл хранилища открыт и доступен.
+func (us *Storage) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := us.file.Stat()
+	return err
+}
+
+// Close сбрасывает журнал на диск и закрывает файл.
 func (us *Storage) Close() error {
-	return us.file.Close()
+	return errors.Join(us.file.Sync(), us.file.Close())
 }
 
 func (us *Storage) Save(ctx context.Context, shortURL, longURL string) error {
+	return us.SaveRecord(ctx, storage.Record{ShortURL: shortURL, OrigURL: longURL})
+}
+
+func (us *Storage) SaveRecord(ctx context.Context, rec storage.Record) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err() // Возвращаем ошибку, если контекст отменён
 	default:
 	}
 
+	if err := rec.Validate(); err != nil {
+		logger.FromContext(ctx).Errorf("Invalid argument: %s, %s", rec.ShortURL, rec.OrigURL)
+		return err
+	}
+	now := us.now()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+
 	us.mu.Lock()
 	defer us.mu.Unlock()
 
-	if shortURL == "" || longURL == "" {
-		logger.Log.Errorf("Invalid argument: %s, %s", shortURL, longURL)
-		return errors.New("invalid argument")
+	existing, err := us.Storage.GetRecord(ctx, rec.ShortURL)
+	store, err := storage.ResolveSave(existing, err == nil, rec, now)
+	if err != nil {
+		logger.FromContext(ctx).Infof("URL already exists: %s", rec.ShortURL)
+		return err
 	}
-	if _, exists := us.urls[shortURL]; exists {
-		logger.Log.Infof("URL already exists: %s", shortURL)
-		return errors.New("URL already exists")
+	if !store {
+		return nil
 	}
-	us.urls[shortURL] = longURL
-
-	// Вторичная проверка, чтобы не писать в файл, если контекст отменён
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+	if err := us.put(ctx, rec); err != nil {
+		return err
 	}
 
-	encoder := json.NewEncoder(us.file)
-	if err := encoder.Encode(us.urls); err != nil {
+	logger.FromContext(ctx).Debugf("Saved: %s -> %s", rec.ShortURL, rec.OrigURL)
+	return nil
+}
+
+func (us *Storage) PutRecord(ctx context.Context, rec storage.Record) error {
+	if err := rec.Validate(); err != nil {
 		return err
 	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return us.put(ctx, rec)
+}
+
+// PutRecords записывает пачку одной записью в файл.
+func (us *Storage) PutRecords(ctx context.Context, records []storage.Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range records {
+		if err := rec.Validate(); err != nil {
+			return fmt.Errorf("record %q: %w", rec.ShortURL, err)
+		}
+		if err := enc.Encode(entry{Op: opPut, Record: rec}); err != nil {
+			return err
+		}
+	}
 
-	logger.Log.Info("Saved: %s -> %s", shortURL, longURL)
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if err := us.write(ctx, buf.Bytes()); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := us.Storage.PutRecord(ctx, rec); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (us *Storage) Get(ctx context.Context, shortUrl string) (string, error) {
-	select {
-	case <-ctx.Done():
-		return "", ctx.Err()
-	default:
+func (us *Storage) Update(ctx context.Context, shortURL, actor string, fn func(*storage.Record) error) (storage.Record, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	rec, err := us.Storage.GetRecord(ctx, shortURL)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	updated, err := storage.ApplyUpdate(rec, fn)
+	if err != nil {
+		return rec, err
 	}
+	e := entry{Op: opPut, Record: updated}
+	if h, ok := storage.HistoryOf(rec, updated, actor, us.now()); ok {
+		e.History = &h
+	}
+	if err := us.appendEntry(ctx, e); err != nil {
+		return rec, err
+	}
+	if err := us.Storage.PutRecord(ctx, updated); err != nil {
+		return rec, err
+	}
+	if e.History != nil {
+		us.Storage.AppendHistory(shortURL, *e.History)
+	}
+	return updated, nil
+}
 
+func (us *Storage) PutHistory(ctx context.Context, shortURL string, history []storage.HistoryEntry) error {
 	us.mu.Lock()
 	defer us.mu.Unlock()
 
-	if shortUrl == "" {
-		log.Printf("Invalid argument: %s", shortUrl)
-		return "", errors.New("invalid short URL argument")
+	if _, err := us.Storage.GetRecord(ctx, shortURL); err != nil {
+		return err
 	}
-	value, ok := us.urls[shortUrl]
-	if !ok {
-		return "", errors.New("URL not found in storage")
+	if err := us.appendEntry(ctx, historyEntry{Op: opHistory, ShortURL: shortURL, Entries: history}); err != nil {
+		return err
 	}
+	return us.Storage.PutHistory(ctx, shortURL, history)
+}
+
+// AppendHistory добавляет запись в историю ссылки. Метод индекса в памяти
+// журнал обошёл бы, поэтому запись сохраняется строкой журнала вместе со
+// ссылкой, как в Update.
+func (us *Storage) AppendHistory(ctx context.Context, shortURL string, h storage.HistoryEntry) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
 
-	logger.Log.Info("Retrieved: %s -> %s", shortUrl, value)
-	return value, nil
+	rec, err := us.Storage.GetRecord(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	if err := us.appendEntry(ctx, entry{Op: opPut, Record: rec, History: &h}); err != nil {
+		return err
+	}
+	us.Storage.AppendHistory(shortURL, h)
+	return nil
+}
+
+func (us *Storage) Delete(ctx context.Context, shortURL string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if _, err := us.Storage.GetRecord(ctx, shortURL); err != nil {
+		return err
+	}
+	if err := us.appendEntry(ctx, deleteEntry{Op: opDelete, ShortURL: shortURL}); err != nil {
+		return err
+	}
+	return us.Storage.Delete(ctx, shortURL)
+}
+
+// put дописывает запись в журнал и обновляет индекс. Вызывается под mu.
+func (us *Storage) put(ctx context.Context, rec storage.Record) error {
+	if err := us.appendEntry(ctx, entry{Op: opPut, Record: rec}); err != nil {
+		return err
+	}
+	return us.Storage.PutRecord(ctx, rec)
+}
+
+// appendEntry дописывает запись в конец файла. Вызывается под mu.
+func (us *Storage) appendEntry(ctx context.Context, e any) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return us.write(ctx, append(data, '\n'))
 }
 
-func (us *Storage) FindByLongURL(ctx context.Context, longURL string) (string, error) {
+// write дописывает data в конец файла. Вызывается под mu.
+func (us *Storage) write(ctx context.Context, data []byte) error {
+	// Вторичная проверка, чтобы не писать в файл, если контекст отменён
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return ctx.Err()
 	default:
 	}
-	us.mu.Lock()
-	defer us.mu.Unlock()
-	shortURL, ok := us.longURLs[longURL]
-	if !ok {
-		return "", postgres.ErrURLNotFound
-	}
-	return shortURL, nil
 
+	if _, err := us.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	_, err := us.file.Write(data)
+	return err
 }
@@ -0,0 +1,132 @@
+package file
+
+import (
+	"local/internal/storage"
+	"local/internal/storage/storagetest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+		path := filepath.Join(t.TempDir(), "urls.json")
+		return func() (storage.Storage, error) { return NewFileStorage(path) }
+	}, storagetest.Options{Persistent: true})
+}
+
+// Старые версии перезаписывали файл целиком одним JSON-объектом.
+func TestLoadLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"abc":"https://example.com","def":"https://example.org"}`+"\n"), 0o666))
+
+	s, err := NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	long, err := s.Get(t.Context(), "def")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", long)
+}
+
+// Файл, начатый старой версией, дописывается журналом нового формата.
+func TestLoadMixedFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	content := `{"abc":"https://example.com"}` + "\n" +
+		`{"op":"put","short_url":"abc","orig_url":"https://example.com/moved","owner":"user-1"}` + "\n" +
+		`{"op":"put","short_url":"def","orig_url":"https://example.org","created_at":"2024-05-01T12:30:00Z"}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o666))
+
+	s, err := NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	rec, err := s.GetRecord(t.Context(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/moved", rec.OrigURL)
+	assert.Equal(t, "user-1", rec.Owner)
+
+	rec, err = s.GetRecord(t.Context(), "def")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), rec.CreatedAt)
+}
+
+func TestLoadUnknownOperation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"op":"compact"}`+"\n"), 0o666))
+
+	_, err := NewFileStorage(path)
+	assert.ErrorContains(t, err, `unknown journal operation "compact"`)
+}
+
+// Сбой посреди записи оставляет в конце файла недописанную строку.
+func TestLoadTornLastLine(t *testing.T) {
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{name: "partial object", tail: `{"op":"put","short_url":"def","orig_u`},
+		{name: "zeroed block", tail: "\x00\x00\x00\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "urls.json")
+			content := `{"op":"put","short_url":"abc","orig_url":"https://example.com"}` + "\n" + tt.tail
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o666))
+
+			s, err := NewFileStorage(path)
+			require.NoError(t, err)
+			long, err := s.Get(t.Context(), "abc")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com", long)
+			_, err = s.Get(t.Context(), "def")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			// Новые записи не склеиваются с обрывком
+			require.NoError(t, s.Save(t.Context(), "ghi", "https://example.org"))
+			require.NoError(t, s.Close())
+
+			s, err = NewFileStorage(path)
+			require.NoError(t, err)
+			defer s.Close()
+			long, err = s.Get(t.Context(), "ghi")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.org", long)
+		})
+	}
+}
+
+// Испорченная строка не в конце файла — не след сбоя записи, а повреждение.
+func TestLoadCorruptedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	content := `{"op":"put","short_url":"abc","orig_u` + "\n" +
+		`{"op":"put","short_url":"def","orig_url":"https://example.org"}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o666))
+
+	_, err := NewFileStorage(path)
+	assert.Error(t, err)
+}
+
+func TestAppendHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	s, err := NewFileStorage(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Save(t.Context(), "abc", "https://example.com"))
+	h := storage.HistoryEntry{OrigURL: "https://example.org", Actor: "admin", ChangedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	require.NoError(t, s.AppendHistory(t.Context(), "abc", h))
+	assert.ErrorIs(t, s.AppendHistory(t.Context(), "zzz", h), storage.ErrNotFound)
+	require.NoError(t, s.Close())
+
+	// История записана в журнал, а не только в индекс
+	s, err = NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+	history, err := s.History(t.Context(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, []storage.HistoryEntry{h}, history)
+}
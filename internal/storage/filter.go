@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Filter отбирает ссылки для List. Нулевые поля не ограничивают выборку.
+type Filter struct {
+	// Owner — точное совпадение владельца.
+	Owner string
+	// CreatedFrom и CreatedTo задают полуинтервал [CreatedFrom, CreatedTo)
+	// времени создания.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Domain — хост исходного URL; поддомены тоже подходят.
+	Domain string
+	// Search — подстрока короткого или исходного URL.
+	Search string
+	// Disabled, если задан, оставляет только отключённые или только
+	// включённые ссылки.
+	Disabled *bool
+}
+
+// Match сообщает, подходит ли запись под фильтр.
+func (f Filter) Match(r Record) bool {
+	switch {
+	case f.Owner != "" && r.Owner != f.Owner:
+		return false
+	case !f.CreatedFrom.IsZero() && r.CreatedAt.Before(f.CreatedFrom):
+		return false
+	case !f.CreatedTo.IsZero() && !r.CreatedAt.Before(f.CreatedTo):
+		return false
+	case f.Search != "" && !strings.Contains(r.ShortURL, f.Search) && !strings.Contains(r.OrigURL, f.Search):
+		return false
+	case f.Disabled != nil && r.Disabled != *f.Disabled:
+		return false
+	case f.Domain != "" && !matchDomain(r.OrigURL, f.Domain):
+		return false
+	}
+	return true
+}
+
+// matchDomain сообщает, что хост rawURL — domain или его поддомен.
+func matchDomain(rawURL, domain string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
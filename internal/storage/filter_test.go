@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatch(t *testing.T) {
+	rec := Record{
+		ShortURL:  "abc",
+		OrigURL:   "https://Blog.Example.com:8443/post?id=1",
+		Owner:     "alice",
+		CreatedAt: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+	}
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		filter Filter
+		match  bool
+	}{
+		{name: "empty", filter: Filter{}, match: true},
+		{name: "owner", filter: Filter{Owner: "alice"}, match: true},
+		{name: "other owner", filter: Filter{Owner: "bob"}, match: false},
+		{name: "created in range", filter: Filter{CreatedFrom: rec.CreatedAt, CreatedTo: rec.CreatedAt.Add(time.Second)}, match: true},
+		{name: "created before range", filter: Filter{CreatedFrom: rec.CreatedAt.Add(time.Second)}, match: false},
+		{name: "range end is exclusive", filter: Filter{CreatedTo: rec.CreatedAt}, match: false},
+		{name: "domain", filter: Filter{Domain: "blog.example.com"}, match: true},
+		{name: "parent domain", filter: Filter{Domain: "example.com."}, match: true},
+		{name: "other domain", filter: Filter{Domain: "ample.com"}, match: false},
+		{name: "search in short url", filter: Filter{Search: "bc"}, match: true},
+		{name: "search in orig url", filter: Filter{Search: "post?id"}, match: true},
+		{name: "search miss", filter: Filter{Search: "nothing"}, match: false},
+		{name: "enabled", filter: Filter{Disabled: &no}, match: true},
+		{name: "disabled", filter: Filter{Disabled: &yes}, match: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, tt.filter.Match(rec))
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ResolveSave решает, как SaveRecord поступает с rec, если под тем же коротким
+// URL уже лежит existing (exists — есть ли он вообще). Возвращает true, если
+// rec нужно записать, ErrConflict, если короткий URL занят другой ссылкой
+// (в том числе на тот же URL, но с другим паролем), и ErrDisabled, если он
+// занят отключённой ссылкой.
+// Используется бэкендами, которые держат индекс в памяти.
+func ResolveSave(existing Record, exists bool, rec Record, now time.Time) (bool, error) {
+	switch {
+	case !exists || existing.Expired(now):
+		return true, nil
+	case existing.Disabled:
+		return false, ErrDisabled
+	case existing.OrigURL == rec.OrigURL && existing.PasswordHash == rec.PasswordHash:
+		return false, nil
+	default:
+		return false, ErrConflict
+	}
+}
+
+// IterateSnapshot реализует Iterate поверх снимка записей: сортирует их по
+// короткому URL и вызывает fn для тех, что идут после after.
+func IterateSnapshot(ctx context.Context, records []Record, after string, fn func(Record) error) error {
+	slices.SortFunc(records, func(a, b Record) int { return strings.Compare(a.ShortURL, b.ShortURL) })
+	start, _ := slices.BinarySearchFunc(records, after, func(r Record, key string) int {
+		return strings.Compare(r.ShortURL, key)
+	})
+	for _, rec := range records[start:] {
+		if rec.ShortURL == after {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errListFull останавливает Iterate, когда ListByIterate набрал limit записей.
+var errListFull = errors.New("list is full")
+
+// ListByIterate реализует List поверх Iterate, отбирая записи фильтром.
+func ListByIterate(ctx context.Context, iterate func(context.Context, string, func(Record) error) error, filter Filter, after string, limit int) ([]Record, error) {
+	if limit <= 0 {
+		return nil, ErrInvalid
+	}
+	var records []Record
+	err := iterate(ctx, after, func(rec Record) error {
+		if !filter.Match(rec) {
+			return nil
+		}
+		records = append(records, rec)
+		if len(records) == limit {
+			return errListFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errListFull) {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ApplyUpdate применяет fn к копии rec для Update и проверяет результат.
+func ApplyUpdate(rec Record, fn func(*Record) error) (Record, error) {
+	updated := rec
+	if err := fn(&updated); err != nil {
+		return rec, err
+	}
+	if updated.ShortURL != rec.ShortURL {
+		return rec, ErrInvalid
+	}
+	if err := updated.Validate(); err != nil {
+		return rec, err
+	}
+	return updated, nil
+}
+
+// HistoryOf возвращает запись истории для Update, если fn поменяла исходный
+// URL ссылки old на updated.
+func HistoryOf(old, updated Record, actor string, now time.Time) (HistoryEntry, bool) {
+	if old.OrigURL == updated.OrigURL {
+		return HistoryEntry{}, false
+	}
+	return HistoryEntry{OrigURL: old.OrigURL, Actor: actor, ChangedAt: now}, true
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"local/metrics"
+	"local/tracing"
+	"time"
+)
+
+// instrumented записывает длительность и ошибки каждого вызова хранилища
+// в метрики и оборачивает вызов в спан трассировки.
+type instrumented struct {
+	next    Storage
+	backend string
+}
+
+// WithMetrics оборачивает s так, что все его вызовы попадают в метрики
+// с меткой backend и в трассировку. Бэкенд может дополнить спан из
+// контекста, например текстом SQL-запроса.
+func WithMetrics(s Storage, backend string) Storage {
+	return &instrumented{next: s, backend: backend}
+}
+
+func (s *instrumented) start(ctx context.Context, method string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartKind(ctx, "storage."+method, tracing.KindClient)
+	span.SetAttribute("db.system", s.backend)
+	span.SetAttribute("db.operation", method)
+	return ctx, span
+}
+
+func (s *instrumented) observe(span *tracing.Span, method string, start time.Time, err error) {
+	metrics.StorageOperationDuration.With(s.backend, method).ObserveSince(start)
+	if failed(err) {
+		metrics.StorageErrors.With(s.backend, method).Inc()
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// failed отделяет сбои хранилища от ожидаемых ответов: отсутствующей или
+// недоступной ссылки, конфликта, неверных аргументов и отмены запроса
+// клиентом. Такие ответы — обычная работа и в счётчик ошибок не попадают.
+func failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, expected := range []error{
+		ErrNotFound, ErrConflict, ErrDuplicateURL, ErrDeleted, ErrDisabled,
+		ErrExpired, ErrInvalid, context.Canceled,
+	} {
+		if errors.Is(err, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *instrumented) Get(ctx context.Context, shortUrl string) (string, error) {
+	ctx, span := s.start(ctx, "Get")
+	start := time.Now()
+	longURL, err := s.next.Get(ctx, shortUrl)
+	s.observe(span, "Get", start, err)
+	return longURL, err
+}
+
+func (s *instrumented) Save(ctx context.Context, shortUrl, longUrl string) error {
+	ctx, span := s.start(ctx, "Save")
+	start := time.Now()
+	err := s.next.Save(ctx, shortUrl, longUrl)
+	s.observe(span, "Save", start, err)
+	return err
+}
+
+func (s *instrumented) FindByLongURL(ctx context.Context, longURL string) (string, error) {
+	ctx, span := s.start(ctx, "FindByLongURL")
+	start := time.Now()
+	shortURL, err := s.next.FindByLongURL(ctx, longURL)
+	s.observe(span, "FindByLongURL", start, err)
+	return shortURL, err
+}
+
+func (s *instrumented) FindOwned(ctx context.Context, longURL, owner string) (string, error) {
+	ctx, span := s.start(ctx, "FindOwned")
+	start := time.Now()
+	shortURL, err := s.next.FindOwned(ctx, longURL, owner)
+	s.observe(span, "FindOwned", start, err)
+	return shortURL, err
+}
+
+func (s *instrumented) GetRecord(ctx context.Context, shortURL string) (Record, error) {
+	ctx, span := s.start(ctx, "GetRecord")
+	start := time.Now()
+	rec, err := s.next.GetRecord(ctx, shortURL)
+	s.observe(span, "GetRecord", start, err)
+	return rec, err
+}
+
+func (s *instrumented) SaveRecord(ctx context.Context, rec Record) error {
+	ctx, span := s.start(ctx, "SaveRecord")
+	start := time.Now()
+	err := s.next.SaveRecord(ctx, rec)
+	s.observe(span, "SaveRecord", start, err)
+	return err
+}
+
+func (s *instrumented) PutRecord(ctx context.Context, rec Record) error {
+	ctx, span := s.start(ctx, "PutRecord")
+	start := time.Now()
+	err := s.next.PutRecord(ctx, rec)
+	s.observe(span, "PutRecord", start, err)
+	return err
+}
+
+// Iterate измеряется целиком, вместе со временем работы fn.
+func (s *instrumented) Iterate(ctx context.Context, after string, fn func(Record) error) error {
+	ctx, span := s.start(ctx, "Iterate")
+	start := time.Now()
+	err := s.next.Iterate(ctx, after, fn)
+	s.observe(span, "Iterate", start, err)
+	return err
+}
+
+func (s *instrumented) List(ctx context.Context, filter Filter, after string, limit int) ([]Record, error) {
+	ctx, span := s.start(ctx, "List")
+	start := time.Now()
+	records, err := s.next.List(ctx, filter, after, limit)
+	s.observe(span, "List", start, err)
+	return records, err
+}
+
+func (s *instrumented) Update(ctx context.Context, shortURL, actor string, fn func(*Record) error) (Record, error) {
+	ctx, span := s.start(ctx, "Update")
+	start := time.Now()
+	rec, err := s.next.Update(ctx, shortURL, actor, fn)
+	s.observe(span, "Update", start, err)
+	return rec, err
+}
+
+func (s *instrumented) History(ctx context.Context, shortURL string) ([]HistoryEntry, error) {
+	ctx, span := s.start(ctx, "History")
+	start := time.Now()
+	history, err := s.next.History(ctx, shortURL)
+	s.observe(span, "History", start, err)
+	return history, err
+}
+
+func (s *instrumented) PutHistory(ctx context.Context, shortURL string, history []HistoryEntry) error {
+	ctx, span := s.start(ctx, "PutHistory")
+	start := time.Now()
+	err := s.next.PutHistory(ctx, shortURL, history)
+	s.observe(span, "PutHistory", start, err)
+	return err
+}
+
+func (s *instrumented) Delete(ctx context.Context, shortURL string) error {
+	ctx, span := s.start(ctx, "Delete")
+	start := time.Now()
+	err := s.next.Delete(ctx, shortURL)
+	s.observe(span, "Delete", start, err)
+	return err
+}
+
+func (s *instrumented) Ping(ctx context.Context) error {
+	ctx, span := s.start(ctx, "Ping")
+	start := time.Now()
+	err := s.next.Ping(ctx)
+	s.observe(span, "Ping", start, err)
+	return err
+}
+
+func (s *instrumented) Close() error {
+	start := time.Now()
+	err := s.next.Close()
+	s.observe(nil, "Close", start, err)
+	return err
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"local/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// errStorage — хранилище, все вызовы Get которого возвращают err.
+type errStorage struct {
+	Storage
+	err error
+}
+
+func (s *errStorage) Get(context.Context, string) (string, error) {
+	return "", s.err
+}
+
+func TestInstrumentedErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		counted bool
+	}{
+		{name: "success"},
+		{name: "not found", err: ErrNotFound},
+		{name: "wrapped expired", err: fmt.Errorf("get: %w", ErrExpired)},
+		{name: "disabled", err: ErrDisabled},
+		{name: "conflict", err: ErrConflict},
+		{name: "canceled by client", err: context.Canceled},
+		{name: "timeout", err: context.DeadlineExceeded, counted: true},
+		{name: "outage", err: errors.New("connection refused"), counted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := "test-" + tt.name
+			s := WithMetrics(&errStorage{err: tt.err}, backend)
+			_, _ = s.Get(context.Background(), "abc")
+
+			want := uint64(0)
+			if tt.counted {
+				want = 1
+			}
+			assert.Equal(t, want, metrics.StorageErrors.With(backend, "Get").Value())
+		})
+	}
+}
@@ -2,49 +2,128 @@ package memory
 
 import (
 	"context"
-	"errors"
-	"sync"
+	"local/internal/storage"
+	"local/internal/storage/shardmap"
+	"slices"
+	"time"
 )
 
 type Storage struct {
-	urls     map[string]string
-	longURLs map[string]string
-	mu       sync.RWMutex
+	urls     *shardmap.Map[storage.Record]
+	longURLs *shardmap.Map[string]
+	// owned — индекс по паре владелец и URL (ключ из ownedKey). У разных
+	// владельцев свои ссылки на один URL, а longURLs помнит только последнюю.
+	owned   *shardmap.Map[string]
+	history *shardmap.Map[[]storage.HistoryEntry]
+	now     func() time.Time
 }
 
 func NewMemoryStorage() (*Storage, error) {
 	return &Storage{
-		urls:     make(map[string]string),
-		longURLs: make(map[string]string),
+		urls:     shardmap.New[storage.Record](shardmap.DefaultShards),
+		longURLs: shardmap.New[string](shardmap.DefaultShards),
+		owned:    shardmap.New[string](shardmap.DefaultShards),
+		history:  shardmap.New[[]storage.HistoryEntry](shardmap.DefaultShards),
+		now:      time.Now,
 	}, nil
 }
 
 func (ms *Storage) Save(ctx context.Context, shortURL, longURL string) error {
+	return ms.SaveRecord(ctx, storage.Record{ShortURL: shortURL, OrigURL: longURL})
+}
+
+func (ms *Storage) SaveRecord(ctx context.Context, rec storage.Record) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
 	}
-	ms.mu.Lock()
-	defer ms.mu.Unlock()
-	ms.urls[shortURL] = longURL
-	ms.longURLs[longURL] = shortURL
+	if err := rec.Validate(); err != nil {
+		return err
+	}
+	now := ms.now()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+
+	var err error
+	stored := ms.urls.Update(rec.ShortURL, func(existing storage.Record, exists bool) (storage.Record, bool) {
+		var store bool
+		store, err = storage.ResolveSave(existing, exists, rec, now)
+		return rec, store
+	})
+	if stored {
+		ms.index(rec)
+	}
+	return err
+}
+
+func (ms *Storage) PutRecord(ctx context.Context, rec storage.Record) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if err := rec.Validate(); err != nil {
+		return err
+	}
+	ms.urls.Set(rec.ShortURL, rec)
+	ms.index(rec)
 	return nil
 }
 
+// index добавляет ссылку в индексы по URL. Ссылки с паролем по URL не ищутся.
+// Действующая ссылка в индексе не заменяется: как и в postgres, по URL
+// находится самая старая, и код для URL не меняется от новых ссылок.
+func (ms *Storage) index(rec storage.Record) {
+	if rec.Protected() {
+		return
+	}
+	keep := func(index *shardmap.Map[string], key string, match func(storage.Record) bool) {
+		index.Update(key, func(short string, exists bool) (string, bool) {
+			if exists && short != rec.ShortURL {
+				if _, err := ms.reusable(short, rec.OrigURL, match); err == nil {
+					return short, false
+				}
+			}
+			return rec.ShortURL, true
+		})
+	}
+	keep(ms.longURLs, rec.OrigURL, func(storage.Record) bool { return true })
+	keep(ms.owned, ownedKey(rec.Owner, rec.OrigURL), func(r storage.Record) bool { return r.Owner == rec.Owner })
+}
+
+// ownedKey — ключ индекса owned. Нулевой байт не встречается ни в URL, ни в
+// идентификаторе пользователя.
+func ownedKey(owner, longURL string) string {
+	return owner + "\x00" + longURL
+}
+
 func (ms *Storage) Get(ctx context.Context, shortURL string) (string, error) {
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
 	default:
 	}
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
-	longURL, ok := ms.urls[shortURL]
+	rec, ok := ms.urls.Get(shortURL)
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	if err := rec.Available(ms.now()); err != nil {
+		return "", err
+	}
+	return rec.OrigURL, nil
+}
+
+func (ms *Storage) GetRecord(ctx context.Context, shortURL string) (storage.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.Record{}, err
+	}
+	rec, ok := ms.urls.Get(shortURL)
 	if !ok {
-		return "", errors.New("short URL not found")
+		return storage.Record{}, storage.ErrNotFound
 	}
-	return longURL, nil
+	return rec, nil
 }
 
 func (ms *Storage) FindByLongURL(ctx context.Context, longURL string) (string, error) {
@@ -53,14 +132,134 @@ func (ms *Storage) FindByLongURL(ctx context.Context, longURL string) (string, e
 		return "", ctx.Err()
 	default:
 	}
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
-	shortURL, ok := ms.longURLs[longURL]
+	shortURL, ok := ms.longURLs.Get(longURL)
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	return ms.reusable(shortURL, longURL, func(storage.Record) bool { return true })
+}
+
+func (ms *Storage) FindOwned(ctx context.Context, longURL, owner string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	shortURL, ok := ms.owned.Get(ownedKey(owner, longURL))
 	if !ok {
-		return "", errors.New("long URL not found")
+		return "", storage.ErrNotFound
+	}
+	return ms.reusable(shortURL, longURL, func(rec storage.Record) bool { return rec.Owner == owner })
+}
+
+// reusable проверяет ссылку из индекса: индексы по URL могут отставать от
+// перезаписанных ссылок.
+func (ms *Storage) reusable(shortURL, longURL string, match func(storage.Record) bool) (string, error) {
+	rec, ok := ms.urls.Get(shortURL)
+	if !ok || rec.OrigURL != longURL || !match(rec) || rec.Expired(ms.now()) || rec.Disabled || rec.Protected() {
+		return "", storage.ErrNotFound
 	}
 	return shortURL, nil
 }
+
+func (ms *Storage) Iterate(ctx context.Context, after string, fn func(storage.Record) error) error {
+	records := make([]storage.Record, 0, ms.urls.Len())
+	ms.urls.Range(func(_ string, rec storage.Record) bool {
+		records = append(records, rec)
+		return true
+	})
+	return storage.IterateSnapshot(ctx, records, after, fn)
+}
+
+func (ms *Storage) List(ctx context.Context, filter storage.Filter, after string, limit int) ([]storage.Record, error) {
+	return storage.ListByIterate(ctx, ms.Iterate, filter, after, limit)
+}
+
+func (ms *Storage) Update(ctx context.Context, shortURL, actor string, fn func(*storage.Record) error) (storage.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.Record{}, err
+	}
+	var updated storage.Record
+	var err error
+	stored := ms.urls.Update(shortURL, func(rec storage.Record, exists bool) (storage.Record, bool) {
+		if !exists {
+			err = storage.ErrNotFound
+			return rec, false
+		}
+		updated, err = storage.ApplyUpdate(rec, fn)
+		if err != nil {
+			return rec, false
+		}
+		// История пишется под блокировкой ссылки, чтобы параллельные
+		// изменения попадали в неё в том же порядке
+		if h, ok := storage.HistoryOf(rec, updated, actor, ms.now()); ok {
+			ms.AppendHistory(shortURL, h)
+		}
+		return updated, true
+	})
+	if stored {
+		ms.index(updated)
+	}
+	return updated, err
+}
+
+func (ms *Storage) Delete(ctx context.Context, shortURL string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rec, ok := ms.urls.Get(shortURL)
+	if !ok {
+		return storage.ErrNotFound
+	}
+	ms.urls.Delete(shortURL)
+	ms.history.Delete(shortURL)
+	// Запись индекса по URL могла уже перейти к другой ссылке; устаревшие
+	// записи всё равно отсеивает FindByLongURL
+	if short, ok := ms.longURLs.Get(rec.OrigURL); ok && short == shortURL {
+		ms.longURLs.Delete(rec.OrigURL)
+	}
+	if short, ok := ms.owned.Get(ownedKey(rec.Owner, rec.OrigURL)); ok && short == shortURL {
+		ms.owned.Delete(ownedKey(rec.Owner, rec.OrigURL))
+	}
+	return nil
+}
+
+func (ms *Storage) History(ctx context.Context, shortURL string) ([]storage.HistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := ms.urls.Get(shortURL); !ok {
+		return nil, storage.ErrNotFound
+	}
+	history, _ := ms.history.Get(shortURL)
+	return slices.Clone(history), nil
+}
+
+func (ms *Storage) PutHistory(ctx context.Context, shortURL string, history []storage.HistoryEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := ms.urls.Get(shortURL); !ok {
+		return storage.ErrNotFound
+	}
+	if len(history) == 0 {
+		ms.history.Delete(shortURL)
+		return nil
+	}
+	ms.history.Set(shortURL, slices.Clone(history))
+	return nil
+}
+
+// AppendHistory добавляет запись в историю ссылки. Нужен хранилищам, которые
+// восстанавливают индекс из своего журнала.
+func (ms *Storage) AppendHistory(shortURL string, h storage.HistoryEntry) {
+	ms.history.Update(shortURL, func(history []storage.HistoryEntry, _ bool) ([]storage.HistoryEntry, bool) {
+		return append(history, h), true
+	})
+}
+
+func (ms *Storage) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
 func (ms *Storage) Close() error {
 	return nil
 }
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"local/internal/storage"
+	"local/internal/storage/storagetest"
+	"strconv"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+		return func() (storage.Storage, error) { return NewMemoryStorage() }
+	}, storagetest.Options{})
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	ctx := context.Background()
+	s, _ := NewMemoryStorage()
+
+	const n = 1 << 14
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		_ = s.Save(ctx, keys[i], "https://example.com/"+keys[i])
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := s.Get(ctx, keys[i%n]); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
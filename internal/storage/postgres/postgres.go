@@ -1,109 +1,733 @@
 package postgres
 
 import (
-   "context"
-   "database/sql"
-   "fmt"
-   "local/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"local/internal/storage"
+	"local/logger"
+	"local/tracing"
+	"strconv"
+	"strings"
+	"time"
 
-   "errors"
-   "github.com/jmoiron/sqlx"
-   //"github.com/jackc/pgerrcode"
-   "go.uber.org/zap"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// codeUniqueViolation — SQLSTATE нарушения уникального индекса.
+const codeUniqueViolation = "23505"
+
+// longURLIndex — уникальный индекс открытых ссылок по владельцу и URL.
+const longURLIndex = "short_urls_long_url_key"
 
-   _ "github.com/jackc/pgx/v5/stdlib"
+const (
+	queryGet = `SELECT long_url, expires_at, disabled FROM short_urls WHERE short_url = $1`
+	// Если на один URL ссылаются несколько коротких адресов, возвращаем самый старый.
+	queryFind = `SELECT short_url FROM short_urls
+		WHERE long_url = $1 AND (expires_at IS NULL OR expires_at > $2) AND NOT disabled
+			AND password_hash = ''
+		ORDER BY id LIMIT 1`
+	// Уникальный индекс short_urls_long_url_key оставляет не больше одной
+	// такой ссылки; ORDER BY нужен базам, где его не удалось создать.
+	queryFindOwned = `SELECT short_url FROM short_urls
+		WHERE long_url = $1 AND owner = $3 AND (expires_at IS NULL OR expires_at > $2)
+			AND NOT disabled AND password_hash = ''
+		ORDER BY id LIMIT 1`
+	// Повторная вставка той же пары с тем же паролем затрагивает строку, не
+	// меняя её, истёкшая ссылка заменяется целиком, а занятый другим URL,
+	// другим паролем или отключённой ссылкой короткий адрес не затрагивает ни
+	// одной строки. $9 — текущее время.
+	querySave = `INSERT INTO short_urls (` + recordColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (short_url) DO UPDATE SET
+			long_url = EXCLUDED.long_url,
+			owner = CASE WHEN short_urls.expires_at <= $9 THEN EXCLUDED.owner ELSE short_urls.owner END,
+			created_at = CASE WHEN short_urls.expires_at <= $9 THEN EXCLUDED.created_at ELSE short_urls.created_at END,
+			expires_at = CASE WHEN short_urls.expires_at <= $9 THEN EXCLUDED.expires_at ELSE short_urls.expires_at END,
+			disabled = CASE WHEN short_urls.expires_at <= $9 THEN EXCLUDED.disabled ELSE short_urls.disabled END,
+			preview = CASE WHEN short_urls.expires_at <= $9 THEN EXCLUDED.preview ELSE short_urls.preview END,
+			password_hash = CASE WHEN short_urls.expires_at <= $9 THEN EXCLUDED.password_hash ELSE short_urls.password_hash END
+		WHERE (short_urls.long_url = EXCLUDED.long_url AND short_urls.password_hash = EXCLUDED.password_hash
+			AND NOT short_urls.disabled) OR short_urls.expires_at <= $9`
+	queryPut = `INSERT INTO short_urls (` + recordColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (short_url) DO UPDATE SET
+			long_url = EXCLUDED.long_url,
+			owner = EXCLUDED.owner,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at,
+			disabled = EXCLUDED.disabled,
+			preview = EXCLUDED.preview,
+			password_hash = EXCLUDED.password_hash`
+	queryUpdate = `UPDATE short_urls
+		SET long_url = $2, owner = $3, created_at = $4, expires_at = $5, disabled = $6, preview = $7,
+			password_hash = $8
+		WHERE short_url = $1`
+	queryDelete     = `DELETE FROM short_urls WHERE short_url = $1`
+	queryAddHistory = `INSERT INTO short_url_history (short_url, long_url, actor, changed_at)
+		VALUES ($1, $2, $3, $4)`
+	queryClearHistory = `DELETE FROM short_url_history WHERE short_url = $1`
+	queryHistory      = `SELECT long_url, actor, changed_at FROM short_url_history
+		WHERE short_url = $1 ORDER BY id`
+	recordColumns  = `short_url, long_url, owner, created_at, expires_at, disabled, preview, password_hash`
+	queryGetRecord = `SELECT ` + recordColumns + ` FROM short_urls WHERE short_url = $1`
+	// Короткие URL сравниваются побайтно (COLLATE "C"), как в остальных
+	// хранилищах: иначе порядок и курсор after зависели бы от локали базы, и
+	// контрольная сумма migrate-storage расходилась бы между бэкендами.
+	queryIterate = `SELECT ` + recordColumns + ` FROM short_urls
+		WHERE short_url COLLATE "C" > $1 ORDER BY short_url COLLATE "C" LIMIT $2`
+	// Фильтры, которые дёшево проверить в базе; домен и остальное
+	// окончательно проверяет storage.Filter.Match. Пустые параметры не
+	// ограничивают выборку.
+	queryList = `SELECT ` + recordColumns + ` FROM short_urls
+		WHERE short_url COLLATE "C" > $1
+			AND ($2 = '' OR owner = $2)
+			AND ($3::timestamp IS NULL OR created_at >= $3)
+			AND ($4::timestamp IS NULL OR created_at < $4)
+			AND ($5 = '' OR strpos(short_url, $5) > 0 OR strpos(long_url, $5) > 0)
+			AND ($6 = '' OR strpos(lower(long_url), $6) > 0)
+			AND ($7::boolean IS NULL OR disabled = $7)
+		ORDER BY short_url COLLATE "C" LIMIT $8`
 )
 
-var ErrURLNotFound = errors.New("URL not found")
+// iteratePage — сколько строк Iterate читает за один запрос.
+const iteratePage = 1000
+
+// Options — настройки пула соединений и таймаутов.
+type Options struct {
+	// MaxOpenConns ограничивает количество соединений с базой (0 — без ограничения
+	// для database/sql, значение по умолчанию pgxpool для пула pgx).
+	MaxOpenConns int
+	// MaxIdleConns — сколько простаивающих соединений держать (только database/sql).
+	MaxIdleConns int
+	// ConnMaxLifetime — через сколько соединение закрывается и открывается заново.
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime — через сколько простоя соединение закрывается.
+	ConnMaxIdleTime time.Duration
+	// StatementTimeout передаётся серверу как statement_timeout.
+	StatementTimeout time.Duration
+	// ConnectTimeout ограничивает установку соединения и подготовку таблиц
+	// при запуске.
+	ConnectTimeout time.Duration
+	// UsePgxPool включает нативный пул pgxpool: Get и Save выполняются через
+	// него напрямую, остальные запросы — через database/sql поверх того же пула.
+	UsePgxPool bool
+}
 
 type PostgresStorage struct {
-   db *sqlx.DB
+	db   *sqlx.DB
+	pool *pgxpool.Pool
+
+	// Подготовленные запросы для database/sql. С pgxpool pgx сам кэширует
+	// подготовленные запросы на каждом соединении.
+	getStmt       *sqlx.Stmt
+	saveStmt      *sqlx.Stmt
+	findStmt      *sqlx.Stmt
+	findOwnedStmt *sqlx.Stmt
+
+	now func() time.Time
+}
+
+// recordRow — строка таблицы short_urls. Время хранится в TIMESTAMP без
+// часового пояса и всегда в UTC.
+type recordRow struct {
+	ShortURL     string       `db:"short_url"`
+	LongURL      string       `db:"long_url"`
+	Owner        string       `db:"owner"`
+	CreatedAt    time.Time    `db:"created_at"`
+	ExpiresAt    sql.NullTime `db:"expires_at"`
+	Disabled     bool         `db:"disabled"`
+	Preview      bool         `db:"preview"`
+	PasswordHash string       `db:"password_hash"`
+}
+
+func (r recordRow) record() storage.Record {
+	rec := storage.Record{
+		ShortURL:     r.ShortURL,
+		OrigURL:      r.LongURL,
+		Owner:        r.Owner,
+		CreatedAt:    r.CreatedAt.UTC(),
+		Disabled:     r.Disabled,
+		Preview:      r.Preview,
+		PasswordHash: r.PasswordHash,
+	}
+	if r.ExpiresAt.Valid {
+		rec.ExpiresAt = r.ExpiresAt.Time.UTC()
+	}
+	return rec
+}
+
+// recordArgs — значения колонок записи в порядке recordColumns.
+func recordArgs(rec storage.Record) []any {
+	return []any{rec.ShortURL, rec.OrigURL, rec.Owner, rec.CreatedAt.UTC(), nullTime(rec.ExpiresAt), rec.Disabled, rec.Preview, rec.PasswordHash}
+}
+
+// nullTime превращает нулевое время в NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
 }
 
-func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
-   db, err := sqlx.Open("pgx", dsn) // Используем sqlx.Open вместо sql.Open
-   if err != nil {
-   	logger.Log.Error(err)
-   	return nil, err
-   }
-   if err := db.Ping(); err != nil {
-   	logger.Log.Error(err)
-   	return nil, err
-   }
+func NewPostgresStorage(dsn string, opts Options) (*PostgresStorage, error) {
+	pg := &PostgresStorage{now: time.Now}
+
+	if opts.UsePgxPool {
+		poolCfg, err := pgxpool.ParseConfig(dsn)
+		if err != nil {
+			logger.Log.Error(err)
+			return nil, err
+		}
+		applyConnOptions(poolCfg.ConnConfig, opts)
+		if opts.MaxOpenConns > 0 {
+			poolCfg.MaxConns = int32(opts.MaxOpenConns)
+		}
+		if opts.ConnMaxLifetime > 0 {
+			poolCfg.MaxConnLifetime = opts.ConnMaxLifetime
+		}
+		if opts.ConnMaxIdleTime > 0 {
+			poolCfg.MaxConnIdleTime = opts.ConnMaxIdleTime
+		}
+		pg.pool, err = pgxpool.NewWithConfig(context.Background(), poolCfg)
+		if err != nil {
+			logger.Log.Error(err)
+			return nil, err
+		}
+		pg.db = sqlx.NewDb(stdlib.OpenDBFromPool(pg.pool), "pgx")
+	} else {
+		connCfg, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			logger.Log.Error(err)
+			return nil, err
+		}
+		applyConnOptions(connCfg, opts)
+		pg.db = sqlx.NewDb(stdlib.OpenDB(*connCfg), "pgx")
+		pg.db.SetMaxOpenConns(opts.MaxOpenConns)
+		pg.db.SetMaxIdleConns(opts.MaxIdleConns)
+		pg.db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+		pg.db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+
+	if err := pg.init(opts.ConnectTimeout); err != nil {
+		pg.Close()
+		return nil, err
+	}
+
+	logger.Log.Info("DB and tables are ready")
+
+	return pg, nil
+}
 
-   queryInitTable := `
+// applyConnOptions переносит таймауты в настройки соединения pgx.
+func applyConnOptions(cfg *pgx.ConnConfig, opts Options) {
+	if opts.ConnectTimeout > 0 {
+		cfg.ConnectTimeout = opts.ConnectTimeout
+	}
+	if opts.StatementTimeout > 0 {
+		cfg.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+	}
+}
+
+// init проверяет соединение, создаёт таблицу и готовит запросы. Всё это
+// укладывается в connectTimeout: база, которая приняла соединение, но не
+// отвечает, не должна подвешивать запуск.
+func (pg *PostgresStorage) init(connectTimeout time.Duration) error {
+	ctx := context.Background()
+	if connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+		defer cancel()
+	}
+
+	if err := pg.db.PingContext(ctx); err != nil {
+		logger.Log.Error(err)
+		return err
+	}
+
+	queryInitTable := `
    CREATE TABLE IF NOT EXISTS short_urls (
    id SERIAL PRIMARY KEY,
    short_url VARCHAR(255) UNIQUE NOT NULL,
-   long_url VARCHAR(255) NOT NULL,
+   long_url TEXT NOT NULL,
    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
    );
    `
-   _, err = db.Exec(queryInitTable)
-   if err != nil {
-   	logger.Log.Error("error creating table", zap.Error(err))
-   	return nil, err
-   }
+	if _, err := pg.db.ExecContext(ctx, queryInitTable); err != nil {
+		logger.Log.Error("error creating table", zap.Error(err))
+		return err
+	}
+
+	// Старые таблицы создавались с long_url VARCHAR(255). Смена типа берёт
+	// ACCESS EXCLUSIVE блокировку, поэтому выполняется только для таких таблиц.
+	// Длинные URL не помещаются в B-tree индекс, поэтому поиск по long_url идёт
+	// через hash-индекс: он хранит только хеш значения.
+	queryMigrate := `
+   DO $$
+   BEGIN
+     IF EXISTS (SELECT 1 FROM information_schema.columns
+       WHERE table_schema = current_schema() AND table_name = 'short_urls'
+         AND column_name = 'long_url' AND data_type <> 'text') THEN
+       ALTER TABLE short_urls ALTER COLUMN long_url TYPE TEXT;
+     END IF;
+   END $$;
+   CREATE INDEX IF NOT EXISTS short_urls_long_url_idx ON short_urls USING hash (long_url);
+   ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+   ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+   ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+   ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS preview BOOLEAN NOT NULL DEFAULT FALSE;
+   ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
+   CREATE TABLE IF NOT EXISTS short_url_history (
+   id BIGSERIAL PRIMARY KEY,
+   short_url VARCHAR(255) NOT NULL REFERENCES short_urls (short_url) ON DELETE CASCADE,
+   long_url TEXT NOT NULL,
+   actor TEXT NOT NULL DEFAULT '',
+   changed_at TIMESTAMP NOT NULL
+   );
+   CREATE INDEX IF NOT EXISTS short_url_history_short_url_idx ON short_url_history (short_url, id);
+   CREATE INDEX IF NOT EXISTS short_urls_short_url_c_idx ON short_urls (short_url COLLATE "C");
+   `
+	if _, err := pg.db.ExecContext(ctx, queryMigrate); err != nil {
+		logger.Log.Error("error migrating table", zap.Error(err))
+		return err
+	}
 
-   logger.Log.Info("DB and tables are ready")
+	// Уникальность long_url держит выражение md5(long_url): hash-индексы
+	// уникальными не бывают, а B-tree по самому URL упирается в размер ключа.
+	// Ограничение действует в пределах владельца и только для открытых ссылок:
+	// у разных пользователей и у ссылок с паролем свои короткие адреса на тот
+	// же URL. В старых базах уже могут быть дубликаты, чьи короткие адреса
+	// разошлись по рукам, — тогда индекс не создаётся, а запуск продолжается.
+	queryUniqueLongURL := `
+   CREATE UNIQUE INDEX IF NOT EXISTS ` + longURLIndex + `
+   ON short_urls (md5(long_url), owner) WHERE password_hash = ''
+   `
+	if _, err := pg.db.ExecContext(ctx, queryUniqueLongURL); err != nil {
+		if !isUniqueViolation(err) {
+			logger.Log.Error("error creating long url index", zap.Error(err))
+			return err
+		}
+		logger.Log.Warn("duplicate long urls, unique index not created", zap.Error(err))
+	}
 
-   return &PostgresStorage{
-   	db: db,
-   }, nil
+	if pg.pool != nil {
+		return nil
+	}
+
+	var err error
+	if pg.getStmt, err = pg.db.PreparexContext(ctx, queryGet); err != nil {
+		logger.Log.Error("error preparing statement", zap.Error(err))
+		return err
+	}
+	if pg.saveStmt, err = pg.db.PreparexContext(ctx, querySave); err != nil {
+		logger.Log.Error("error preparing statement", zap.Error(err))
+		return err
+	}
+	if pg.findStmt, err = pg.db.PreparexContext(ctx, queryFind); err != nil {
+		logger.Log.Error("error preparing statement", zap.Error(err))
+		return err
+	}
+	if pg.findOwnedStmt, err = pg.db.PreparexContext(ctx, queryFindOwned); err != nil {
+		logger.Log.Error("error preparing statement", zap.Error(err))
+		return err
+	}
+	return nil
 }
 
-func (pg *PostgresStorage) PingDataBase() error {
-   return pg.db.Ping()
+// isUniqueViolation сообщает, что запрос нарушил уникальный индекс.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == codeUniqueViolation
+}
+
+// conflictOr превращает нарушение уникальности в ошибку хранилища: индекс
+// longURLIndex — в storage.ErrDuplicateURL, остальные — в storage.ErrConflict.
+func conflictOr(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != codeUniqueViolation {
+		return err
+	}
+	if pgErr.ConstraintName == longURLIndex {
+		return fmt.Errorf("%w: %w", storage.ErrDuplicateURL, err)
+	}
+	return fmt.Errorf("%w: %w", storage.ErrConflict, err)
+}
+
+// keepDuplicates выполняет put и, если записываемые ссылки повторяют уже
+// сохранённые URL, удаляет индекс longURLIndex и повторяет put. PutRecord
+// переносит ссылки, чьи короткие адреса уже разошлись по рукам, поэтому
+// дубликаты из старых данных не теряются, как и при запуске на старой базе.
+func (pg *PostgresStorage) keepDuplicates(ctx context.Context, put func() error) error {
+	err := put()
+	if !errors.Is(err, storage.ErrDuplicateURL) {
+		return err
+	}
+	logger.Log.Warn("imported links duplicate long urls, dropping unique index", zap.Error(err))
+	if _, dropErr := pg.db.ExecContext(ctx, `DROP INDEX IF EXISTS `+longURLIndex); dropErr != nil {
+		return errors.Join(err, dropErr)
+	}
+	return put()
+}
+
+func (pg *PostgresStorage) Ping(ctx context.Context) error {
+	return pg.db.PingContext(ctx)
 }
 
 func (pg *PostgresStorage) Close() error {
-   if err := pg.db.Close(); err != nil {
-   	logger.Log.Error("error closing database connection:", zap.Error(err))
-   	return err
-   }
-   return nil
+	for _, stmt := range []*sqlx.Stmt{pg.getStmt, pg.saveStmt, pg.findStmt, pg.findOwnedStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	if err := pg.db.Close(); err != nil {
+		logger.Log.Error("error closing database connection:", zap.Error(err))
+		return err
+	}
+	// Пул закрывается после database/sql, который берёт из него соединения
+	if pg.pool != nil {
+		pg.pool.Close()
+	}
+	return nil
 }
 
 func (pg *PostgresStorage) Get(ctx context.Context, shortURL string) (string, error) {
-   queryGet := `SELECT long_url FROM short_urls WHERE short_url = $1`
-   var longURL string
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryGet)
+	var longURL string
+	var expiresAt sql.NullTime
+	var disabled bool
 
-   // Используем sqlx.QueryRowx, который поддерживает более удобную работу с результатами
-   err := pg.db.GetContext(ctx, &longURL, queryGet, shortURL)
-   if err != nil {
-   	logger.Log.Error("short URL not found", zap.String("short_url", shortURL))
-   	return "", fmt.Errorf("short URL not found")
-   }
-   return longURL, nil
+	var err error
+	if pg.pool != nil {
+		err = pg.pool.QueryRow(ctx, queryGet, shortURL).Scan(&longURL, &expiresAt, &disabled)
+	} else {
+		err = pg.getStmt.QueryRowxContext(ctx, shortURL).Scan(&longURL, &expiresAt, &disabled)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("error getting short URL", zap.String("short_url", shortURL), zap.Error(err))
+		return "", fmt.Errorf("get %q: %w", shortURL, err)
+	}
+	if expiresAt.Valid && !pg.now().Before(expiresAt.Time) {
+		return "", storage.ErrExpired
+	}
+	if disabled {
+		return "", storage.ErrDisabled
+	}
+	return longURL, nil
+}
+
+func (pg *PostgresStorage) GetRecord(ctx context.Context, shortURL string) (storage.Record, error) {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryGetRecord)
+	var row recordRow
+	err := pg.db.GetContext(ctx, &row, queryGetRecord, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Record{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return storage.Record{}, fmt.Errorf("get record %q: %w", shortURL, err)
+	}
+	return row.record(), nil
 }
 
 func (pg *PostgresStorage) Save(ctx context.Context, shortURL string, longURL string) error {
-   querySave := `INSERT INTO short_urls (short_url, long_url) VALUES ($1, $2) ON CONFLICT (short_url) DO NOTHING`
-   // Используем ExecContext для выполнения запроса
-   _, err := pg.db.ExecContext(ctx, querySave, shortURL, longURL)
-   if err != nil {
-   	logger.Log.Debug("error saving short url", zap.Error(err))
-   	return err
-   }
-   logger.Log.Debug("short url saved", zap.String("shortURL", shortURL))
-   return nil
-}
-
-func (pg *PostgresStorage) FindByLongURL(ctx context.Context, shortURL string) (string, error) {
-   select {
-   case <-ctx.Done():
-   	return "", ctx.Err()
-   default:
-   }
-   queryGet := `SELECT short_url FROM short_urls WHERE short_url = $1`
-   var longURL string
-   err := pg.db.GetContext(ctx, &longURL, queryGet, shortURL)
-   if err != nil {
-   	if errors.Is(err,sql.ErrNoRows) {
-   		return "", ErrURLNotFound // Если записи нет, возвращаем ошибку "не найдено"
-   	}
-   	logger.Log.Debug("error getting short URL", zap.Error(err))
-   	return "", err
-   }
-   return shortURL, nil
+	return pg.SaveRecord(ctx, storage.Record{ShortURL: shortURL, OrigURL: longURL})
+}
+
+func (pg *PostgresStorage) SaveRecord(ctx context.Context, rec storage.Record) error {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", querySave)
+
+	if err := rec.Validate(); err != nil {
+		return err
+	}
+	now := pg.now().UTC()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	args := append(recordArgs(rec), now)
+
+	var affected int64
+	if pg.pool != nil {
+		tag, err := pg.pool.Exec(ctx, querySave, args...)
+		if err != nil {
+			logger.FromContext(ctx).Debug("error saving short url", zap.Error(err))
+			return conflictOr(err)
+		}
+		affected = tag.RowsAffected()
+	} else {
+		res, err := pg.saveStmt.ExecContext(ctx, args...)
+		if err != nil {
+			logger.FromContext(ctx).Debug("error saving short url", zap.Error(err))
+			return conflictOr(err)
+		}
+		if affected, err = res.RowsAffected(); err != nil {
+			return err
+		}
+	}
+	if affected == 0 {
+		// Уточняем, чем занят короткий адрес
+		if existing, err := pg.GetRecord(ctx, rec.ShortURL); err == nil && existing.Disabled {
+			return storage.ErrDisabled
+		}
+		return storage.ErrConflict
+	}
+	logger.FromContext(ctx).Debug("short url saved", zap.String("shortURL", rec.ShortURL))
+	return nil
+}
+
+func (pg *PostgresStorage) PutRecord(ctx context.Context, rec storage.Record) error {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryPut)
+
+	if err := rec.Validate(); err != nil {
+		return err
+	}
+	return pg.keepDuplicates(ctx, func() error {
+		if _, err := pg.db.ExecContext(ctx, queryPut, recordArgs(rec)...); err != nil {
+			return fmt.Errorf("put %q: %w", rec.ShortURL, conflictOr(err))
+		}
+		return nil
+	})
+}
+
+// PutRecords записывает пачку в одной транзакции.
+func (pg *PostgresStorage) PutRecords(ctx context.Context, records []storage.Record) error {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryPut)
+
+	for _, rec := range records {
+		if err := rec.Validate(); err != nil {
+			return fmt.Errorf("record %q: %w", rec.ShortURL, err)
+		}
+	}
+	return pg.keepDuplicates(ctx, func() error { return pg.putRecords(ctx, records) })
+}
+
+func (pg *PostgresStorage) putRecords(ctx context.Context, records []storage.Record) error {
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, queryPut)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, rec := range records {
+		if _, err := stmt.ExecContext(ctx, recordArgs(rec)...); err != nil {
+			return fmt.Errorf("put %q: %w", rec.ShortURL, conflictOr(err))
+		}
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresStorage) FindByLongURL(ctx context.Context, longURL string) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryFind)
+	return pg.find(ctx, pg.findStmt, queryFind, longURL, pg.now().UTC())
+}
+
+func (pg *PostgresStorage) FindOwned(ctx context.Context, longURL, owner string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryFindOwned)
+	return pg.find(ctx, pg.findOwnedStmt, queryFindOwned, longURL, pg.now().UTC(), owner)
+}
+
+// find выполняет запрос поиска короткого URL: через pgxpool, если он включён,
+// иначе через подготовленный stmt.
+func (pg *PostgresStorage) find(ctx context.Context, stmt *sqlx.Stmt, query string, args ...any) (string, error) {
+	var shortURL string
+	var err error
+	if pg.pool != nil {
+		err = pg.pool.QueryRow(ctx, query, args...).Scan(&shortURL)
+	} else {
+		err = stmt.GetContext(ctx, &shortURL, args...)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", storage.ErrNotFound // Если записи нет, возвращаем ошибку "не найдено"
+		}
+		logger.FromContext(ctx).Debug("error getting short URL", zap.Error(err))
+		return "", err
+	}
+	return shortURL, nil
+}
+
+// Iterate читает таблицу страницами по короткому URL. Страница вычитывается
+// целиком до вызова fn, чтобы не держать соединение, пока fn работает.
+func (pg *PostgresStorage) Iterate(ctx context.Context, after string, fn func(storage.Record) error) error {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryIterate)
+	for {
+		var rows []recordRow
+		if err := pg.db.SelectContext(ctx, &rows, queryIterate, after, iteratePage); err != nil {
+			return fmt.Errorf("iterate after %q: %w", after, err)
+		}
+		for _, row := range rows {
+			if err := fn(row.record()); err != nil {
+				return err
+			}
+		}
+		if len(rows) < iteratePage {
+			return nil
+		}
+		after = rows[len(rows)-1].ShortURL
+	}
+}
+
+// List читает таблицу страницами, пока не наберёт limit подходящих записей.
+func (pg *PostgresStorage) List(ctx context.Context, filter storage.Filter, after string, limit int) ([]storage.Record, error) {
+	if limit <= 0 {
+		return nil, storage.ErrInvalid
+	}
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryList)
+
+	var records []storage.Record
+	for {
+		var rows []recordRow
+		err := pg.db.SelectContext(ctx, &rows, queryList, after,
+			filter.Owner, nullTime(filter.CreatedFrom), nullTime(filter.CreatedTo),
+			filter.Search, strings.ToLower(filter.Domain), filter.Disabled, iteratePage)
+		if err != nil {
+			return nil, fmt.Errorf("list after %q: %w", after, err)
+		}
+		for _, row := range rows {
+			rec := row.record()
+			if !filter.Match(rec) {
+				continue
+			}
+			records = append(records, rec)
+			if len(records) == limit {
+				return records, nil
+			}
+		}
+		if len(rows) < iteratePage {
+			return records, nil
+		}
+		after = rows[len(rows)-1].ShortURL
+	}
+}
+
+func (pg *PostgresStorage) Update(ctx context.Context, shortURL, actor string, fn func(*storage.Record) error) (storage.Record, error) {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryUpdate)
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	defer tx.Rollback()
+
+	var row recordRow
+	err = tx.GetContext(ctx, &row, queryGetRecord+` FOR UPDATE`, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Record{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return storage.Record{}, fmt.Errorf("update %q: %w", shortURL, err)
+	}
+
+	rec := row.record()
+	updated, err := storage.ApplyUpdate(rec, fn)
+	if err != nil {
+		return rec, err
+	}
+	if _, err := tx.ExecContext(ctx, queryUpdate, recordArgs(updated)...); err != nil {
+		return rec, fmt.Errorf("update %q: %w", shortURL, conflictOr(err))
+	}
+	if h, ok := storage.HistoryOf(rec, updated, actor, pg.now()); ok {
+		if _, err := tx.ExecContext(ctx, queryAddHistory, shortURL, h.OrigURL, h.Actor, h.ChangedAt.UTC()); err != nil {
+			return rec, fmt.Errorf("update %q history: %w", shortURL, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return rec, fmt.Errorf("update %q: %w", shortURL, err)
+	}
+	return updated, nil
+}
+
+// historyRow — строка таблицы short_url_history.
+type historyRow struct {
+	LongURL   string    `db:"long_url"`
+	Actor     string    `db:"actor"`
+	ChangedAt time.Time `db:"changed_at"`
+}
+
+func (pg *PostgresStorage) History(ctx context.Context, shortURL string) ([]storage.HistoryEntry, error) {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryHistory)
+
+	var rows []historyRow
+	if err := pg.db.SelectContext(ctx, &rows, queryHistory, shortURL); err != nil {
+		return nil, fmt.Errorf("history %q: %w", shortURL, err)
+	}
+	// Пустая история не отличает ссылку без изменений от несуществующей
+	if len(rows) == 0 {
+		if _, err := pg.GetRecord(ctx, shortURL); err != nil {
+			return nil, err
+		}
+	}
+	history := make([]storage.HistoryEntry, 0, len(rows))
+	for _, row := range rows {
+		history = append(history, storage.HistoryEntry{
+			OrigURL:   row.LongURL,
+			Actor:     row.Actor,
+			ChangedAt: row.ChangedAt.UTC(),
+		})
+	}
+	return history, nil
+}
+
+// PutHistory заменяет историю в одной транзакции; строка ссылки блокируется,
+// чтобы параллельный Update не дописал историю между удалением и вставкой.
+func (pg *PostgresStorage) PutHistory(ctx context.Context, shortURL string, history []storage.HistoryEntry) error {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryAddHistory)
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked string
+	err = tx.GetContext(ctx, &locked, `SELECT short_url FROM short_urls WHERE short_url = $1 FOR UPDATE`, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("put history %q: %w", shortURL, err)
+	}
+	if _, err := tx.ExecContext(ctx, queryClearHistory, shortURL); err != nil {
+		return fmt.Errorf("put history %q: %w", shortURL, err)
+	}
+	for _, h := range history {
+		if _, err := tx.ExecContext(ctx, queryAddHistory, shortURL, h.OrigURL, h.Actor, h.ChangedAt.UTC()); err != nil {
+			return fmt.Errorf("put history %q: %w", shortURL, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresStorage) Delete(ctx context.Context, shortURL string) error {
+	tracing.SpanFromContext(ctx).SetAttribute("db.statement", queryDelete)
+
+	res, err := pg.db.ExecContext(ctx, queryDelete, shortURL)
+	if err != nil {
+		return fmt.Errorf("delete %q: %w", shortURL, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
 }
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"local/internal/storage"
+	"local/internal/storage/storagetest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSNEnv — переменная окружения с DSN тестовой базы. Без неё тесты пропускаются.
+// Таблица short_urls в этой базе очищается перед каждым тестом.
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	for _, usePool := range []bool{false, true} {
+		name := "database/sql"
+		if usePool {
+			name = "pgxpool"
+		}
+		t.Run(name, func(t *testing.T) {
+			opts := Options{UsePgxPool: usePool}
+			storagetest.Run(t, func(t *testing.T) storagetest.Opener {
+				pg, err := NewPostgresStorage(dsn, opts)
+				require.NoError(t, err)
+				_, err = pg.db.Exec(`TRUNCATE short_urls, short_url_history`)
+				require.NoError(t, err)
+				require.NoError(t, pg.Close())
+
+				return func() (storage.Storage, error) { return NewPostgresStorage(dsn, opts) }
+			}, storagetest.Options{Persistent: true})
+		})
+	}
+}
+
+func TestApplyConnOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		dsn              string
+		opts             Options
+		connectTimeout   time.Duration
+		statementTimeout string
+	}{
+		{name: "defaults keep the DSN", dsn: "postgres://localhost/db?connect_timeout=3", connectTimeout: 3 * time.Second},
+		{
+			name:             "options",
+			dsn:              "postgres://localhost/db",
+			opts:             Options{ConnectTimeout: 5 * time.Second, StatementTimeout: 1500 * time.Millisecond},
+			connectTimeout:   5 * time.Second,
+			statementTimeout: "1500",
+		},
+		{
+			name:             "options override the DSN",
+			dsn:              "postgres://localhost/db?connect_timeout=3&statement_timeout=100",
+			opts:             Options{ConnectTimeout: time.Second, StatementTimeout: 2 * time.Second},
+			connectTimeout:   time.Second,
+			statementTimeout: "2000",
+		},
+		{
+			name:             "statement timeout from the DSN",
+			dsn:              "postgres://localhost/db?statement_timeout=100",
+			statementTimeout: "100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := pgx.ParseConfig(tt.dsn)
+			require.NoError(t, err)
+
+			applyConnOptions(cfg, tt.opts)
+
+			assert.Equal(t, tt.connectTimeout, cfg.ConnectTimeout)
+			assert.Equal(t, tt.statementTimeout, cfg.RuntimeParams["statement_timeout"])
+		})
+	}
+}
+
+func TestConflictOr(t *testing.T) {
+	dup := &pgconn.PgError{Code: codeUniqueViolation}
+	assert.ErrorIs(t, conflictOr(dup), storage.ErrConflict)
+	assert.ErrorIs(t, conflictOr(fmt.Errorf("wrapped: %w", dup)), storage.ErrConflict)
+
+	dupURL := &pgconn.PgError{Code: codeUniqueViolation, ConstraintName: longURLIndex}
+	assert.ErrorIs(t, conflictOr(dupURL), storage.ErrDuplicateURL)
+	assert.NotErrorIs(t, conflictOr(dupURL), storage.ErrConflict)
+
+	other := &pgconn.PgError{Code: "57014"}
+	assert.Same(t, other, conflictOr(other))
+}
+
+func TestUniqueLongURL(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	pg, err := NewPostgresStorage(dsn, Options{})
+	require.NoError(t, err)
+	_, err = pg.db.Exec(`TRUNCATE short_urls, short_url_history`)
+	require.NoError(t, err)
+	require.NoError(t, pg.Close())
+
+	// Повторный запуск на уже мигрированной таблице проходит без ошибок
+	pg, err = NewPostgresStorage(dsn, Options{})
+	require.NoError(t, err)
+	defer pg.Close()
+	ctx := context.Background()
+
+	const long = "https://example.com/unique"
+	require.NoError(t, pg.SaveRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: long, Owner: "u1"}))
+	assert.ErrorIs(t, pg.SaveRecord(ctx, storage.Record{ShortURL: "def", OrigURL: long, Owner: "u1"}), storage.ErrDuplicateURL)
+
+	// Другой владелец и ссылка с паролем получают свои короткие адреса
+	require.NoError(t, pg.SaveRecord(ctx, storage.Record{ShortURL: "ghi", OrigURL: long, Owner: "u2"}))
+	require.NoError(t, pg.SaveRecord(ctx, storage.Record{ShortURL: "jkl", OrigURL: long, Owner: "u1", PasswordHash: "hash"}))
+
+	// Сменить адрес на уже занятый владельцем URL нельзя
+	require.NoError(t, pg.SaveRecord(ctx, storage.Record{ShortURL: "mno", OrigURL: "https://example.com/other", Owner: "u1"}))
+	_, err = pg.Update(ctx, "mno", "test", func(rec *storage.Record) error {
+		rec.OrigURL = long
+		return nil
+	})
+	assert.ErrorIs(t, err, storage.ErrDuplicateURL)
+}
+
+func TestPutDuplicateLongURLs(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	pg, err := NewPostgresStorage(dsn, Options{})
+	require.NoError(t, err)
+	_, err = pg.db.Exec(`TRUNCATE short_urls, short_url_history`)
+	require.NoError(t, err)
+	require.NoError(t, pg.Close())
+
+	pg, err = NewPostgresStorage(dsn, Options{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Старые данные с дубликатами переносятся целиком: их короткие адреса
+	// уже разошлись по рукам
+	const long = "https://example.com/dup"
+	require.NoError(t, pg.PutRecords(ctx, []storage.Record{
+		{ShortURL: "abc", OrigURL: long},
+		{ShortURL: "def", OrigURL: long},
+	}))
+	require.NoError(t, pg.PutRecord(ctx, storage.Record{ShortURL: "ghi", OrigURL: long}))
+	for _, short := range []string{"abc", "def", "ghi"} {
+		got, err := pg.Get(ctx, short)
+		require.NoError(t, err, short)
+		assert.Equal(t, long, got)
+	}
+	short, err := pg.FindOwned(ctx, long, "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", short)
+	require.NoError(t, pg.Close())
+
+	// Запуск на базе с дубликатами продолжается без индекса
+	pg, err = NewPostgresStorage(dsn, Options{})
+	require.NoError(t, err)
+	require.NoError(t, pg.Close())
+}
@@ -0,0 +1,129 @@
+// Package shardmap реализует потокобезопасную map со строковыми ключами,
+// разбитую на шарды с собственным RWMutex. Конкурентные операции над
+// разными ключами почти не блокируют друг друга.
+package shardmap
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// DefaultShards — количество шардов по умолчанию.
+const DefaultShards = 64
+
+type shard[V any] struct {
+	mu sync.RWMutex
+	m  map[string]V
+}
+
+// Map — шардированная map. Нулевое значение не готово к использованию,
+// создавайте Map через New.
+type Map[V any] struct {
+	seed   maphash.Seed
+	mask   uint64
+	shards []shard[V]
+}
+
+// New создаёт Map с количеством шардов, округлённым вверх до степени двойки.
+func New[V any](shards int) *Map[V] {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	m := &Map[V]{
+		seed:   maphash.MakeSeed(),
+		mask:   uint64(n - 1),
+		shards: make([]shard[V], n),
+	}
+	for i := range m.shards {
+		m.shards[i].m = make(map[string]V)
+	}
+	return m
+}
+
+func (m *Map[V]) shard(key string) *shard[V] {
+	return &m.shards[maphash.String(m.seed, key)&m.mask]
+}
+
+// Get возвращает значение по ключу.
+func (m *Map[V]) Get(key string) (V, bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	v, ok := s.m[key]
+	s.mu.RUnlock()
+	return v, ok
+}
+
+// Set сохраняет значение, перезаписывая существующее.
+func (m *Map[V]) Set(key string, value V) {
+	s := m.shard(key)
+	s.mu.Lock()
+	s.m[key] = value
+	s.mu.Unlock()
+}
+
+// SetIfAbsent сохраняет значение, только если ключа ещё нет. Возвращает
+// значение, лежащее в map после вызова, и true, если оно уже было там.
+func (m *Map[V]) SetIfAbsent(key string, value V) (V, bool) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.m[key]; ok {
+		return existing, true
+	}
+	s.m[key] = value
+	return value, false
+}
+
+// Update атомарно вызывает fn с текущим значением ключа (exists — есть ли
+// оно) и сохраняет возвращённое значение, если fn вернула true. Возвращает,
+// было ли значение сохранено. fn выполняется под блокировкой шарда и не
+// должна обращаться к Map.
+func (m *Map[V]) Update(key string, fn func(old V, exists bool) (V, bool)) bool {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, exists := s.m[key]
+	value, store := fn(old, exists)
+	if store {
+		s.m[key] = value
+	}
+	return store
+}
+
+// Delete удаляет ключ.
+func (m *Map[V]) Delete(key string) {
+	s := m.shard(key)
+	s.mu.Lock()
+	delete(s.m, key)
+	s.mu.Unlock()
+}
+
+// Len возвращает количество элементов.
+func (m *Map[V]) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Range вызывает fn для каждой пары, пока fn возвращает true. Шард
+// блокируется на чтение на время его обхода, поэтому fn не должна менять Map.
+// Изменения, сделанные конкурентно, могут быть не видны.
+func (m *Map[V]) Range(fn func(key string, value V) bool) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for k, v := range s.m {
+			if !fn(k, v) {
+				s.mu.RUnlock()
+				return
+			}
+		}
+		s.mu.RUnlock()
+	}
+}
@@ -0,0 +1,148 @@
+package shardmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap(t *testing.T) {
+	m := New[string](5)
+	assert.Len(t, m.shards, 8)
+
+	_, ok := m.Get("a")
+	assert.False(t, ok)
+
+	m.Set("a", "1")
+	v, ok := m.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", v)
+
+	v, loaded := m.SetIfAbsent("a", "2")
+	assert.True(t, loaded)
+	assert.Equal(t, "1", v)
+
+	v, loaded = m.SetIfAbsent("b", "2")
+	assert.False(t, loaded)
+	assert.Equal(t, "2", v)
+	assert.Equal(t, 2, m.Len())
+
+	seen := map[string]string{}
+	m.Range(func(k, v string) bool {
+		seen[k] = v
+		return true
+	})
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, seen)
+
+	stored := m.Update("a", func(old string, exists bool) (string, bool) {
+		assert.True(t, exists)
+		assert.Equal(t, "1", old)
+		return "3", true
+	})
+	assert.True(t, stored)
+	v, _ = m.Get("a")
+	assert.Equal(t, "3", v)
+
+	stored = m.Update("c", func(old string, exists bool) (string, bool) {
+		assert.False(t, exists)
+		return "x", false
+	})
+	assert.False(t, stored)
+	_, ok = m.Get("c")
+	assert.False(t, ok)
+
+	m.Delete("a")
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestMapConcurrentSetIfAbsent(t *testing.T) {
+	m := New[int](DefaultShards)
+
+	var wg sync.WaitGroup
+	winners := make([]int, 100)
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range winners {
+				if _, loaded := m.SetIfAbsent(strconv.Itoa(i), g); !loaded {
+					winners[i]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Каждый ключ записан ровно одной горутиной
+	for i, n := range winners {
+		assert.Equal(t, 1, n, "key %d", i)
+	}
+}
+
+// mutexMap — map под одним RWMutex, как было в хранилищах до шардирования.
+type mutexMap struct {
+	mu sync.RWMutex
+	m  map[string]string
+}
+
+func (m *mutexMap) Get(key string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.m[key]
+	return v, ok
+}
+
+func (m *mutexMap) Set(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m[key] = value
+}
+
+type store interface {
+	Get(string) (string, bool)
+	Set(string, string)
+}
+
+const benchKeys = 1 << 14
+
+func benchmarkMixed(b *testing.B, s store, writeEvery int) {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		s.Set(keys[i], "https://example.com/"+keys[i])
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%benchKeys]
+			if writeEvery > 0 && i%writeEvery == 0 {
+				s.Set(key, "https://example.org/"+key)
+			} else {
+				s.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	benchmarkMixed(b, New[string](DefaultShards), 0)
+}
+
+func BenchmarkGetParallelMutex(b *testing.B) {
+	benchmarkMixed(b, &mutexMap{m: make(map[string]string)}, 0)
+}
+
+// Редиректы с примесью создания ссылок (1 запись на 16 чтений).
+func BenchmarkMixedParallel(b *testing.B) {
+	benchmarkMixed(b, New[string](DefaultShards), 16)
+}
+
+func BenchmarkMixedParallelMutex(b *testing.B) {
+	benchmarkMixed(b, &mutexMap{m: make(map[string]string)}, 16)
+}
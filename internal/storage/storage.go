@@ -2,26 +2,136 @@ package storage
 
 import (
 	"context"
-	"local/config"
-	"local/internal/storage/file"
-	"local/internal/storage/memory"
-	"local/internal/storage/postgres"
+	"net/url"
+	"time"
 )
 
+// Record — ссылка вместе с метаданными.
+type Record struct {
+	ShortURL string `json:"short_url"`
+	OrigURL  string `json:"orig_url"`
+	// Owner — идентификатор создателя ссылки; пусто, если он неизвестен.
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	// ExpiresAt — момент, с которого ссылка не работает; нулевое значение — бессрочно.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Disabled — ссылка отключена администратором и не открывается.
+	Disabled bool `json:"disabled"`
+	// Preview — вместо редиректа всегда показывать страницу с адресом назначения.
+	Preview bool `json:"preview"`
+	// PasswordHash — bcrypt-хеш пароля ссылки; пусто, если пароль не нужен.
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// Protected сообщает, открывается ли ссылка только по паролю. Такие ссылки
+// не находит FindByLongURL: иначе сокращение того же URL без пароля выдало бы
+// защищённую ссылку, а с паролем — чужую.
+func (r Record) Protected() bool {
+	return r.PasswordHash != ""
+}
+
+// Expired сообщает, истёк ли срок действия ссылки к моменту now.
+func (r Record) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// Available сообщает, открывается ли ссылка к моменту now: ErrExpired для
+// истёкшей, ErrDisabled для отключённой, nil для действующей. Так же
+// поступает Get.
+func (r Record) Available(now time.Time) error {
+	if r.Expired(now) {
+		return ErrExpired
+	}
+	if r.Disabled {
+		return ErrDisabled
+	}
+	return nil
+}
+
+// Validate проверяет обязательные поля записи.
+func (r Record) Validate() error {
+	if r.ShortURL == "" || r.OrigURL == "" {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// ValidURL сообщает, годится ли s в адреса назначения, которые меняют через
+// API: принимаются только абсолютные http(s)-адреса. Validate этого не
+// требует, чтобы загружались и старые ссылки.
+func ValidURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// HistoryEntry — прежний адрес назначения ссылки.
+type HistoryEntry struct {
+	// OrigURL — адрес, на который ссылка вела до изменения.
+	OrigURL string `json:"orig_url"`
+	// Actor — кто изменил адрес: владелец ссылки или администратор.
+	Actor     string    `json:"actor,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Storage — хранилище соответствий короткий URL → исходный URL.
+// Ошибки реализаций сводятся к ErrNotFound, ErrConflict, ErrDuplicateURL,
+// ErrDeleted, ErrDisabled, ErrExpired и ErrInvalid; всё остальное считается
+// сбоем хранилища.
 type Storage interface {
+	// Get возвращает исходный URL; для истёкшей ссылки — ErrExpired, для
+	// отключённой — ErrDisabled.
 	Get(ctx context.Context, shortUrl string) (string, error)
+	// Save сохраняет ссылку. Повторное сохранение той же пары не ошибка,
+	// а занятый другим URL короткий адрес даёт ErrConflict. Истёкшая ссылка
+	// считается свободной: иначе детерминированный генератор не смог бы
+	// пересоздать ссылку на тот же URL. Отключённая ссылка остаётся занятой,
+	// и Save для неё возвращает ErrDisabled.
 	Save(ctx context.Context, shortUrl, longUrl string) error
+	// FindByLongURL ищет действующую ссылку на URL: истёкшие и отключённые
+	// не подходят.
 	FindByLongURL(context.Context, string) (string, error)
+	// FindOwned ищет действующую ссылку на URL среди ссылок владельца owner;
+	// пустой owner — ссылки без владельца. Ссылки с паролем не подходят, как
+	// и в FindByLongURL.
+	FindOwned(ctx context.Context, longURL, owner string) (string, error)
+
+	// GetRecord возвращает ссылку с метаданными, в том числе истёкшую.
+	GetRecord(ctx context.Context, shortURL string) (Record, error)
+	// SaveRecord сохраняет ссылку с метаданными по тем же правилам, что и Save.
+	// Нулевой CreatedAt заменяется текущим временем.
+	SaveRecord(ctx context.Context, rec Record) error
+	// PutRecord сохраняет ссылку как есть, заменяя существующую с тем же
+	// коротким URL. Нулевой CreatedAt означает, что время создания неизвестно.
+	PutRecord(ctx context.Context, rec Record) error
+	// Iterate вызывает fn для ссылок в порядке возрастания короткого URL,
+	// начиная со следующей после after (пустая строка — с начала). Ошибка fn
+	// прерывает обход и возвращается из Iterate.
+	Iterate(ctx context.Context, after string, fn func(Record) error) error
+	// List возвращает до limit ссылок, подходящих под filter, в порядке
+	// возрастания короткого URL, начиная со следующей после after.
+	List(ctx context.Context, filter Filter, after string, limit int) ([]Record, error)
+	// Update атомарно изменяет ссылку: fn получает текущую запись и правит её
+	// на месте; ошибка fn отменяет изменение и возвращается из Update.
+	// Короткий URL менять нельзя (ErrInvalid). Если изменился исходный URL,
+	// прежний вместе с actor попадает в историю ссылки. Возвращает сохранённую
+	// запись или ErrNotFound, если ссылки нет.
+	Update(ctx context.Context, shortURL, actor string, fn func(*Record) error) (Record, error)
+	// History возвращает прежние адреса ссылки от старых к новым; ErrNotFound,
+	// если ссылки нет.
+	History(ctx context.Context, shortURL string) ([]HistoryEntry, error)
+	// PutHistory заменяет историю ссылки записями history как есть; нужен
+	// выгрузке и переносу между хранилищами. ErrNotFound, если ссылки нет.
+	PutHistory(ctx context.Context, shortURL string, history []HistoryEntry) error
+	// Delete удаляет ссылку вместе с историей безвозвратно; ErrNotFound, если её нет.
+	Delete(ctx context.Context, shortURL string) error
+
+	// Ping проверяет, что хранилище доступно.
+	Ping(ctx context.Context) error
 	Close() error
 }
 
-func NewStorage(c config.Config) (Storage, error) {
-	if c.DataBaseDSN != "" {
-		return postgres.NewPostgresStorage(c.DataBaseDSN)
-	}
-	if c.FileStorage != "" {
-		return file.NewFileStorage(c.FileStorage)
-	}
-
-	return memory.NewMemoryStorage()
+// BatchPutter реализуют хранилища, которые записывают пачку ссылок дешевле,
+// чем по одной. PutRecords действует как PutRecord для каждой записи.
+type BatchPutter interface {
+	PutRecords(ctx context.Context, records []Record) error
 }
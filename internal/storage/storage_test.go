@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://example.com/path?q=1", valid: true},
+		{url: "http://example.com", valid: true},
+		{url: "ftp://example.com"},
+		{url: "javascript:alert(1)"},
+		{url: "/relative/path"},
+		{url: "https://"},
+		{url: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, tt.valid, ValidURL(tt.url))
+		})
+	}
+}
@@ -0,0 +1,748 @@
+// Package storagetest содержит общий набор тестов, который должна проходить
+// любая реализация storage.Storage.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"local/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Opener открывает хранилище. Повторный вызов того же Opener должен открывать
+// те же данные, если хранилище их сохраняет.
+type Opener func() (storage.Storage, error)
+
+// Options описывает особенности проверяемой реализации.
+type Options struct {
+	// Persistent — данные переживают Close и повторное открытие.
+	Persistent bool
+}
+
+// Run запускает набор тестов. newOpener вызывается для каждого подтеста и
+// должен возвращать Opener для нового пустого хранилища.
+func Run(t *testing.T, newOpener func(t *testing.T) Opener, opts Options) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, open Opener)
+	}{
+		{"RoundTrip", testRoundTrip},
+		{"FindByLongURL", testFindByLongURL},
+		{"FindOwned", testFindOwned},
+		{"NotFound", testNotFound},
+		{"Invalid", testInvalid},
+		{"Duplicates", testDuplicates},
+		{"Records", testRecords},
+		{"Expiry", testExpiry},
+		{"PutRecord", testPutRecord},
+		{"Iterate", testIterate},
+		{"PutRecords", testPutRecords},
+		{"Disabled", testDisabled},
+		{"Protected", testProtected},
+		{"Update", testUpdate},
+		{"History", testHistory},
+		{"PutHistory", testPutHistory},
+		{"Delete", testDelete},
+		{"List", testList},
+		{"ConcurrentSaves", testConcurrentSaves},
+		{"ContextCancellation", testContextCancellation},
+		{"Ping", testPing},
+		{"Close", testClose},
+	}
+	if opts.Persistent {
+		tests = append(tests, struct {
+			name string
+			fn   func(t *testing.T, open Opener)
+		}{"Reopen", testReopen})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newOpener(t))
+		})
+	}
+}
+
+// mustOpen открывает хранилище и закрывает его по окончании теста.
+func mustOpen(t *testing.T, open Opener) storage.Storage {
+	t.Helper()
+	s, err := open()
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testRoundTrip(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	links := map[string]string{
+		"abc":     "https://example.com",
+		"def":     "https://example.org/path?q=1",
+		"unicode": "https://пример.рф/страница",
+	}
+	for short, long := range links {
+		require.NoError(t, s.Save(ctx, short, long))
+	}
+	for short, long := range links {
+		got, err := s.Get(ctx, short)
+		require.NoError(t, err, short)
+		assert.Equal(t, long, got)
+	}
+}
+
+func testFindByLongURL(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com"))
+	require.NoError(t, s.Save(ctx, "def", "https://example.org"))
+
+	short, err := s.FindByLongURL(ctx, "https://example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "def", short)
+
+	// URL длиннее предела B-tree индекса postgres (~2,7 КБ)
+	long := "https://example.com/?q=" + strings.Repeat("x", 10000)
+	require.NoError(t, s.Save(ctx, "long", long))
+	short, err = s.FindByLongURL(ctx, long)
+	require.NoError(t, err)
+	assert.Equal(t, "long", short)
+}
+
+func testFindOwned(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	// Ссылка bob на тот же URL создана позже, но ссылку alice не заслоняет
+	require.NoError(t, s.SaveRecord(ctx, storage.Record{ShortURL: "a1", OrigURL: "https://example.com", Owner: "alice"}))
+	require.NoError(t, s.SaveRecord(ctx, storage.Record{ShortURL: "a2", OrigURL: "https://example.org", Owner: "alice"}))
+	require.NoError(t, s.SaveRecord(ctx, storage.Record{ShortURL: "b1", OrigURL: "https://example.com", Owner: "bob"}))
+
+	short, err := s.FindOwned(ctx, "https://example.com", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "a1", short)
+	short, err = s.FindOwned(ctx, "https://example.com", "bob")
+	require.NoError(t, err)
+	assert.Equal(t, "b1", short)
+	_, err = s.FindOwned(ctx, "https://example.org", "bob")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.FindOwned(ctx, "https://example.com", "")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "owned links are not found as unowned")
+
+	require.NoError(t, s.Save(ctx, "u1", "https://example.com"))
+	short, err = s.FindOwned(ctx, "https://example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", short)
+
+	// Отключённая ссылка не переиспользуется
+	_, err = s.Update(ctx, "a1", "alice", func(r *storage.Record) error {
+		r.Disabled = true
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = s.FindOwned(ctx, "https://example.com", "alice")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testNotFound(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	_, err := s.Get(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.FindByLongURL(ctx, "https://missing.example")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testInvalid(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	assert.ErrorIs(t, s.Save(ctx, "", "https://example.com"), storage.ErrInvalid)
+	assert.ErrorIs(t, s.Save(ctx, "abc", ""), storage.ErrInvalid)
+}
+
+func testDuplicates(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com"))
+	assert.NoError(t, s.Save(ctx, "abc", "https://example.com"), "saving the same pair again")
+	assert.ErrorIs(t, s.Save(ctx, "abc", "https://other.example"), storage.ErrConflict)
+
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", long, "conflicting save must not overwrite the link")
+}
+
+// assertRecord сравнивает записи; время сравнивается как момент, без учёта
+// часового пояса.
+func assertRecord(t *testing.T, want, got storage.Record) {
+	t.Helper()
+	assert.Equal(t, want.ShortURL, got.ShortURL)
+	assert.Equal(t, want.OrigURL, got.OrigURL)
+	assert.Equal(t, want.Owner, got.Owner)
+	assert.True(t, want.CreatedAt.Equal(got.CreatedAt), "created_at: want %v, got %v", want.CreatedAt, got.CreatedAt)
+	assert.True(t, want.ExpiresAt.Equal(got.ExpiresAt), "expires_at: want %v, got %v", want.ExpiresAt, got.ExpiresAt)
+	assert.Equal(t, want.Disabled, got.Disabled)
+	assert.Equal(t, want.Preview, got.Preview)
+	assert.Equal(t, want.PasswordHash, got.PasswordHash)
+}
+
+func testRecords(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	created := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	rec := storage.Record{
+		ShortURL:  "abc",
+		OrigURL:   "https://example.com",
+		Owner:     "user-1",
+		CreatedAt: created,
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+		Preview:   true,
+	}
+	require.NoError(t, s.SaveRecord(ctx, rec))
+	got, err := s.GetRecord(ctx, "abc")
+	require.NoError(t, err)
+	assertRecord(t, rec, got)
+
+	// Save заполняет время создания
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, s.Save(ctx, "def", "https://example.org"))
+	got, err = s.GetRecord(ctx, "def")
+	require.NoError(t, err)
+	assert.True(t, got.CreatedAt.After(before), "created_at %v", got.CreatedAt)
+	assert.True(t, got.ExpiresAt.IsZero())
+
+	_, err = s.GetRecord(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, s.SaveRecord(ctx, storage.Record{ShortURL: "x"}), storage.ErrInvalid)
+}
+
+func testExpiry(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	expired := storage.Record{
+		ShortURL:  "abc",
+		OrigURL:   "https://example.com",
+		CreatedAt: time.Now().Add(-2 * time.Hour).Truncate(time.Second),
+		ExpiresAt: time.Now().Add(-time.Hour).Truncate(time.Second),
+	}
+	require.NoError(t, s.PutRecord(ctx, expired))
+
+	_, err := s.Get(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrExpired)
+	_, err = s.FindByLongURL(ctx, "https://example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	got, err := s.GetRecord(ctx, "abc")
+	require.NoError(t, err, "expired records stay visible to GetRecord")
+	assertRecord(t, expired, got)
+
+	// Истёкший короткий адрес можно занять заново
+	require.NoError(t, s.Save(ctx, "abc", "https://other.example"))
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.example", long)
+	got, err = s.GetRecord(ctx, "abc")
+	require.NoError(t, err)
+	assert.True(t, got.ExpiresAt.IsZero(), "the new link does not inherit the expiry")
+}
+
+func testPutRecord(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com"))
+	// Прогреваем возможный кэш поиска по URL
+	_, err := s.FindByLongURL(ctx, "https://example.com")
+	require.NoError(t, err)
+
+	rec := storage.Record{
+		ShortURL:  "abc",
+		OrigURL:   "https://other.example",
+		Owner:     "admin",
+		CreatedAt: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	require.NoError(t, s.PutRecord(ctx, rec))
+
+	got, err := s.GetRecord(ctx, "abc")
+	require.NoError(t, err)
+	assertRecord(t, rec, got)
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.example", long)
+	_, err = s.FindByLongURL(ctx, "https://example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "the old URL no longer points to abc")
+
+	assert.ErrorIs(t, s.PutRecord(ctx, storage.Record{OrigURL: "https://example.com"}), storage.ErrInvalid)
+}
+
+// collect возвращает короткие URL, которые выдаёт Iterate.
+func collect(t *testing.T, s storage.Storage, after string) []string {
+	t.Helper()
+	var shorts []string
+	err := s.Iterate(context.Background(), after, func(rec storage.Record) error {
+		shorts = append(shorts, rec.ShortURL)
+		return nil
+	})
+	require.NoError(t, err)
+	return shorts
+}
+
+func testIterate(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	assert.Empty(t, collect(t, s, ""))
+
+	for _, short := range []string{"c", "a", "e", "b", "d"} {
+		require.NoError(t, s.Save(ctx, short, "https://example.com/"+short))
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, collect(t, s, ""))
+	assert.Equal(t, []string{"d", "e"}, collect(t, s, "c"))
+	assert.Equal(t, []string{"c", "d", "e"}, collect(t, s, "bb"))
+	assert.Empty(t, collect(t, s, "e"))
+
+	// Порядок побайтный, независимо от локали: заглавные раньше строчных
+	for _, short := range []string{"B", "_x", "A", "Z9", "-y"} {
+		require.NoError(t, s.Save(ctx, short, "https://example.com/"+short))
+	}
+	assert.Equal(t, []string{"-y", "A", "B", "Z9", "_x", "a", "b", "c", "d", "e"}, collect(t, s, ""))
+	assert.Equal(t, []string{"Z9", "_x", "a", "b", "c", "d", "e"}, collect(t, s, "B"))
+	assert.Equal(t, []string{"b", "c", "d", "e"}, collect(t, s, "a"))
+
+	stop := errors.New("stop")
+	var seen int
+	err := s.Iterate(ctx, "", func(storage.Record) error {
+		seen++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, seen)
+}
+
+func testPutRecords(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+	bp, ok := s.(storage.BatchPutter)
+	if !ok {
+		t.Skip("storage does not implement BatchPutter")
+	}
+
+	require.NoError(t, s.Save(ctx, "b", "https://example.com/old"))
+	records := []storage.Record{
+		{ShortURL: "a", OrigURL: "https://example.com/a", Owner: "user-1"},
+		{ShortURL: "b", OrigURL: "https://example.com/b"},
+	}
+	require.NoError(t, bp.PutRecords(ctx, records))
+	assert.Equal(t, []string{"a", "b"}, collect(t, s, ""))
+	long, err := s.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/b", long)
+
+	assert.ErrorIs(t, bp.PutRecords(ctx, []storage.Record{{ShortURL: "c"}}), storage.ErrInvalid)
+}
+
+func testDisabled(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com"))
+	_, err := s.FindByLongURL(ctx, "https://example.com")
+	require.NoError(t, err)
+
+	rec, err := s.Update(ctx, "abc", "admin", func(r *storage.Record) error {
+		r.Disabled = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, rec.Disabled)
+
+	_, err = s.Get(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrDisabled)
+	_, err = s.FindByLongURL(ctx, "https://example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "disabled links are not reused")
+	assert.ErrorIs(t, s.Save(ctx, "abc", "https://example.com"), storage.ErrDisabled)
+	assert.ErrorIs(t, s.Save(ctx, "abc", "https://other.example"), storage.ErrDisabled)
+
+	_, err = s.Update(ctx, "abc", "admin", func(r *storage.Record) error {
+		r.Disabled = false
+		return nil
+	})
+	require.NoError(t, err)
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", long)
+}
+
+func testProtected(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.SaveRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: "https://example.com", PasswordHash: "hash-1"}))
+	got, err := s.GetRecord(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "hash-1", got.PasswordHash)
+	_, err = s.FindByLongURL(ctx, "https://example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "protected links are not reused")
+
+	// Ссылка без пароля на тот же URL находится, защищённая её не заслоняет
+	require.NoError(t, s.Save(ctx, "def", "https://example.com"))
+	require.NoError(t, s.SaveRecord(ctx, storage.Record{ShortURL: "ghi", OrigURL: "https://example.com", PasswordHash: "hash-2"}))
+	short, err := s.FindByLongURL(ctx, "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "def", short)
+
+	// Повтор с тем же паролем ничего не меняет, с другим паролем или без
+	// пароля — конфликт
+	require.NoError(t, s.SaveRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: "https://example.com", PasswordHash: "hash-1"}))
+	assert.ErrorIs(t, s.SaveRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: "https://example.com", PasswordHash: "hash-3"}), storage.ErrConflict)
+	assert.ErrorIs(t, s.Save(ctx, "abc", "https://example.com"), storage.ErrConflict)
+	assert.ErrorIs(t, s.SaveRecord(ctx, storage.Record{ShortURL: "def", OrigURL: "https://example.com", PasswordHash: "hash-3"}), storage.ErrConflict)
+	got, err = s.GetRecord(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "hash-1", got.PasswordHash)
+}
+
+func testUpdate(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.SaveRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: "https://example.com", Owner: "user-1"}))
+	_, err := s.FindByLongURL(ctx, "https://example.com")
+	require.NoError(t, err)
+
+	rec, err := s.Update(ctx, "abc", "admin", func(r *storage.Record) error {
+		assert.Equal(t, "user-1", r.Owner)
+		r.OrigURL = "https://other.example"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.example", rec.OrigURL)
+	assert.Equal(t, "user-1", rec.Owner)
+
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.example", long)
+	short, err := s.FindByLongURL(ctx, "https://other.example")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", short)
+	_, err = s.FindByLongURL(ctx, "https://example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Ошибка fn и недопустимые изменения ничего не меняют
+	stop := errors.New("stop")
+	_, err = s.Update(ctx, "abc", "admin", func(r *storage.Record) error {
+		r.OrigURL = "https://ignored.example"
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	_, err = s.Update(ctx, "abc", "admin", func(r *storage.Record) error {
+		r.ShortURL = "def"
+		return nil
+	})
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	_, err = s.Update(ctx, "abc", "admin", func(r *storage.Record) error {
+		r.OrigURL = ""
+		return nil
+	})
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+	long, err = s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.example", long)
+
+	_, err = s.Update(ctx, "missing", "admin", func(*storage.Record) error { return nil })
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testHistory(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com/1"))
+	history, err := s.History(ctx, "abc")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	before := time.Now().Add(-time.Second)
+	for i, actor := range []string{"user-1", "admin"} {
+		_, err := s.Update(ctx, "abc", actor, func(r *storage.Record) error {
+			r.OrigURL = fmt.Sprintf("https://example.com/%d", i+2)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	// Изменения без смены адреса в историю не попадают
+	_, err = s.Update(ctx, "abc", "admin", func(r *storage.Record) error {
+		r.Disabled = true
+		return nil
+	})
+	require.NoError(t, err)
+
+	history, err = s.History(ctx, "abc")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "https://example.com/1", history[0].OrigURL)
+	assert.Equal(t, "user-1", history[0].Actor)
+	assert.Equal(t, "https://example.com/2", history[1].OrigURL)
+	assert.Equal(t, "admin", history[1].Actor)
+	for _, h := range history {
+		assert.True(t, h.ChangedAt.After(before), "changed at %v", h.ChangedAt)
+	}
+
+	_, err = s.History(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Удаление освобождает короткий адрес вместе с историей
+	require.NoError(t, s.Delete(ctx, "abc"))
+	_, err = s.History(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com/new"))
+	history, err = s.History(ctx, "abc")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testPutHistory(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com/3"))
+	_, err := s.Update(ctx, "abc", "user-1", func(r *storage.Record) error {
+		r.OrigURL = "https://example.com/4"
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Загруженная история заменяет прежнюю целиком
+	want := []storage.HistoryEntry{
+		{OrigURL: "https://example.com/1", Actor: "user-1", ChangedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{OrigURL: "https://example.com/2", Actor: "admin", ChangedAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	require.NoError(t, s.PutHistory(ctx, "abc", want))
+	history, err := s.History(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, want, history)
+
+	require.NoError(t, s.PutHistory(ctx, "abc", nil))
+	history, err = s.History(ctx, "abc")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	assert.ErrorIs(t, s.PutHistory(ctx, "missing", want), storage.ErrNotFound)
+}
+
+func testDelete(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com"))
+	_, err := s.FindByLongURL(ctx, "https://example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Delete(ctx, "abc"))
+	_, err = s.Get(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetRecord(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.FindByLongURL(ctx, "https://example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, s.Delete(ctx, "abc"), storage.ErrNotFound)
+
+	// Удалённый короткий адрес свободен
+	require.NoError(t, s.Save(ctx, "abc", "https://other.example"))
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.example", long)
+}
+
+func testList(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	records := []storage.Record{
+		{ShortURL: "a", OrigURL: "https://example.com/1", Owner: "alice", CreatedAt: day(1)},
+		{ShortURL: "b", OrigURL: "https://blog.example.com/2", Owner: "bob", CreatedAt: day(2)},
+		{ShortURL: "c", OrigURL: "https://example.org/3", Owner: "alice", CreatedAt: day(3), Disabled: true},
+		{ShortURL: "d", OrigURL: "https://notexample.com/4", Owner: "alice", CreatedAt: day(4)},
+	}
+	for _, rec := range records {
+		require.NoError(t, s.PutRecord(ctx, rec))
+	}
+
+	shorts := func(filter storage.Filter, after string, limit int) []string {
+		t.Helper()
+		list, err := s.List(ctx, filter, after, limit)
+		require.NoError(t, err)
+		var shorts []string
+		for _, rec := range list {
+			shorts = append(shorts, rec.ShortURL)
+		}
+		return shorts
+	}
+	disabled := true
+
+	assert.Equal(t, []string{"a", "b", "c", "d"}, shorts(storage.Filter{}, "", 10))
+	assert.Equal(t, []string{"a", "b"}, shorts(storage.Filter{}, "", 2))
+	assert.Equal(t, []string{"c", "d"}, shorts(storage.Filter{}, "b", 2))
+	assert.Equal(t, []string{"a", "c", "d"}, shorts(storage.Filter{Owner: "alice"}, "", 10))
+	assert.Equal(t, []string{"c", "d"}, shorts(storage.Filter{Owner: "alice"}, "a", 10))
+	assert.Equal(t, []string{"b", "c"}, shorts(storage.Filter{CreatedFrom: day(2), CreatedTo: day(4)}, "", 10))
+	assert.Equal(t, []string{"a", "b"}, shorts(storage.Filter{Domain: "EXAMPLE.com"}, "", 10))
+	assert.Equal(t, []string{"b"}, shorts(storage.Filter{Search: "blog"}, "", 10))
+	assert.Equal(t, []string{"c"}, shorts(storage.Filter{Disabled: &disabled}, "", 10))
+	assert.Empty(t, shorts(storage.Filter{Owner: "carol"}, "", 10))
+
+	got, err := s.List(ctx, storage.Filter{Owner: "bob"}, "", 1)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assertRecord(t, records[1], got[0])
+
+	_, err = s.List(ctx, storage.Filter{}, "", 0)
+	assert.ErrorIs(t, err, storage.ErrInvalid)
+
+	// Страницы идут в побайтном порядке, как у Iterate
+	require.NoError(t, s.PutRecord(ctx, storage.Record{ShortURL: "B", OrigURL: "https://example.com/5", Owner: "alice"}))
+	assert.Equal(t, []string{"B", "a"}, shorts(storage.Filter{Owner: "alice"}, "", 2))
+	assert.Equal(t, []string{"a", "c"}, shorts(storage.Filter{Owner: "alice"}, "B", 2))
+}
+
+func testConcurrentSaves(t *testing.T, open Opener) {
+	ctx := context.Background()
+	s := mustOpen(t, open)
+
+	const workers, perWorker = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker*2)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				short := fmt.Sprintf("w%d-%d", w, i)
+				errs <- s.Save(ctx, short, "https://example.com/"+short)
+				// Все воркеры сохраняют и одну общую ссылку
+				errs <- s.Save(ctx, "shared", "https://example.com/shared")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	for w := range workers {
+		for i := range perWorker {
+			short := fmt.Sprintf("w%d-%d", w, i)
+			long, err := s.Get(ctx, short)
+			require.NoError(t, err, short)
+			assert.Equal(t, "https://example.com/"+short, long)
+		}
+	}
+	short, err := s.FindByLongURL(ctx, "https://example.com/shared")
+	require.NoError(t, err)
+	assert.Equal(t, "shared", short)
+}
+
+func testContextCancellation(t *testing.T, open Opener) {
+	s := mustOpen(t, open)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, s.Save(ctx, "abc", "https://example.com"), context.Canceled)
+	_, err := s.Get(ctx, "abc")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = s.FindByLongURL(ctx, "https://example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Отменённое сохранение не должно оставлять следов
+	_, err = s.Get(context.Background(), "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testPing(t *testing.T, open Opener) {
+	s := mustOpen(t, open)
+	assert.NoError(t, s.Ping(context.Background()))
+}
+
+func testClose(t *testing.T, open Opener) {
+	s, err := open()
+	require.NoError(t, err)
+	require.NoError(t, s.Save(context.Background(), "abc", "https://example.com"))
+
+	require.NoError(t, s.Close())
+	assert.NotPanics(t, func() { _ = s.Close() }, "closing twice")
+}
+
+func testReopen(t *testing.T, open Opener) {
+	ctx := context.Background()
+
+	s, err := open()
+	require.NoError(t, err)
+	require.NoError(t, s.Save(ctx, "abc", "https://example.com"))
+	require.NoError(t, s.Save(ctx, "def", "https://example.org"))
+	rec := storage.Record{
+		ShortURL:     "ghi",
+		OrigURL:      "https://example.net",
+		Owner:        "user-1",
+		CreatedAt:    time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		ExpiresAt:    time.Now().Add(time.Hour).Truncate(time.Second),
+		PasswordHash: "$2a$10$hash",
+	}
+	require.NoError(t, s.SaveRecord(ctx, rec))
+	require.NoError(t, s.PutRecord(ctx, storage.Record{ShortURL: "abc", OrigURL: "https://example.com/moved"}))
+	require.NoError(t, s.Save(ctx, "gone", "https://example.com/gone"))
+	require.NoError(t, s.Delete(ctx, "gone"))
+	rec, err = s.Update(ctx, "ghi", "admin", func(r *storage.Record) error {
+		r.Disabled = true
+		r.Preview = true
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = s.Update(ctx, "def", "user-1", func(r *storage.Record) error {
+		r.OrigURL = "https://example.org/moved"
+		return nil
+	})
+	require.NoError(t, err)
+	imported := []storage.HistoryEntry{{OrigURL: "https://example.net/old", Actor: "admin", ChangedAt: time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)}}
+	require.NoError(t, s.PutHistory(ctx, "ghi", imported))
+	require.NoError(t, s.Close())
+
+	s = mustOpen(t, open)
+	long, err := s.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/moved", long, "the latest PutRecord wins")
+	got, err := s.GetRecord(ctx, "ghi")
+	require.NoError(t, err)
+	assertRecord(t, rec, got)
+	_, err = s.Get(ctx, "gone")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	short, err := s.FindByLongURL(ctx, "https://example.org/moved")
+	require.NoError(t, err)
+	assert.Equal(t, "def", short)
+	history, err := s.History(ctx, "def")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "https://example.org", history[0].OrigURL)
+	assert.Equal(t, "user-1", history[0].Actor)
+	history, err = s.History(ctx, "ghi")
+	require.NoError(t, err)
+	assert.Equal(t, imported, history)
+
+	// После повторного открытия дубликаты по-прежнему распознаются
+	assert.ErrorIs(t, s.Save(ctx, "abc", "https://other.example"), storage.ErrConflict)
+}
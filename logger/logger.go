@@ -1,56 +1,183 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"os"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var Log *zap.SugaredLogger
+// Log — глобальный логгер приложения. До вызова InitLogger он ничего не пишет,
+// поэтому пакеты можно использовать (и тестировать) без явной инициализации.
+var Log = zap.NewNop().Sugar()
+
+// AuditLog пишет туда же, куда Log, но при любом уровне логирования. Он нужен
+// для записей об изменении самих настроек логирования: иначе переход на
+// уровень error скрыл бы запись о нём.
+var AuditLog = zap.NewNop().Sugar()
+
+// Options описывает, куда и в каком виде писать логи.
+type Options struct {
+	// Level — уровень логирования: debug, info, warn, error, dpanic, panic, fatal.
+	Level string
+	// Format — формат записей: console или json.
+	Format string
+	// Outputs — список получателей: stdout, stderr или путь к файлу.
+	Outputs []string
+	// MaxSizeMB — размер файла лога, после которого он ротируется.
+	MaxSizeMB int
+	// MaxAgeDays — сколько дней хранить ротированные файлы (0 — не удалять по возрасту).
+	MaxAgeDays int
+	// MaxBackups — сколько ротированных файлов хранить (0 — все).
+	MaxBackups int
+}
+
+// level — общий уровень всех ядер Log; его можно менять без пересоздания логгера.
+var level = zap.NewAtomicLevel()
+
+// closers — открытые файлы логов, которые закрывает CloseLogger.
+var closers []io.Closer
 
-func InitLogger(logLevel string) {
+// InitLogger настраивает глобальный логгер Log согласно opts.
+func InitLogger(opts Options) error {
 	// Устанавливаем уровень логирования
-	var level zapcore.Level
-	switch logLevel {
-	case "debug":
-		level = zapcore.DebugLevel
-	case "info":
-		level = zapcore.InfoLevel
-	default:
-		level = zapcore.InfoLevel
+	lvl, err := zapcore.ParseLevel(opts.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", opts.Level, err)
 	}
 
+	outputs := opts.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{"stdout"}
+	}
+
+	cores := make([]zapcore.Core, 0, len(outputs))
+	auditCores := make([]zapcore.Core, 0, len(outputs))
+	var files []io.Closer
+	for _, output := range outputs {
+		var (
+			writer   zapcore.WriteSyncer
+			terminal bool
+		)
+		switch output {
+		case "stdout":
+			writer, terminal = zapcore.Lock(os.Stdout), isTerminal(os.Stdout)
+		case "stderr":
+			writer, terminal = zapcore.Lock(os.Stderr), isTerminal(os.Stderr)
+		case "":
+			continue
+		default:
+			// Для файла — ротация по размеру и возрасту
+			file := &lumberjack.Logger{
+				Filename:   output,
+				MaxSize:    opts.MaxSizeMB,
+				MaxAge:     opts.MaxAgeDays,
+				MaxBackups: opts.MaxBackups,
+			}
+			files = append(files, file)
+			writer = zapcore.AddSync(file)
+		}
+
+		encoder, err := newEncoder(opts.Format, terminal)
+		if err != nil {
+			return err
+		}
+		cores = append(cores, zapcore.NewCore(encoder, writer, level))
+		auditCores = append(auditCores, zapcore.NewCore(encoder, writer, zapcore.DebugLevel))
+	}
+
+	// Закрываем файлы предыдущей конфигурации
+	CloseLogger()
+	closers = files
+	level.SetLevel(lvl)
+
+	// Создаем логгер
+	Log = zap.New(zapcore.NewTee(cores...)).Sugar()
+	AuditLog = zap.New(zapcore.NewTee(auditCores...)).Sugar()
+	return nil
+}
+
+// isTerminal сообщает, подключён ли f к терминалу. Вывод, перенаправленный в
+// файл или pipe (journald, docker logs), не должен получать цветовые
+// escape-последовательности.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// newEncoder создаёт энкодер нужного формата. Цветные уровни используются
+// только в консольном формате для вывода в терминал.
+func newEncoder(format string, terminal bool) (zapcore.Encoder, error) {
 	// Форматирование логов
 	encoderConfig := zap.NewDevelopmentEncoderConfig()
 	encoderConfig.TimeKey = "timestamp"
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
 
-	// Для консоли
-	consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
-	consoleWriter := zapcore.AddSync(zapcore.Lock(os.Stdout))
-
-	// Для файла
-	fileEncoder := zapcore.NewJSONEncoder(encoderConfig)
-	logFile, err := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		panic("Не удалось создать файл для логов: " + err.Error())
+	switch format {
+	case "", "console":
+		if terminal {
+			encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	case "json":
+		encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
 	}
-	fileWriter := zapcore.AddSync(zapcore.Lock(logFile))
+}
 
-	// Создаем Core с консолью и файлом
-	core := zapcore.NewTee(
-		zapcore.NewCore(consoleEncoder, consoleWriter, level),
-		zapcore.NewCore(fileEncoder, fileWriter, level),
-	)
+// Level возвращает текущий уровень логирования.
+func Level() zapcore.Level {
+	return level.Level()
+}
 
-	// Создаем логгер
-	logger := zap.New(core)
-	Log = logger.Sugar()
+// SetLevel меняет уровень логирования на лету и возвращает предыдущий.
+func SetLevel(text string) (zapcore.Level, error) {
+	lvl, err := zapcore.ParseLevel(text)
+	if err != nil {
+		return level.Level(), fmt.Errorf("invalid log level %q: %w", text, err)
+	}
+	prev := level.Level()
+	level.SetLevel(lvl)
+	return prev, nil
 }
 
 func CloseLogger() {
 	if Log != nil {
-		_ = Log.Sync() // Закрываем логгер, записываем всё в файл
+		_ = Log.Sync() // Записываем всё, что осталось в буферах
+	}
+	if AuditLog != nil {
+		_ = AuditLog.Sync()
+	}
+	for _, c := range closers {
+		_ = c.Close()
+	}
+	closers = nil
+}
+
+type ctxKey struct{}
+
+// WithContext возвращает копию ctx, содержащую логгер l.
+func WithContext(ctx context.Context, l *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext возвращает логгер запроса (с request ID и т.п.), сохранённый
+// в ctx через WithContext, или глобальный Log, если его там нет.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKey{}).(*zap.SugaredLogger); ok {
+			return l
+		}
 	}
+	return Log
 }
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	require.NoError(t, InitLogger(Options{
+		Level:   "warn",
+		Format:  "json",
+		Outputs: []string{path},
+	}))
+	Log.Info("skipped")
+	Log.Warnw("written", "key", "value")
+	CloseLogger()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	// В файле не должно быть ANSI-кодов цветных уровней
+	assert.Equal(t, "warn", entry["L"])
+	assert.Equal(t, "written", entry["M"])
+	assert.Equal(t, "value", entry["key"])
+}
+
+func TestInitLoggerInvalidOptions(t *testing.T) {
+	assert.Error(t, InitLogger(Options{Level: "verbose"}))
+	assert.Error(t, InitLogger(Options{Level: "info", Format: "xml"}))
+}
+
+func TestInitLoggerStdoutNotTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	prev := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = prev }()
+
+	assert.False(t, isTerminal(w))
+	require.NoError(t, InitLogger(Options{Level: "info", Format: "console", Outputs: []string{"stdout"}}))
+	Log.Info("piped")
+	require.NoError(t, w.Close())
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	// Перенаправленный stdout получает уровни без ANSI-кодов
+	assert.Contains(t, string(data), "INFO")
+	assert.NotContains(t, string(data), "\x1b[")
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import "net/http"
+
+// Default — реестр метрик сервиса, который отдаётся на /metrics.
+var Default = NewRegistry()
+
+// Метрики сервиса.
+var (
+	HTTPRequests = NewCounterVec(Default, "shortener_http_requests_total",
+		"Total number of HTTP requests by route, method and status.",
+		"route", "method", "status")
+	HTTPRequestDuration = NewHistogramVec(Default, "shortener_http_request_duration_seconds",
+		"HTTP request latency by route, method and status.",
+		DefaultBuckets, "route", "method", "status")
+
+	StorageOperationDuration = NewHistogramVec(Default, "shortener_storage_operation_duration_seconds",
+		"Latency of storage operations by backend and method.",
+		DefaultBuckets, "backend", "method")
+	StorageErrors = NewCounterVec(Default, "shortener_storage_errors_total",
+		"Storage operations that failed, by backend and method. Expected results such as a missing link are not counted.",
+		"backend", "method")
+
+	CacheRequests = NewCounterVec(Default, "shortener_cache_requests_total",
+		"Storage cache lookups by result (hit or miss).",
+		"result")
+
+	Redirects = NewCounterVec(Default, "shortener_redirects_total",
+		"Redirects served to short link visitors.")
+	Previews = NewCounterVec(Default, "shortener_previews_total",
+		"Preview pages shown instead of a redirect.")
+	UnlockAttempts = NewCounterVec(Default, "shortener_unlock_attempts_total",
+		"Password attempts on protected links by result (ok, wrong or limited).",
+		"result")
+	LinksCreated = NewCounterVec(Default, "shortener_links_created_total",
+		"Short links created.")
+)
+
+// Handler отдаёт метрики реестра Default.
+func Handler() http.Handler {
+	return Default.Handler()
+}
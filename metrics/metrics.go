@@ -0,0 +1,332 @@
+// Package metrics реализует минимальный набор метрик Prometheus (счётчики и
+// гистограммы с метками) и их выдачу в текстовом формате exposition 0.0.4.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets — границы гистограмм длительности в секундах.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector — семейство метрик, которое умеет записать себя в exposition-формате.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry хранит зарегистрированные семейства метрик.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("metrics: duplicate metric " + c.name())
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo записывает все метрики реестра в текстовом формате Prometheus.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.RUnlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler отдаёт метрики реестра для Prometheus.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// vec хранит серии одного семейства, различающиеся значениями меток.
+type vec[T any] struct {
+	metricName string
+	help       string
+	labels     []string
+	newSeries  func() *T
+
+	mu     sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newVec[T any](name, help string, labels []string, newSeries func() *T) vec[T] {
+	return vec[T]{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		newSeries:  newSeries,
+		series:     make(map[string]*T),
+		values:     make(map[string][]string),
+	}
+}
+
+func (v *vec[T]) name() string { return v.metricName }
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.metricName, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	s = v.newSeries()
+	v.series[key] = s
+	v.values[key] = append([]string(nil), values...)
+	return s
+}
+
+// each обходит серии в стабильном порядке.
+func (v *vec[T]) each(fn func(values []string, s *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return slices.Compare(v.values[keys[i]], v.values[keys[j]]) < 0
+	})
+	v.mu.RUnlock()
+
+	for _, k := range keys {
+		v.mu.RLock()
+		s, values := v.series[k], v.values[k]
+		v.mu.RUnlock()
+		fn(values, s)
+	}
+}
+
+func (v *vec[T]) writeHeader(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, typ)
+}
+
+// Counter — монотонно растущий счётчик.
+type Counter struct {
+	value atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// CounterVec — семейство счётчиков с метками.
+type CounterVec struct {
+	vec[Counter]
+}
+
+// NewCounterVec создаёт семейство счётчиков и регистрирует его в r.
+func NewCounterVec(r *Registry, name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, labels, func() *Counter { return &Counter{} })}
+	if len(labels) == 0 {
+		// Серия без меток отдаётся сразу, даже пока счётчик равен нулю
+		c.With()
+	}
+	r.register(c)
+	return c
+}
+
+// With возвращает счётчик для значений меток в порядке их объявления.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w, "counter")
+	c.each(func(values []string, s *Counter) {
+		writeSample(w, c.metricName, c.labels, values, "", "", float64(s.Value()))
+	})
+}
+
+// Histogram считает распределение наблюдений по корзинам.
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sumBits atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets))}
+}
+
+// Observe добавляет наблюдение v.
+func (h *Histogram) Observe(v float64) {
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		sum := math.Float64frombits(old) + v
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(sum)) {
+			return
+		}
+	}
+}
+
+// ObserveSince добавляет время, прошедшее с start, в секундах.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count возвращает количество наблюдений.
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// HistogramVec — семейство гистограмм с метками.
+type HistogramVec struct {
+	vec[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec создаёт семейство гистограмм с корзинами buckets
+// (по возрастанию) и регистрирует его в r.
+func NewHistogramVec(r *Registry, name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " must be sorted")
+	}
+	h := &HistogramVec{
+		vec:     newVec(name, help, labels, func() *Histogram { return newHistogram(buckets) }),
+		buckets: buckets,
+	}
+	if len(labels) == 0 {
+		h.With()
+	}
+	r.register(h)
+	return h
+}
+
+// With возвращает гистограмму для значений меток в порядке их объявления.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w, "histogram")
+	h.each(func(values []string, s *Histogram) {
+		var cumulative uint64
+		for i, le := range s.buckets {
+			cumulative += s.counts[i].Load()
+			writeSample(w, h.metricName+"_bucket", h.labels, values, "le", formatFloat(le), float64(cumulative))
+		}
+		count := s.count.Load()
+		writeSample(w, h.metricName+"_bucket", h.labels, values, "le", "+Inf", float64(count))
+		writeSample(w, h.metricName+"_sum", h.labels, values, "", "", math.Float64frombits(s.sumBits.Load()))
+		writeSample(w, h.metricName+"_count", h.labels, values, "", "", float64(count))
+	})
+}
+
+// writeSample пишет строку вида name{label="value",...} 42.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryExposition(t *testing.T) {
+	r := NewRegistry()
+	requests := NewCounterVec(r, "test_requests_total", "Requests.\nSecond line.", "route", "status")
+	duration := NewHistogramVec(r, "test_duration_seconds", "Duration.", []float64{0.1, 1}, "route")
+	created := NewCounterVec(r, "test_created_total", "Created.")
+
+	requests.With("/", "200").Inc()
+	requests.With("/", "200").Inc()
+	requests.With(`/a"b`, "404").Add(3)
+	duration.With("/").Observe(0.05)
+	duration.With("/").Observe(0.5)
+	duration.With("/").Observe(2)
+
+	expected := `# HELP test_created_total Created.
+# TYPE test_created_total counter
+test_created_total 0
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/",le="0.1"} 1
+test_duration_seconds_bucket{route="/",le="1"} 2
+test_duration_seconds_bucket{route="/",le="+Inf"} 3
+test_duration_seconds_sum{route="/"} 2.55
+test_duration_seconds_count{route="/"} 3
+# HELP test_requests_total Requests.\nSecond line.
+# TYPE test_requests_total counter
+test_requests_total{route="/",status="200"} 2
+test_requests_total{route="/a\"b",status="404"} 3
+`
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	assert.Equal(t, expected, w.Body.String())
+	assert.Equal(t, uint64(0), created.With().Value())
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	r := NewRegistry()
+	NewCounterVec(r, "dup_total", "Dup.")
+	assert.Panics(t, func() { NewCounterVec(r, "dup_total", "Dup.") })
+	assert.Panics(t, func() { NewCounterVec(r, "labels_total", "Labels.", "a").With("x", "y") })
+}
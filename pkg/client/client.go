@@ -0,0 +1,275 @@
+// Package client — Go-клиент API сервиса сокращения ссылок.
+//
+//	c := client.New("https://sho.rt", client.Options{Token: token})
+//	short, err := c.Shorten(ctx, "https://example.com/very/long/path")
+//	if errors.Is(err, client.ErrRateLimited) { ... }
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Options — настройки клиента. Нулевые значения заменяются значениями по умолчанию.
+type Options struct {
+	// Token — bearer-токен для admin API (Stats, Delete).
+	Token string
+	// Timeout ограничивает одну попытку запроса. По умолчанию 10 секунд.
+	Timeout time.Duration
+	// Retries — сколько раз повторять запрос при сетевых ошибках и ответах
+	// 429, 502, 503, 504. Отрицательное значение отключает повторы, 0 — по умолчанию 3.
+	Retries int
+	// RetryWait и RetryMaxWait задают экспоненциальную задержку между повторами.
+	// По умолчанию 100 мс и 2 с. Заголовок Retry-After имеет приоритет, но
+	// задержка не превышает RetryMaxWait.
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+	// CompressRequests сжимает тела запросов zstd. Ответы в zstd и gzip
+	// распаковываются всегда.
+	CompressRequests bool
+	// Transport — базовый транспорт; по умолчанию http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultRetries      = 3
+	defaultRetryWait    = 100 * time.Millisecond
+	defaultRetryMaxWait = 2 * time.Second
+)
+
+// Client — клиент API. Безопасен для одновременного использования.
+type Client struct {
+	http    *resty.Client
+	baseURL string
+}
+
+// Shortened — результат сокращения одного URL.
+type Shortened struct {
+	// Code — короткий код ссылки.
+	Code string `json:"code"`
+	// ShortURL — полный короткий URL.
+	ShortURL string `json:"short_url"`
+	OrigURL  string `json:"orig_url"`
+}
+
+// Link — сведения о ссылке из admin API.
+type Link struct {
+	ShortURL  string    `json:"short_url"`
+	OrigURL   string    `json:"orig_url"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Disabled  bool      `json:"disabled"`
+	Preview   bool      `json:"preview"`
+	// Protected — ссылка открывается только по паролю.
+	Protected bool `json:"protected"`
+}
+
+// urlRequest — формат элементов пакетного запроса POST /api/shorten.
+type urlRequest struct {
+	ShortURL string `json:"short_url"`
+	OrigURL  string `json:"orig_url"`
+}
+
+// New создаёт клиента для сервера baseURL, например "http://localhost:8080".
+func New(baseURL string, opts Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	switch {
+	case opts.Retries == 0:
+		opts.Retries = defaultRetries
+	case opts.Retries < 0:
+		opts.Retries = 0
+	}
+	if opts.RetryWait == 0 {
+		opts.RetryWait = defaultRetryWait
+	}
+	if opts.RetryMaxWait == 0 {
+		opts.RetryMaxWait = defaultRetryMaxWait
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	h := resty.New().
+		SetBaseURL(baseURL).
+		SetLogger(nopLogger{}).
+		SetTimeout(opts.Timeout).
+		SetTransport(&encodingTransport{base: opts.Transport, compress: opts.CompressRequests}).
+		// Редиректы не выполняются, чтобы Expand мог прочитать Location
+		SetRedirectPolicy(resty.RedirectPolicyFunc(func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		})).
+		SetRetryCount(opts.Retries).
+		SetRetryWaitTime(opts.RetryWait).
+		SetRetryMaxWaitTime(opts.RetryMaxWait).
+		SetRetryAfter(retryAfter).
+		AddRetryCondition(func(r *resty.Response, err error) bool {
+			return r != nil && retryable(r.StatusCode())
+		})
+	if opts.Token != "" {
+		h.SetAuthToken(opts.Token)
+	}
+	return &Client{http: h, baseURL: baseURL}
+}
+
+// OnResponse регистрирует функцию, которая вызывается после каждого ответа,
+// например для журналирования.
+func (c *Client) OnResponse(fn func(method, url string, status int, duration time.Duration)) {
+	c.http.OnAfterResponse(func(_ *resty.Client, r *resty.Response) error {
+		fn(r.Request.Method, r.Request.URL, r.StatusCode(), r.Time())
+		return nil
+	})
+}
+
+// BaseURL возвращает адрес сервера.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// ShortURL возвращает полный короткий URL для кода.
+func (c *Client) ShortURL(code string) string {
+	return c.baseURL + "/" + code
+}
+
+// Shorten сокращает один URL и возвращает полный короткий URL.
+func (c *Client) Shorten(ctx context.Context, longURL string) (string, error) {
+	result, err := c.ShortenBatch(ctx, []string{longURL})
+	if err != nil {
+		return "", err
+	}
+	if len(result) != 1 {
+		return "", fmt.Errorf("unexpected number of results: %d", len(result))
+	}
+	return result[0].ShortURL, nil
+}
+
+// ShortenBatch сокращает несколько URL одним запросом (POST /api/shorten).
+// Уже сокращённые URL возвращаются с прежними кодами.
+func (c *Client) ShortenBatch(ctx context.Context, longURLs []string) ([]Shortened, error) {
+	rs := make([]urlRequest, 0, len(longURLs))
+	for _, u := range longURLs {
+		rs = append(rs, urlRequest{OrigURL: u})
+	}
+
+	response, err := c.http.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(rs).
+		Post("/api/shorten")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(response, http.StatusCreated, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	// Сервер не всегда отвечает с Content-Type: application/json, поэтому
+	// разбираем тело сами, а не через SetResult.
+	var created []urlRequest
+	if err := json.Unmarshal(response.Body(), &created); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	result := make([]Shortened, 0, len(created))
+	for _, r := range created {
+		result = append(result, Shortened{Code: r.ShortURL, ShortURL: c.ShortURL(r.ShortURL), OrigURL: r.OrigURL})
+	}
+	return result, nil
+}
+
+// Expand возвращает исходный URL по коду (GET /{code} без перехода по редиректу).
+// Для ссылки с паролем возвращает ErrProtected, для ссылки, которая
+// открывается страницей предпросмотра, — ErrPreview.
+func (c *Client) Expand(ctx context.Context, code string) (string, error) {
+	response, err := c.http.R().SetContext(ctx).Get("/" + url.PathEscape(code))
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode() == http.StatusOK {
+		if response.Header().Get(pageHeader) == pagePassword {
+			return "", ErrProtected
+		}
+		return "", ErrPreview
+	}
+	if err := checkStatus(response, http.StatusTemporaryRedirect, http.StatusMovedPermanently,
+		http.StatusFound, http.StatusPermanentRedirect); err != nil {
+		return "", err
+	}
+	return response.Header().Get("Location"), nil
+}
+
+// Stats возвращает сведения о ссылке (GET /admin/links/{code}). Нужен токен.
+func (c *Client) Stats(ctx context.Context, code string) (*Link, error) {
+	response, err := c.http.R().SetContext(ctx).Get("/admin/links/" + url.PathEscape(code))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(response, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var link Link
+	if err := json.Unmarshal(response.Body(), &link); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &link, nil
+}
+
+// Delete удаляет ссылку (DELETE /admin/links/{code}). Нужен токен.
+func (c *Client) Delete(ctx context.Context, code string) error {
+	response, err := c.http.R().SetContext(ctx).Delete("/admin/links/" + url.PathEscape(code))
+	if err != nil {
+		return err
+	}
+	return checkStatus(response, http.StatusOK, http.StatusNoContent)
+}
+
+// Ping проверяет доступность сервера и его хранилища (GET /ping).
+func (c *Client) Ping(ctx context.Context) error {
+	response, err := c.http.R().SetContext(ctx).Get("/ping")
+	if err != nil {
+		return err
+	}
+	return checkStatus(response, http.StatusOK)
+}
+
+// nopLogger отключает журнал resty: библиотека не должна писать в stderr
+// приложения. Для журналирования запросов есть OnResponse.
+type nopLogger struct{}
+
+func (nopLogger) Errorf(string, ...any) {}
+func (nopLogger) Warnf(string, ...any)  {}
+func (nopLogger) Debugf(string, ...any) {}
+
+// retryable — ответы, после которых запрос имеет смысл повторить.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter учитывает заголовок Retry-After в секундах. Нулевая задержка
+// означает, что resty посчитает её сам по экспоненте.
+func retryAfter(_ *resty.Client, r *resty.Response) (time.Duration, error) {
+	if r == nil {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(r.Header().Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, nil
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetries — повторы без заметных задержек, чтобы тесты шли быстро.
+var fastRetries = Options{RetryWait: time.Millisecond, RetryMaxWait: 5 * time.Millisecond}
+
+func shortenHandler(w http.ResponseWriter, r *http.Request) {
+	var rs []urlRequest
+	if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+		http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+		return
+	}
+	for i := range rs {
+		rs[i].ShortURL = "abc"
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rs)
+}
+
+func TestShorten(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(shortenHandler))
+	defer srv.Close()
+
+	c := New(srv.URL+"/", fastRetries)
+	short, err := c.Shorten(context.Background(), "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/abc", short)
+
+	batch, err := c.ShortenBatch(context.Background(), []string{"https://example.com", "https://example.org"})
+	require.NoError(t, err)
+	assert.Equal(t, []Shortened{
+		{Code: "abc", ShortURL: srv.URL + "/abc", OrigURL: "https://example.com"},
+		{Code: "abc", ShortURL: srv.URL + "/abc", OrigURL: "https://example.org"},
+	}, batch)
+}
+
+func TestTypedErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusGone, ErrGone},
+		{http.StatusTooManyRequests, ErrRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", tt.status)
+			}))
+			defer srv.Close()
+
+			c := New(srv.URL, Options{Retries: -1})
+			_, err := c.Expand(context.Background(), "abc")
+			require.ErrorIs(t, err, tt.target)
+
+			var statusErr *StatusError
+			require.ErrorAs(t, err, &statusErr)
+			assert.Equal(t, tt.status, statusErr.Code)
+			assert.Equal(t, "nope", statusErr.Body)
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/abc", r.URL.Path)
+		http.Redirect(w, r, "https://example.com", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	long, err := New(srv.URL, fastRetries).Expand(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", long)
+}
+
+func TestExpandPages(t *testing.T) {
+	tests := []struct {
+		page   string
+		target error
+	}{
+		{"preview", ErrPreview},
+		{"password", ErrProtected},
+		{"", ErrPreview},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				if tt.page != "" {
+					w.Header().Set("X-Link-Page", tt.page)
+				}
+				w.Write([]byte("<!DOCTYPE html><html></html>"))
+			}))
+			defer srv.Close()
+
+			long, err := New(srv.URL, fastRetries).Expand(context.Background(), "abc")
+			assert.ErrorIs(t, err, tt.target)
+			assert.Empty(t, long)
+		})
+	}
+}
+
+func TestStatsAndDelete(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/links/{code}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(Link{ShortURL: r.PathValue("code"), OrigURL: "https://example.com", CreatedAt: created})
+	})
+	mux.HandleFunc("DELETE /admin/links/{code}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := New(srv.URL, Options{Token: "secret"})
+	link, err := c.Stats(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, &Link{ShortURL: "abc", OrigURL: "https://example.com", CreatedAt: created}, link)
+	assert.NoError(t, c.Delete(context.Background(), "abc"))
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+
+	require.NoError(t, New(srv.URL, fastRetries).Ping(context.Background()))
+	assert.EqualValues(t, 3, calls.Load())
+
+	// Ошибки клиента не повторяются
+	calls.Store(0)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "bad", http.StatusBadRequest)
+	})
+	assert.Error(t, New(srv.URL, fastRetries).Ping(context.Background()))
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestContextCancellation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := New(srv.URL, fastRetries).Ping(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		encode   func([]byte) []byte
+	}{
+		{name: "zstd", encoding: "zstd", encode: func(b []byte) []byte {
+			enc, _ := zstd.NewWriter(nil)
+			defer enc.Close()
+			return enc.EncodeAll(b, nil)
+		}},
+		{name: "gzip", encoding: "gzip", encode: func(b []byte) []byte {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(b)
+			zw.Close()
+			return buf.Bytes()
+		}},
+		{name: "identity", encode: func(b []byte) []byte { return b }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+
+				// Запрос сжат zstd
+				require.Equal(t, "zstd", r.Header.Get("Content-Encoding"))
+				dec, err := zstd.NewReader(r.Body)
+				require.NoError(t, err)
+				defer dec.Close()
+				body, err := io.ReadAll(dec)
+				require.NoError(t, err)
+				assert.JSONEq(t, `[{"short_url":"","orig_url":"https://example.com"}]`, string(body))
+
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write(tt.encode([]byte(`[{"short_url":"abc","orig_url":"https://example.com"}]`)))
+			}))
+			defer srv.Close()
+
+			c := New(srv.URL, Options{CompressRequests: true})
+			short, err := c.Shorten(context.Background(), "https://example.com")
+			require.NoError(t, err)
+			assert.Equal(t, srv.URL+"/abc", short)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding — кодировки ответов, которые клиент умеет распаковывать.
+const acceptEncoding = "zstd, gzip"
+
+// encodingTransport прозрачно распаковывает ответы в zstd и gzip и при
+// необходимости сжимает тела запросов zstd.
+type encodingTransport struct {
+	base     http.RoundTripper
+	compress bool
+}
+
+func (t *encodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	if t.compress && req.Body != nil && req.Body != http.NoBody && req.Header.Get("Content-Encoding") == "" {
+		if err := compressBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func compressBody(req *http.Request) error {
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	compressed := enc.EncodeAll(data, nil)
+	enc.Close()
+
+	req.Body = io.NopCloser(bytes.NewReader(compressed))
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set("Content-Encoding", "zstd")
+	return nil
+}
+
+func decodeBody(resp *http.Response) error {
+	var body io.ReadCloser
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "":
+		return nil
+	case "gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("gzip response: %w", err)
+		}
+		body = &decodedBody{Reader: zr, closers: []io.Closer{zr, resp.Body}}
+	case "zstd":
+		zr, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("zstd response: %w", err)
+		}
+		body = &decodedBody{Reader: zr, closers: []io.Closer{zstdCloser{zr}, resp.Body}}
+	default:
+		// Незнакомую кодировку оставляем вызывающему как есть
+		return nil
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody закрывает распаковщик вместе с исходным телом ответа.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var first error
+	for _, c := range b.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// zstdCloser приводит zstd.Decoder.Close() без результата к io.Closer.
+type zstdCloser struct{ dec *zstd.Decoder }
+
+func (c zstdCloser) Close() error {
+	c.dec.Close()
+	return nil
+}
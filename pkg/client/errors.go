@@ -0,0 +1,69 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Ошибки для ответов сервера, которые обычно обрабатывают отдельно.
+// Проверять их нужно через errors.Is: клиент возвращает *StatusError.
+var (
+	ErrNotFound    = errors.New("link not found")     // 404
+	ErrConflict    = errors.New("link conflict")      // 409
+	ErrGone        = errors.New("link gone")          // 410
+	ErrRateLimited = errors.New("rate limit reached") // 429
+)
+
+// Ошибки Expand для ссылок, которые вместо редиректа открывают HTML-страницу.
+var (
+	ErrPreview   = errors.New("link opens a preview page")
+	ErrProtected = errors.New("link is password protected")
+)
+
+// pageHeader и его значения — см. urlhandler.PageHeader.
+const (
+	pageHeader   = "X-Link-Page"
+	pagePassword = "password"
+)
+
+// StatusError — ответ сервера с неожиданным кодом.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	body := strings.TrimSpace(e.Body)
+	if body == "" {
+		return fmt.Sprintf("server returned %d %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("server returned %d: %s", e.Code, body)
+}
+
+// Is сопоставляет код ответа с ErrNotFound, ErrConflict, ErrGone и ErrRateLimited.
+func (e *StatusError) Is(target error) bool {
+	switch e.Code {
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusGone:
+		return target == ErrGone
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return false
+}
+
+func checkStatus(response *resty.Response, expected ...int) error {
+	for _, code := range expected {
+		if response.StatusCode() == code {
+			return nil
+		}
+	}
+	return &StatusError{Code: response.StatusCode(), Body: response.String()}
+}
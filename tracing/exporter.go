@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// fileExporterBuffer — сколько спанов может ждать записи, прежде чем новые
+// начнут отбрасываться.
+const fileExporterBuffer = 4096
+
+// FileExporter пишет спаны в файл в формате JSON Lines. Запись идёт в
+// отдельной горутине, чтобы не задерживать обработку запросов.
+type FileExporter struct {
+	file    *os.File
+	spans   chan SpanData
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	// mu не даёт Export отправить спан в уже закрытый канал.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewFileExporter открывает (или создаёт) файл для дозаписи спанов.
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	e := &FileExporter{
+		file:  f,
+		spans: make(chan SpanData, fileExporterBuffer),
+		done:  make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// Export ставит спан в очередь на запись. Если очередь переполнена или
+// экспортёр уже закрыт, спан отбрасывается.
+func (e *FileExporter) Export(span SpanData) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		e.dropped.Add(1)
+		return
+	}
+	select {
+	case e.spans <- span:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Dropped возвращает количество отброшенных спанов.
+func (e *FileExporter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+func (e *FileExporter) run() {
+	defer close(e.done)
+
+	w := bufio.NewWriter(e.file)
+	enc := json.NewEncoder(w)
+	for span := range e.spans {
+		_ = enc.Encode(span)
+		// Сбрасываем буфер, когда очередь опустела, чтобы файл был актуальным.
+		if len(e.spans) == 0 {
+			_ = w.Flush()
+		}
+	}
+	_ = w.Flush()
+}
+
+// Close дописывает оставшиеся спаны и закрывает файл. Спаны, пришедшие
+// после Close, отбрасываются: запросы могут завершаться и во время остановки.
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.spans)
+	}
+	e.mu.Unlock()
+	<-e.done
+	return e.file.Close()
+}
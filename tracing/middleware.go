@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Middleware продолжает трассу из входящего заголовка traceparent (или
+// начинает новую) и оборачивает обработку запроса в серверный спан.
+// Некорректный traceparent игнорируется, как требует спецификация.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = ContextWithRemote(ctx, sc)
+		}
+
+		name := r.Pattern
+		if name == "" {
+			name = r.Method
+		}
+		ctx, span := StartKind(ctx, name, KindServer)
+		defer span.End()
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		if r.Pattern != "" {
+			span.SetAttribute("http.route", r.Pattern)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Inject записывает контекст текущего спана в заголовки исходящего запроса.
+func Inject(r *http.Request) {
+	if sc := SpanContextFromContext(r.Context()); sc.IsValid() {
+		r.Header.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
@@ -0,0 +1,267 @@
+// Package tracing реализует трассировку в стиле OpenTelemetry: распространение
+// контекста по W3C Trace Context (заголовок traceparent), спаны с атрибутами
+// и экспорт завершённых спанов.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceparentHeader — заголовок W3C Trace Context.
+const TraceparentHeader = "traceparent"
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid сообщает, что идентификатор не нулевой.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext — часть спана, которая передаётся между сервисами.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent форматирует контекст в значение заголовка traceparent.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent разбирает заголовок traceparent версии 00.
+// Для будущих версий берутся только известные поля, как требует спецификация.
+func ParseTraceparent(header string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+
+	var sc SpanContext
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace id: %w", err)
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid parent id: %w", err)
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace flags: %w", err)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: zero id", header)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	// Спецификация допускает только строчные hex-цифры.
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("malformed value %q", s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// Exporter получает завершённые спаны.
+type Exporter interface {
+	Export(SpanData)
+}
+
+var exporter atomic.Pointer[Exporter]
+
+// SetExporter задаёт получателя завершённых спанов. nil отключает запись:
+// контекст трассировки при этом всё равно распространяется.
+func SetExporter(e Exporter) {
+	if e == nil {
+		exporter.Store(nil)
+		return
+	}
+	exporter.Store(&e)
+}
+
+// SpanData — неизменяемое описание завершённого спана.
+type SpanData struct {
+	Name         string         `json:"name"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Kind         string         `json:"kind"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	DurationMS   float64        `json:"duration_ms"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// Span — операция внутри трассы. Методы nil-спана ничего не делают, поэтому
+// код может вызывать их без проверок.
+type Span struct {
+	sc     SpanContext
+	parent SpanID
+	name   string
+	kind   string
+	start  time.Time
+
+	mu    sync.Mutex
+	attrs map[string]any
+	err   string
+	ended bool
+}
+
+// SpanContext возвращает контекст спана для передачи дальше.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute добавляет к спану атрибут.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// RecordError отмечает спан как завершившийся ошибкой.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End завершает спан и передаёт его экспортёру, если спан семплирован.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		Name:       s.name,
+		TraceID:    s.sc.TraceID.String(),
+		SpanID:     s.sc.SpanID.String(),
+		Kind:       s.kind,
+		Start:      s.start,
+		End:        end,
+		DurationMS: float64(end.Sub(s.start).Microseconds()) / 1000,
+		Attributes: s.attrs,
+		Error:      s.err,
+	}
+	s.mu.Unlock()
+
+	if s.parent.IsValid() {
+		data.ParentSpanID = s.parent.String()
+	}
+	if e := exporter.Load(); e != nil && s.sc.Sampled {
+		(*e).Export(data)
+	}
+}
+
+// Виды спанов.
+const (
+	KindInternal = "internal"
+	KindServer   = "server"
+	KindClient   = "client"
+)
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithRemote сохраняет в ctx контекст, пришедший от вызывающей стороны.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext возвращает текущий спан или nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext возвращает контекст текущего спана, а если его
+// нет — контекст, полученный от вызывающей стороны.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Start начинает внутренний спан — дочерний для текущего спана в ctx.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal)
+}
+
+// StartKind начинает спан указанного вида.
+func StartKind(ctx context.Context, name, kind string) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	s := &Span{name: name, kind: kind, start: time.Now()}
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		s.sc.TraceID = newTraceID()
+		s.sc.Sampled = true
+	}
+	s.sc.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(s SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+		sampled bool
+	}{
+		{name: "sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sampled: true},
+		{name: "not sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{name: "future version", header: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", sampled: true},
+		{name: "empty", header: "", wantErr: true},
+		{name: "invalid version", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "extra fields in v00", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{name: "zero trace id", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "uppercase", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "short span id", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.header)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			assert.Equal(t, tt.sampled, sc.Sampled)
+		})
+	}
+}
+
+func TestMiddlewarePropagation(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec)
+	defer SetExporter(nil)
+
+	var inner SpanContext
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "HandleGet")
+		inner = span.SpanContext()
+		span.End()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/Ph-VaNhL", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, rec.spans, 2)
+	child, server := rec.spans[0], rec.spans[1]
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+	assert.Equal(t, KindServer, server.Kind)
+
+	assert.Equal(t, "HandleGet", child.Name)
+	assert.Equal(t, server.TraceID, child.TraceID)
+	assert.Equal(t, server.SpanID, child.ParentSpanID)
+	assert.Equal(t, inner.SpanID.String(), child.SpanID)
+}
+
+func TestUnsampledParentIsNotExported(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec)
+	defer SetExporter(nil)
+
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.NoError(t, err)
+	_, span := Start(ContextWithRemote(context.Background(), sc), "op")
+	span.End()
+
+	assert.Empty(t, rec.spans)
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exp, err := NewFileExporter(path)
+	require.NoError(t, err)
+	SetExporter(exp)
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.SetAttribute("db.statement", "SELECT 1")
+	child.End()
+	parent.End()
+
+	SetExporter(nil)
+	require.NoError(t, exp.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var spans []SpanData
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s SpanData
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &s))
+		spans = append(spans, s)
+	}
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, "SELECT 1", spans[0].Attributes["db.statement"])
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+}
+
+func TestFileExporterAfterClose(t *testing.T) {
+	exp, err := NewFileExporter(filepath.Join(t.TempDir(), "spans.jsonl"))
+	require.NoError(t, err)
+
+	// Запросы, которые завершаются во время остановки, экспортируют спаны
+	// одновременно с Close
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				exp.Export(SpanData{Name: "late"})
+			}
+		}()
+	}
+	require.NoError(t, exp.Close())
+	wg.Wait()
+
+	assert.NotPanics(t, func() { exp.Export(SpanData{Name: "after close"}) })
+	assert.Positive(t, exp.Dropped())
+}
+
+func TestNilSpan(t *testing.T) {
+	var span *Span
+	assert.NotPanics(t, func() {
+		span.SetAttribute("key", "value")
+		span.RecordError(assert.AnError)
+		span.End()
+	})
+	assert.False(t, span.SpanContext().IsValid())
+}